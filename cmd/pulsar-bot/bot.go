@@ -85,9 +85,10 @@ reload:
 			discordgo.IntentGuildMembers|
 			discordgo.IntentGuildModeration|
 			discordgo.IntentGuildMessages|
+			discordgo.IntentDirectMessages|
 			discordgo.IntentAutoModerationExecution,
 		true,
-		command.New(pulsar.Settings).Handlers(),
+		command.New(pulsar.Settings, events.Raid).Handlers(),
 		events.Events,
 	)
 	if err != nil {
@@ -107,6 +108,8 @@ reload:
 		}
 	}()
 
+	events.Start()
+
 	sc := make(chan os.Signal, 1)
 	signal.Notify(
 		sc,
@@ -116,16 +119,25 @@ reload:
 		syscall.SIGUSR2,
 	)
 
-	switch <-sc {
+	sig := <-sc
+
+	switch sig {
 	case syscall.SIGUSR2:
 		log.Warn("SIGUSR signal received, reloading")
-		goto reload
 	case os.Interrupt, syscall.SIGINT, syscall.SIGTERM:
 		log.Warn("Terminating signal received, closing down session")
 	}
-
+	// The session is closed on reload too, otherwise its handlers keep on
+	// receiving events alongside those of the reloaded one.
 	err = pulsar.Session.Close()
 	if err != nil {
 		log.Error("could not close session gracefully")
 	}
+	// With no more messages coming in, snapshot the antispam message
+	// cache for the handler set up on reload (or the next start).
+	events.Stop()
+
+	if sig == syscall.SIGUSR2 {
+		goto reload
+	}
 }
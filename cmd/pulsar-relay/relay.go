@@ -17,6 +17,7 @@ import (
 
 	"github.com/lcook/pulsar/internal/bot"
 	"github.com/lcook/pulsar/internal/pulse/hook/git"
+	"github.com/lcook/pulsar/internal/pulse/hook/links"
 	"github.com/lcook/pulsar/internal/relay"
 	"github.com/lcook/pulsar/internal/version"
 )
@@ -72,8 +73,11 @@ reload:
 		log.Fatal(err)
 	}
 
+	pulse := &git.Pulse{Option: (relay.DefaultOptions)}
+
 	hooks := []relay.Hook{
-		&git.Pulse{Option: (relay.DefaultOptions)},
+		pulse,
+		&links.Pulse{Option: (relay.DefaultOptions)},
 	}
 
 	srv, err := relay.InitMux(pulsar.Session, hooks, cfgFile,
@@ -82,7 +86,15 @@ reload:
 		log.Fatal(err)
 	}
 
+	var registered int
+
 	for _, hook := range hooks {
+		if hook.Endpoint() == "" {
+			continue
+		}
+
+		registered++
+
 		log.WithFields(log.Fields{
 			"endpoint": hook.Endpoint(),
 		}).Info("Registered mux handler")
@@ -91,7 +103,9 @@ reload:
 	log.WithFields(log.Fields{
 		"host": pulsar.Settings.AcceptHost,
 		"port": pulsar.Settings.AcceptPort,
-	}).Infof("Initialised relay server with %d hook(s)", len(hooks))
+	}).Infof("Initialised relay server with %d hook(s)", registered)
+
+	pulse.Start(pulsar.Session)
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil &&
@@ -109,7 +123,11 @@ reload:
 		syscall.SIGUSR2,
 	)
 
-	switch <-sc {
+	sig := <-sc
+
+	pulse.Stop()
+
+	switch sig {
 	case syscall.SIGUSR2:
 		log.Warn("SIGUSR signal received, reloading")
 		goto reload
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ActionType string
+
+const (
+	ActionDelete     ActionType = "delete"     // Delete the matched messages.
+	ActionTimeout    ActionType = "timeout"    // Time out the member for `duration`.
+	ActionKick       ActionType = "kick"       // Kick the member from the guild.
+	ActionBan        ActionType = "ban"        // Ban the member, removing `delete_message_days` worth of messages.
+	ActionQuarantine ActionType = "quarantine" // Assign the member the role `role_id`.
+	ActionDM         ActionType = "dm"         // Send the member `message` in a direct message.
+	ActionAlert      ActionType = "alert"      // Only alert moderators.
+)
+
+// Discord allows deleting at most a week of messages when banning.
+const maxDeleteMessageDays int = 7
+
+// Action applied to the author of messages matching a heuristic rule.
+// Actions are either given as a mapping with their parameters, or just
+// the type where no parameters are needed, e.g., `delete`.
+type Action struct {
+	Type              ActionType    `yaml:"type"`
+	Duration          time.Duration `yaml:"duration"`
+	DeleteMessageDays int           `yaml:"delete_message_days"`
+	RoleID            string        `yaml:"role_id"`
+	Message           string        `yaml:"message"`
+}
+
+func (a *Action) UnmarshalYAML(node *yaml.Node) error {
+	type plain Action
+
+	if node.Kind == yaml.ScalarNode {
+		a.Type = ActionType(node.Value)
+	} else if err := node.Decode((*plain)(a)); err != nil {
+		return err
+	}
+
+	return a.validate()
+}
+
+func (a *Action) validate() error {
+	switch a.Type {
+	case ActionDelete, ActionKick, ActionAlert:
+	case ActionTimeout:
+		if a.Duration < 0 {
+			return fmt.Errorf("antispam: timeout action has negative duration %s", a.Duration)
+		}
+	case ActionBan:
+		if a.DeleteMessageDays < 0 || a.DeleteMessageDays > maxDeleteMessageDays {
+			return fmt.Errorf(
+				"antispam: ban action delete_message_days must be within 0-%d, got %d",
+				maxDeleteMessageDays,
+				a.DeleteMessageDays,
+			)
+		}
+	case ActionQuarantine:
+		if a.RoleID == "" {
+			return fmt.Errorf("antispam: quarantine action requires a role_id")
+		}
+	case ActionDM:
+		if a.Message == "" {
+			return fmt.Errorf("antispam: dm action requires a message")
+		}
+	default:
+		return fmt.Errorf("antispam: unknown action type %q", a.Type)
+	}
+
+	return nil
+}
+
+func (a *Action) String() string {
+	switch a.Type {
+	case ActionTimeout:
+		return fmt.Sprintf("%s (%s)", a.Type, a.Duration)
+	case ActionBan:
+		return fmt.Sprintf("%s (%dd)", a.Type, a.DeleteMessageDays)
+	case ActionQuarantine:
+		return fmt.Sprintf("%s (%s)", a.Type, a.RoleID)
+	}
+
+	return string(a.Type)
+}
+
+// Escalation of the actions applied to repeat offenders.  Each step is
+// the list of actions applied for that offence, counting the offences of
+// the member (for any rule) within the window, or ever if no window is
+// given.  Once past the last step, its actions are applied again.
+//
+// For example, a 1h timeout for the first offence, 24h for the second
+// within 30 days and then a ban:
+//
+//	escalation:
+//	  window: 720h
+//	  steps:
+//	    - [delete, {type: timeout, duration: 1h}]
+//	    - [delete, {type: timeout, duration: 24h}]
+//	    - [{type: ban, delete_message_days: 1}]
+type Escalation struct {
+	Window time.Duration `yaml:"window"`
+	Steps  [][]Action    `yaml:"steps"`
+}
+
+// Plan returns the ordered list of actions to apply when the rule is
+// triggered.  Rules without any actions configured time out the member
+// for the rule timeout and delete the matched messages, as do timeout
+// actions without a duration of their own.
+func (r *HeuristicRule) Plan() []Action {
+	if len(r.Actions) == 0 {
+		return []Action{
+			{Type: ActionTimeout, Duration: r.Timeout},
+			{Type: ActionDelete},
+		}
+	}
+
+	return r.fill(r.Actions)
+}
+
+// Escalate returns the actions to apply to a member with the given
+// number of previous offences within the escalation window.  Rules
+// without an escalation policy always apply the same actions (see Plan).
+func (r *HeuristicRule) Escalate(previous int) []Action {
+	if len(r.Escalation.Steps) == 0 {
+		return r.Plan()
+	}
+
+	step := min(max(previous, 0), len(r.Escalation.Steps)-1)
+
+	return r.fill(r.Escalation.Steps[step])
+}
+
+// Copy of the actions, with the rule timeout filled in for timeouts
+// without a duration of their own.
+func (r *HeuristicRule) fill(actions []Action) []Action {
+	filled := make([]Action, len(actions))
+	copy(filled, actions)
+
+	for idx := range filled {
+		if filled[idx].Type == ActionTimeout && filled[idx].Duration == 0 {
+			filled[idx].Duration = r.Timeout
+		}
+	}
+
+	return filled
+}
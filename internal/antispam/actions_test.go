@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestActionUnmarshal(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected []Action
+		valid    bool
+	}{
+		{
+			"Shorthand",
+			"[delete, kick, alert]",
+			[]Action{{Type: ActionDelete}, {Type: ActionKick}, {Type: ActionAlert}},
+			true,
+		},
+		{
+			"Parameters",
+			`
+- type: timeout
+  duration: 1h
+- type: ban
+  delete_message_days: 1
+- type: quarantine
+  role_id: "1435426468187340820"
+- type: dm
+  message: "You have been quarantined"`,
+			[]Action{
+				{Type: ActionTimeout, Duration: time.Hour},
+				{Type: ActionBan, DeleteMessageDays: 1},
+				{Type: ActionQuarantine, RoleID: "1435426468187340820"},
+				{Type: ActionDM, Message: "You have been quarantined"},
+			},
+			true,
+		},
+		{"UnknownType", "[mute]", nil, false},
+		{"BanDeleteDays", "[{type: ban, delete_message_days: 8}]", nil, false},
+		{"QuarantineRole", "[quarantine]", nil, false},
+		{"DirectMessage", "[{type: dm}]", nil, false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var actions []Action
+
+			err := yaml.Unmarshal([]byte(tc.input), &actions)
+			if (err == nil) != tc.valid {
+				t.Fatalf("expected valid=%v, got %v", tc.valid, err)
+			}
+
+			if tc.valid && !slices.Equal(actions, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, actions)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tt := []struct {
+		name     string
+		rule     HeuristicRule
+		expected []Action
+	}{
+		{
+			"Default",
+			HeuristicRule{Timeout: time.Hour},
+			[]Action{{Type: ActionTimeout, Duration: time.Hour}, {Type: ActionDelete}},
+		},
+		{
+			"TimeoutFallback",
+			HeuristicRule{
+				Timeout: time.Hour,
+				Actions: []Action{
+					{Type: ActionDelete},
+					{Type: ActionTimeout},
+					{Type: ActionTimeout, Duration: time.Minute},
+				},
+			},
+			[]Action{
+				{Type: ActionDelete},
+				{Type: ActionTimeout, Duration: time.Hour},
+				{Type: ActionTimeout, Duration: time.Minute},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.rule.Plan(); !slices.Equal(actual, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	var rule HeuristicRule
+
+	err := yaml.Unmarshal([]byte(`
+timeout: 2h
+escalation:
+  window: 720h
+  steps:
+    - [delete, timeout]
+    - [delete, {type: timeout, duration: 24h}]
+    - [{type: ban, delete_message_days: 1}]`), &rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		previous int
+		expected []Action
+	}{
+		{0, []Action{{Type: ActionDelete}, {Type: ActionTimeout, Duration: 2 * time.Hour}}},
+		{1, []Action{{Type: ActionDelete}, {Type: ActionTimeout, Duration: 24 * time.Hour}}},
+		{2, []Action{{Type: ActionBan, DeleteMessageDays: 1}}},
+		{5, []Action{{Type: ActionBan, DeleteMessageDays: 1}}},
+	}
+	for _, tc := range tt {
+		if actual := rule.Escalate(tc.previous); !slices.Equal(actual, tc.expected) {
+			t.Errorf("previous=%d: expected %+v, got %+v", tc.previous, tc.expected, actual)
+		}
+	}
+
+	rule.Escalation = Escalation{}
+	if actual := rule.Escalate(3); !slices.Equal(actual, rule.Plan()) {
+		t.Errorf("expected plan without escalation, got %+v", actual)
+	}
+}
@@ -4,7 +4,10 @@
 package antispam
 
 import (
+	"fmt"
+	"slices"
 	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -15,27 +18,201 @@ type Log struct {
 	Message *discordgo.Message
 	Hash    string
 
-	deleted atomic.Bool
+	deleted  atomic.Bool
+	handled  atomic.Bool
+	author   atomic.Pointer[Author]
+	scope    []string
+	analysis *analysis
+}
+
+// Details derived from the message content used by content matchers,
+// worked out once when the message is logged.
+type analysis struct {
+	normalised  string
+	length      int
+	fingerprint uint64
+	hosts       []string
+	verdicts    []LinkVerdict
+}
+
+func analyse(message *discordgo.Message, links *LinkList) *analysis {
+	a := &analysis{
+		normalised:  Normalise(message.Content),
+		fingerprint: Fingerprint(message.Content),
+		hosts:       extractHosts(message),
+	}
+	a.length = utf8.RuneCountInString(
+		mentionRegex.ReplaceAllLiteralString(a.normalised, "@"),
+	)
+
+	a.verdicts = make([]LinkVerdict, len(a.hosts))
+	for idx, host := range a.hosts {
+		a.verdicts[idx] = links.Verdict(host)
+	}
+
+	return a
+}
+
+// NewLog analyses the message for logging, checking any links it holds
+// against the link list (which may be nil).  The scope is the channel the
+// message was sent in followed by its parents, i.e., the parent channel
+// of a thread and category, used by rules scoped to channels.
+func NewLog(
+	message *discordgo.Message,
+	hash string,
+	scope []string,
+	links *LinkList,
+) Log {
+	return Log{
+		Message:  message,
+		Hash:     hash,
+		scope:    scope,
+		analysis: analyse(message, links),
+	}
+}
+
+func (l *Log) analysed() *analysis {
+	if l.analysis == nil {
+		return analyse(l.Message, nil)
+	}
+
+	return l.analysis
+}
+
+// Scope of the message, being at least the channel it was sent in.
+func (l *Log) Scope() []string {
+	if len(l.scope) == 0 {
+		return []string{l.Message.ChannelID}
+	}
+
+	return l.scope
+}
+
+func (l *Log) Normalised() string { return l.analysed().normalised }
+
+func (l *Log) Fingerprint() uint64 { return l.analysed().fingerprint }
+
+// Length of the content as fingerprinted, i.e., normalised with mentions
+// reduced to a placeholder.
+func (l *Log) Length() int { return l.analysed().length }
+
+func (l *Log) Hosts() []string { return l.analysed().hosts }
+
+// Verdicts on each of the hosts, in the same order.
+func (l *Log) Verdicts() []LinkVerdict { return l.analysed().verdicts }
+
+// Flagged hosts, i.e., blocked or lookalike, with their verdict.
+func (l *Log) Flagged() []string {
+	var (
+		a       = l.analysed()
+		flagged []string
+	)
+
+	for idx, verdict := range a.verdicts {
+		if verdict == LinkBlocked || verdict == LinkLookalike {
+			flagged = append(flagged, fmt.Sprintf("%s (%s)", a.hosts[idx], verdict))
+		}
+	}
+
+	return flagged
 }
 
 func (l *Log) Deleted() bool { return l.deleted.Load() }
 
 func (l *Log) MarkDeleted() { l.deleted.Store(true) }
 
+// Handled reports whether the log was part of a match that has been
+// enforced, whether or not it was deleted, and so must not count towards
+// another match.
+func (l *Log) Handled() bool { return l.handled.Load() }
+
+func (l *Log) MarkHandled() { l.handled.Store(true) }
+
+// Author of the message as described when it was evaluated (see Run), or
+// from the message itself if it has yet to be, e.g., when restored from a
+// snapshot, in which case the messages they sent are not known.
+func (l *Log) Author() Author {
+	if author := l.author.Load(); author != nil {
+		return *author
+	}
+
+	return describeAuthor(l.Message)
+}
+
+// Whether the log is still counted by rules.
+func (l *Log) live() bool { return !l.Deleted() && !l.Handled() }
+
+// Duplicate reports whether the log has the same content as another, or,
+// given a similarity above zero, content at least that similar to it.
+func (l *Log) Duplicate(other *Log, similarity float64) bool {
+	if l.Hash == other.Hash {
+		return true
+	}
+
+	if similarity <= 0 || l.Fingerprint() == 0 || other.Fingerprint() == 0 {
+		return false
+	}
+
+	return Similarity(l.Fingerprint(), other.Fingerprint()) >= similarity
+}
+
+// NewCache returns a cache of up to size logged messages, indexed by
+// message ID and grouped by author.
+func NewCache(size int) *cache.Index[Log] {
+	return cache.NewIndex(
+		size,
+		func(log *Log) string { return log.Message.ID },
+		func(log *Log) string {
+			if log.Message.Author == nil {
+				return ""
+			}
+
+			return log.Message.Author.ID
+		},
+	)
+}
+
+// Run evaluates every rule against the messages logged from the author
+// (or every member for coordinated rules), returning the matches in the
+// order the rules are listed.  Rules with conditions the author does not
+// meet are skipped, as are messages deleted or already handled, and the
+// messages of members not meeting them for coordinated rules.
 func Run(
 	m *discordgo.MessageCreate,
 	hash string,
-	cache *cache.RingBuffer[Log],
+	author Author,
+	cache *cache.Index[Log],
 	rules []HeuristicRule,
-) ([]*Log, *HeuristicRule) {
-	var logs []*Log
+) []Match {
+	var (
+		logs []*Log
+		all  []*Log
+	)
 
-	for idx := range cache.Slice() {
-		log := &cache.Slice()[idx]
-		if m.Author.ID == log.Message.Author.ID && !log.Deleted() {
+	for _, log := range cache.Group(m.Author.ID) {
+		if log.live() {
 			logs = append(logs, log)
 		}
 	}
+	// Only collect the logs of every member when needed.
+	if slices.ContainsFunc(rules, func(rule HeuristicRule) bool {
+		return rule.Coordinated()
+	}) {
+		cache.ForEach(func(log *Log) {
+			if log.live() {
+				all = append(all, log)
+			}
+		})
+	}
+
+	current, ok := cache.Get(m.ID)
+	if !ok {
+		log := NewLog(m.Message, hash, nil, nil)
+		current = &log
+	}
+	// Kept for coordinated rules, which check the conditions of every
+	// member taking part.
+	current.author.Store(&author)
 
-	return evaluate(hash, logs, rules)
+	return evaluate(current, author, logs, all, rules)
 }
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -65,7 +66,7 @@ func TestEvaluateRules(t *testing.T) {
 			last := logs[len(logs)-1]
 			for _, definition := range definitions {
 				results := evaluateRule(
-					last.Hash,
+					last,
 					logs,
 					definition,
 					last.Message.Timestamp,
@@ -118,3 +119,184 @@ func LoadTestdata[T any](t *testing.T, file string) T {
 
 	return result
 }
+
+func TestEvaluateShadow(t *testing.T) {
+	var rules []HeuristicRule
+
+	err := yaml.Unmarshal([]byte(`
+- id: SHADOW_SPAM
+  mode: shadow
+  thresholds:
+    messages: 2
+    window: 15s
+- id: CHANNEL_SPAM
+  mode: enforce
+  thresholds:
+    messages: 3
+    window: 15s
+- id: CHANNEL_SPAM_STRICT
+  thresholds:
+    messages: 2
+    window: 15s`), &rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		now  = time.Now()
+		logs = make([]*Log, 0, 3)
+	)
+
+	for idx := range 3 {
+		logs = append(logs, &Log{
+			Message: &discordgo.Message{
+				Content:   "SPAM",
+				Timestamp: now.Add(-time.Duration(idx) * time.Second),
+			},
+		})
+	}
+
+	matches := evaluate(logs[0], Author{}, logs[:2], nil, rules)
+	if len(matches) != 2 || matches[0].Rule.ID != "SHADOW_SPAM" {
+		t.Fatalf("expected shadow and strict rules to match, got %+v", matches)
+	}
+
+	if enforced := Enforced(matches); enforced == nil || enforced.Rule.ID != "CHANNEL_SPAM_STRICT" {
+		t.Errorf("expected CHANNEL_SPAM_STRICT to be enforced, got %+v", enforced)
+	}
+
+	matches = evaluate(logs[0], Author{}, logs, nil, rules)
+	if len(matches) != 3 {
+		t.Fatalf("expected all rules to match, got %d", len(matches))
+	}
+	// The enforced rule listed first takes priority.
+	if enforced := Enforced(matches); enforced == nil || enforced.Rule.ID != "CHANNEL_SPAM" {
+		t.Errorf("expected CHANNEL_SPAM to be enforced, got %+v", enforced)
+	}
+
+	if Enforced(matches[:1]) != nil {
+		t.Error("expected shadow matches alone not to be enforced")
+	}
+
+	if err := yaml.Unmarshal([]byte("[{id: X, mode: dryrun}]"), &rules); err == nil {
+		t.Error("expected unknown mode to be rejected")
+	}
+}
+
+func TestChannelScope(t *testing.T) {
+	const (
+		category = "100"
+		general  = "101"
+		offtopic = "102"
+		thread   = "103"
+		commands = "200"
+	)
+
+	tt := []struct {
+		name     string
+		channels ChannelScope
+		scope    []string
+		expected bool
+	}{
+		{"Unscoped", ChannelScope{}, []string{general, category}, true},
+		{"IncludeCategory", ChannelScope{Include: []string{category}}, []string{general, category}, true},
+		{"IncludeThread", ChannelScope{Include: []string{general}}, []string{thread, general, category}, true},
+		{"NotIncluded", ChannelScope{Include: []string{category}}, []string{commands}, false},
+		{"Exclude", ChannelScope{Exclude: []string{commands}}, []string{commands}, false},
+		{"ExcludeOther", ChannelScope{Exclude: []string{commands}}, []string{general, category}, true},
+		{
+			"ExcludeWithinIncluded",
+			ChannelScope{Include: []string{category}, Exclude: []string{offtopic}},
+			[]string{offtopic, category},
+			false,
+		},
+		{
+			"IncludeWithinExcluded",
+			ChannelScope{Include: []string{offtopic}, Exclude: []string{category}},
+			[]string{offtopic, category},
+			true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.channels.Allows(tc.scope); actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+
+	rule := HeuristicRule{ID: "CHANNEL_SPAM", Channels: ChannelScope{Exclude: []string{commands}}}
+	rule.Thresholds.Messages = 3
+	rule.Thresholds.Window = 15 * time.Second
+
+	var (
+		now  = time.Now()
+		logs = make([]*Log, 0, 4)
+	)
+
+	for _, channel := range []string{general, commands, general, general} {
+		log := NewLog(&discordgo.Message{
+			ChannelID: channel,
+			Content:   "SPAM",
+			Timestamp: now,
+		}, "", []string{channel, category}, nil)
+		logs = append(logs, &log)
+	}
+
+	if results := evaluateRule(logs[3], logs, rule, now); len(results) != 3 {
+		t.Errorf("expected 3 message(s) outside of excluded channels, got %d", len(results))
+	}
+
+	if results := evaluateRule(logs[3], logs[:3], rule, now); len(results) != 0 {
+		t.Errorf("expected excluded channel messages not to count, got %d", len(results))
+	}
+
+	if results := evaluateRule(logs[1], logs, rule, now); len(results) != 0 {
+		t.Errorf("expected messages in excluded channels not to trigger, got %d", len(results))
+	}
+}
+
+func TestRunHandled(t *testing.T) {
+	rules := []HeuristicRule{{
+		ID:      "CHANNEL_SPAM",
+		Actions: []Action{{Type: ActionAlert}},
+	}}
+	rules[0].Thresholds.Messages = 3
+	rules[0].Thresholds.Window = time.Minute
+
+	var (
+		logs    = NewCache(10)
+		now     = time.Now()
+		matched int
+	)
+	// A rule that does not delete the messages it matches must not match
+	// them again with every message that follows.
+	for idx := range rules[0].Thresholds.Messages + 2 {
+		id := strconv.Itoa(idx)
+		m := &discordgo.MessageCreate{Message: &discordgo.Message{
+			ID:        id,
+			Author:    &discordgo.User{ID: "a"},
+			Content:   "SPAM " + id,
+			Timestamp: now,
+		}}
+		logs.Add(NewLog(m.Message, id, nil, nil))
+
+		for _, match := range Run(m, id, Author{}, logs, rules) {
+			matched++
+
+			for _, log := range match.Logs {
+				log.MarkHandled()
+			}
+		}
+	}
+
+	if matched != 1 {
+		t.Errorf("expected a single match, got %d", matched)
+	}
+
+	logs.ForEach(func(log *Log) {
+		if log.Deleted() {
+			t.Errorf("message %s: expected not to be marked deleted", log.Message.ID)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/yaml.v3"
+)
+
+// Conditions on the author of a message, restricting a heuristic rule to
+// members matching all of those given, e.g., new accounts or members yet
+// to send many messages, allowing stricter rules for them than for
+// established members.
+type Conditions struct {
+	MaxAccountAge time.Duration `yaml:"max_account_age"` // Account created less than this long ago.
+	MaxMemberAge  time.Duration `yaml:"max_member_age"`  // Joined the guild less than this long ago.
+	Pending       bool          `yaml:"pending"`         // Yet to pass membership screening.
+	NoRoles       bool          `yaml:"no_roles"`        // Without any roles.
+	MaxMessages   int           `yaml:"max_messages"`    // Sent at most this many messages (counting the one evaluated).
+}
+
+func (c *Conditions) UnmarshalYAML(node *yaml.Node) error {
+	type plain Conditions
+
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	// Messages are only counted from when the bot first runs, so members
+	// who joined long before then would all appear to have sent next to
+	// none.
+	if c.MaxMessages > 0 && c.MaxMemberAge <= 0 {
+		return errors.New("antispam: max_messages condition requires max_member_age")
+	}
+
+	return nil
+}
+
+// Author of the message evaluated, as needed by the rule conditions.
+type Author struct {
+	Created  time.Time
+	Joined   time.Time
+	Pending  bool
+	Roles    int
+	Messages int
+}
+
+// NewAuthor describes the author of the message, counting the message
+// towards those they have sent in the guild (see MessageCounter).
+func NewAuthor(m *discordgo.MessageCreate, counter *MessageCounter) Author {
+	author := describeAuthor(m.Message)
+	author.Messages = counter.Increment(m.Author.ID, author.Joined)
+
+	return author
+}
+
+// Describe the author of the message as far as the message goes, leaving
+// out the messages they sent.
+func describeAuthor(m *discordgo.Message) Author {
+	var author Author
+
+	if m.Author != nil {
+		author.Created, _ = discordgo.SnowflakeTimestamp(m.Author.ID)
+	}
+
+	if m.Member != nil {
+		author.Joined = m.Member.JoinedAt
+		author.Pending = m.Member.Pending
+		author.Roles = len(m.Member.Roles)
+	}
+
+	return author
+}
+
+func (c *Conditions) Match(author Author, now time.Time) bool {
+	if c.MaxAccountAge > 0 &&
+		(author.Created.IsZero() || now.Sub(author.Created) >= c.MaxAccountAge) {
+		return false
+	}
+
+	if c.MaxMemberAge > 0 &&
+		(author.Joined.IsZero() || now.Sub(author.Joined) >= c.MaxMemberAge) {
+		return false
+	}
+
+	if c.Pending && !author.Pending {
+		return false
+	}
+
+	if c.NoRoles && author.Roles > 0 {
+		return false
+	}
+
+	if c.MaxMessages > 0 && author.Messages > c.MaxMessages {
+		return false
+	}
+
+	return true
+}
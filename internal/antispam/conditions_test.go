@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConditions(t *testing.T) {
+	var (
+		now         = time.Now()
+		established = Author{
+			Created:  now.Add(-365 * 24 * time.Hour),
+			Joined:   now.Add(-30 * 24 * time.Hour),
+			Roles:    2,
+			Messages: 500,
+		}
+		newcomer = Author{
+			Created:  now.Add(-time.Hour),
+			Joined:   now.Add(-5 * time.Minute),
+			Pending:  true,
+			Messages: 1,
+		}
+	)
+
+	tt := []struct {
+		name       string
+		conditions Conditions
+		author     Author
+		expected   bool
+	}{
+		{"None", Conditions{}, established, true},
+		{"AccountAge", Conditions{MaxAccountAge: 24 * time.Hour}, newcomer, true},
+		{"AccountAgeEstablished", Conditions{MaxAccountAge: 24 * time.Hour}, established, false},
+		{"MemberAge", Conditions{MaxMemberAge: 10 * time.Minute}, newcomer, true},
+		{"MemberAgeEstablished", Conditions{MaxMemberAge: 10 * time.Minute}, established, false},
+		{"MemberAgeUnknown", Conditions{MaxMemberAge: 10 * time.Minute}, Author{}, false},
+		{"Pending", Conditions{Pending: true}, newcomer, true},
+		{"PendingEstablished", Conditions{Pending: true}, established, false},
+		{"NoRoles", Conditions{NoRoles: true}, newcomer, true},
+		{"NoRolesEstablished", Conditions{NoRoles: true}, established, false},
+		{"Messages", Conditions{MaxMessages: 10}, newcomer, true},
+		{"MessagesEstablished", Conditions{MaxMessages: 10}, established, false},
+		{
+			"All",
+			Conditions{MaxMemberAge: 10 * time.Minute, NoRoles: true, MaxMessages: 10},
+			newcomer,
+			true,
+		},
+		{
+			"AllButOne",
+			Conditions{MaxMemberAge: 10 * time.Minute, NoRoles: true, MaxMessages: 10},
+			Author{Joined: newcomer.Joined, Roles: 1, Messages: 1},
+			false,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.conditions.Match(tc.author, now); actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConditionsUnmarshal(t *testing.T) {
+	var paired, unpaired Conditions
+
+	if err := yaml.Unmarshal([]byte("{max_member_age: 10m, max_messages: 10}"), &paired); err != nil {
+		t.Errorf("expected paired conditions to be accepted, got %v", err)
+	}
+
+	if err := yaml.Unmarshal([]byte("{max_messages: 10}"), &unpaired); err == nil {
+		t.Error("expected max_messages without max_member_age to be rejected")
+	}
+}
+
+func TestMessageCounter(t *testing.T) {
+	rules := []HeuristicRule{{}, {Conditions: Conditions{MaxMemberAge: time.Hour, MaxMessages: 3}}}
+
+	counter, err := NewMessageCounter(rules[:1], "")
+	if err != nil || counter != nil {
+		t.Fatalf("expected no counter without conditions, got %v (%v)", counter, err)
+	}
+
+	if counter.Increment("1", time.Now()) != 0 {
+		t.Error("expected nil counter to count nothing")
+	}
+
+	var (
+		path   = filepath.Join(t.TempDir(), "messages.jsonl")
+		now    = time.Now()
+		joined = now.Add(-time.Minute)
+	)
+
+	counter, err = NewMessageCounter(rules, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Counts stop once past the limit, where no rule matches anymore.
+	for _, expected := range []int{1, 2, 3, 4, 4} {
+		if actual := counter.Increment("1", joined); actual != expected {
+			t.Errorf("expected count %d, got %d", expected, actual)
+		}
+	}
+
+	// Counts carry over to a new counter, such as after a restart.
+	counter, err = NewMessageCounter(rules, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := counter.Increment("1", joined); actual != 4 {
+		t.Errorf("expected persisted count 4, got %d", actual)
+	}
+
+	if actual := counter.Increment("2", joined); actual != 1 {
+		t.Errorf("expected count 1 for another member, got %d", actual)
+	}
+	// Members who joined before the member age, including those joining
+	// before messages were counted at all, are never counted.
+	if actual := counter.Increment("3", now.Add(-2*time.Hour)); actual != 4 {
+		t.Errorf("expected established member to be past the limit, got %d", actual)
+	}
+
+	if actual := counter.Increment("1", now); actual != 1 {
+		t.Errorf("expected count to start afresh on rejoining, got %d", actual)
+	}
+
+	// Counts of members past the member age are dropped.
+	counter.now = func() time.Time { return now.Add(2 * time.Hour) }
+	counter.Increment("4", now.Add(time.Hour+time.Minute))
+
+	if actual := counter.store.Len(); actual != 1 {
+		t.Errorf("expected 1 count left, got %d", actual)
+	}
+}
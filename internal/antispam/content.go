@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	mentionRegex = regexp.MustCompile(`<@!?(\d+)>`)
+	urlRegex     = regexp.MustCompile(`(?i)\bhttps?://[^\s<>()\[\]"']+`)
+)
+
+// Content matchers of a heuristic rule, restricting the rule to messages
+// with recognisable text.  A message matches if any of the patterns,
+// keywords, domains or link verdicts do.  Patterns and keywords are
+// matched against the normalised content (see Normalise), so should be
+// written in lowercase.
+type Content struct {
+	Patterns []string      `yaml:"patterns"`
+	Keywords []string      `yaml:"keywords"`
+	Domains  []string      `yaml:"domains"`
+	Links    []LinkVerdict `yaml:"links"`
+
+	patterns []*regexp.Regexp
+	keywords []string
+	domains  []string
+}
+
+func (c *Content) UnmarshalYAML(node *yaml.Node) error {
+	type plain Content
+
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	return c.Compile()
+}
+
+// Compile the matchers, done once when the rules are loaded rather than
+// every time they are evaluated.
+func (c *Content) Compile() error {
+	c.patterns = make([]*regexp.Regexp, 0, len(c.Patterns))
+	for _, pattern := range c.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("antispam: invalid content pattern %q: %w", pattern, err)
+		}
+
+		c.patterns = append(c.patterns, re)
+	}
+
+	c.keywords = make([]string, 0, len(c.Keywords))
+	for _, keyword := range c.Keywords {
+		if normalised := Normalise(keyword); normalised != "" {
+			c.keywords = append(c.keywords, normalised)
+		}
+	}
+
+	c.domains = make([]string, 0, len(c.Domains))
+	for _, domain := range c.Domains {
+		if host := normaliseHost(domain); host != "" {
+			c.domains = append(c.domains, host)
+		}
+	}
+
+	for _, verdict := range c.Links {
+		if verdict != LinkBlocked && verdict != LinkLookalike {
+			return fmt.Errorf("antispam: invalid content link verdict %q", verdict)
+		}
+	}
+
+	return nil
+}
+
+func (c *Content) Empty() bool {
+	return len(c.Patterns) == 0 && len(c.Keywords) == 0 &&
+		len(c.Domains) == 0 && len(c.Links) == 0
+}
+
+func (c *Content) Match(log *Log) bool {
+	normalised := log.Normalised()
+
+	for _, re := range c.patterns {
+		if re.MatchString(normalised) {
+			return true
+		}
+	}
+
+	for _, keyword := range c.keywords {
+		if strings.Contains(normalised, keyword) {
+			return true
+		}
+	}
+
+	if len(c.domains) > 0 {
+		for _, host := range log.Hosts() {
+			for _, domain := range c.domains {
+				if withinDomain(host, domain) {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, verdict := range log.Verdicts() {
+		if slices.Contains(c.Links, verdict) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lcook/pulsar/internal/store"
+)
+
+// Messages sent by a member since they joined.
+type messageCount struct {
+	Count  int       `json:"count"`
+	Joined time.Time `json:"joined"`
+}
+
+// MessageCounter counts the messages sent by each member, as matched by
+// the `max_messages` rule condition.  The condition is always paired with
+// `max_member_age` (see Conditions), so only members who joined within the
+// largest member age of those rules are counted: anyone who joined earlier
+// cannot match any of them, however many messages they sent, and is
+// forgotten.  Counts stop just past the limit, being the largest
+// `max_messages` of any rule, as anything beyond it makes no difference.
+// This keeps the counter down to recent members, and writes to the backing
+// store, if any, down to a handful for each of them.
+type MessageCounter struct {
+	limit  int
+	maxAge time.Duration
+
+	mu     sync.Mutex
+	counts map[string]messageCount
+	store  *store.Store[messageCount]
+	swept  time.Time
+	now    func() time.Time
+}
+
+// NewMessageCounter returns a counter for the rules, persisted to the
+// store at path (or kept in memory if empty).  Rules without a message
+// count condition need no counter, in which case nil is returned.
+func NewMessageCounter(rules []HeuristicRule, path string) (*MessageCounter, error) {
+	var (
+		limit  int
+		maxAge time.Duration
+	)
+
+	for idx := range rules {
+		if conditions := rules[idx].Conditions; conditions.MaxMessages > 0 {
+			limit = max(limit, conditions.MaxMessages)
+			maxAge = max(maxAge, conditions.MaxMemberAge)
+		}
+	}
+
+	if limit == 0 {
+		return nil, nil //nolint:nilnil // No counter is needed.
+	}
+
+	c := &MessageCounter{
+		limit:  limit,
+		maxAge: maxAge,
+		counts: make(map[string]messageCount),
+		now:    time.Now,
+	}
+
+	if path != "" {
+		counts, err := store.Open[messageCount](path)
+		if err != nil {
+			return nil, err
+		}
+
+		c.store = counts
+	}
+
+	return c, nil
+}
+
+// Whether a member who joined at the given time is past the member age of
+// every rule counting messages.  Members not known to have joined at all
+// are treated as such.
+func (c *MessageCounter) expired(joined, now time.Time) bool {
+	return joined.IsZero() || (c.maxAge > 0 && now.Sub(joined) >= c.maxAge)
+}
+
+func (c *MessageCounter) get(userID string) (messageCount, bool) {
+	if c.store != nil {
+		return c.store.Get(userID)
+	}
+
+	count, ok := c.counts[userID]
+
+	return count, ok
+}
+
+func (c *MessageCounter) put(userID string, count messageCount) {
+	if c.store != nil {
+		c.store.Put(userID, count)
+		return
+	}
+
+	c.counts[userID] = count
+}
+
+func (c *MessageCounter) delete(userID string) {
+	if c.store != nil {
+		c.store.Delete(userID)
+		return
+	}
+
+	delete(c.counts, userID)
+}
+
+// Drop the counts of members past the member age, once every member age
+// at most.
+func (c *MessageCounter) sweep(now time.Time) {
+	if c.maxAge <= 0 || now.Sub(c.swept) < c.maxAge {
+		return
+	}
+
+	c.swept = now
+
+	if c.store != nil {
+		c.store.Prune(func(_ string, count messageCount) bool {
+			return c.expired(count.Joined, now)
+		})
+
+		return
+	}
+
+	for userID, count := range c.counts {
+		if c.expired(count.Joined, now) {
+			delete(c.counts, userID)
+		}
+	}
+}
+
+// Increment the count of messages sent by the member who joined at the
+// given time, returning the new count.  Members past the member age are
+// not counted, their count being just past the limit.  A nil counter
+// always returns zero.
+func (c *MessageCounter) Increment(userID string, joined time.Time) int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.sweep(now)
+
+	if c.expired(joined, now) {
+		c.delete(userID)
+		return c.limit + 1
+	}
+
+	count, ok := c.get(userID)
+	if !ok || !count.Joined.Equal(joined) {
+		// Counting afresh for a member who left and joined again.
+		count = messageCount{Joined: joined}
+	}
+
+	if count.Count > c.limit {
+		return count.Count
+	}
+
+	count.Count++
+	c.put(userID, count)
+
+	return count.Count
+}
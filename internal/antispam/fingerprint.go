@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"math/bits"
+)
+
+// Length, in characters, of the overlapping shingles content is broken
+// into when fingerprinting.
+const shingleLength int = 3
+
+// FNV-1a parameters used to hash shingles.
+const (
+	fnvOffset uint64 = 14695981039346656037
+	fnvPrime  uint64 = 1099511628211
+)
+
+// Fingerprint of the content using SimHash, such that near-identical
+// content (e.g., a character changed, a random suffix added, or mentions
+// reordered) results in fingerprints differing by only a few bits.  The
+// content is normalised and mentions are reduced to a placeholder first,
+// so that the same message aimed at different members looks the same.
+// Empty content has a zero fingerprint.
+func Fingerprint(content string) uint64 {
+	runes := []rune(mentionRegex.ReplaceAllLiteralString(Normalise(content), "@"))
+	if len(runes) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+
+	shingles := max(len(runes)-shingleLength+1, 1)
+	for idx := range shingles {
+		sum := fnvOffset
+		for _, r := range runes[idx:min(idx+shingleLength, len(runes))] {
+			sum ^= uint64(r) //nolint:gosec // Decoded runes are never negative.
+			sum *= fnvPrime
+		}
+
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+
+	return fingerprint
+}
+
+// Similarity between two fingerprints, from 0 (nothing in common) to 1
+// (identical), being the proportion of bits they share.
+func Similarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
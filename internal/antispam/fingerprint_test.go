@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const scamMessage string = "Free nitro for everyone, claim now at https://example.com/gift"
+
+func TestSimilarity(t *testing.T) {
+	const threshold float64 = 0.85
+
+	tt := []struct {
+		name    string
+		a, b    string
+		similar bool
+	}{
+		{"Identical", scamMessage, scamMessage, true},
+		{"Punctuation", scamMessage, scamMessage + "!", true},
+		{"Suffix", scamMessage, scamMessage + " 83jd9s", true},
+		{"Character", scamMessage, "Free nitr0 for everyone, claim now at https://example.com/gift", true},
+		{"Case", scamMessage, "FREE NITRO for everyone, claim now at https://example.com/gift", true},
+		{"Mentions", "<@1> <@2> <@3> check this out", "<@3> <@!1> <@2> check this out", true},
+		{"Unrelated", scamMessage, "does anyone know how to build the ports tree with poudriere?", false},
+		{"Short", "hello", "world", false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			similarity := Similarity(Fingerprint(tc.a), Fingerprint(tc.b))
+			if (similarity >= threshold) != tc.similar {
+				t.Errorf("expected similar=%v, got similarity %.3f", tc.similar, similarity)
+			}
+		})
+	}
+
+	if Fingerprint("") != 0 {
+		t.Error("expected empty content to have a zero fingerprint")
+	}
+}
+
+func TestNearDuplicate(t *testing.T) {
+	var (
+		rule     = HeuristicRule{ID: "CHANNEL_SPAM_NEAR_DUPE", Duplicated: true}
+		now      = time.Now()
+		contents = []string{
+			scamMessage,
+			scamMessage + " x7f2",
+			"free nitro for everyone claim now at https://example.com/gift!!",
+			"Free nitr0 for everyone, claim now at https://example.com/gift 91kd",
+		}
+		logs = make([]*Log, 0, len(contents))
+	)
+
+	rule.Thresholds.Messages = 4
+	rule.Thresholds.Window = 15 * time.Second
+
+	for idx, content := range contents {
+		log := NewLog(&discordgo.Message{
+			Content:   content,
+			Timestamp: now.Add(time.Duration(idx) * time.Second),
+		}, strconv.Itoa(idx), nil, nil)
+		logs = append(logs, &log)
+	}
+
+	current := logs[len(logs)-1]
+	if results := evaluateRule(current, logs, rule, now); len(results) != 0 {
+		t.Errorf("expected no match without similarity, got %d message(s)", len(results))
+	}
+
+	rule.Similarity = 0.85
+	if results := evaluateRule(current, logs, rule, now); len(results) != len(logs) {
+		t.Errorf("expected %d message(s) to match, got %d", len(logs), len(results))
+	}
+}
+
+func TestCoordinated(t *testing.T) {
+	rules := []HeuristicRule{{ID: "COORDINATED_SPAM", Duplicated: true, Similarity: 0.85}}
+	rules[0].Thresholds.Messages = 3
+	rules[0].Thresholds.Authors = 3
+	rules[0].Thresholds.Window = time.Minute
+
+	var (
+		logs = NewCache(10)
+		now  = time.Now()
+		m    *discordgo.MessageCreate
+	)
+
+	post := func(id, author, content string) []Match {
+		m = &discordgo.MessageCreate{Message: &discordgo.Message{
+			ID:        id,
+			Author:    &discordgo.User{ID: author},
+			Content:   content,
+			Timestamp: now,
+		}}
+		logs.Add(NewLog(m.Message, id, nil, nil))
+
+		return Run(m, id, Author{}, logs, rules)
+	}
+
+	post("1", "a", scamMessage)
+	post("2", "a", scamMessage+" x7f2")
+
+	if matches := post("3", "b", scamMessage+" 91kd"); len(matches) != 0 {
+		t.Fatalf("expected no match with 2 authors, got %d", len(matches))
+	}
+
+	matches := post("4", "c", scamMessage)
+	if len(matches) != 1 || len(matches[0].Logs) != 4 {
+		t.Fatalf("expected 4 message(s) to match with 3 authors, got %v", matches)
+	}
+
+	// Messages already dealt with no longer count towards a raid.
+	logs.ForEach(func(log *Log) { log.MarkDeleted() })
+
+	if matches := post("5", "d", scamMessage); len(matches) != 0 {
+		t.Errorf("expected deleted messages to be ignored, got %d match(es)", len(matches))
+	}
+}
+
+func TestCoordinatedParticipants(t *testing.T) {
+	rules := []HeuristicRule{{ID: "COORDINATED_SPAM", Duplicated: true}}
+	rules[0].Thresholds.Authors = 3
+	rules[0].Thresholds.Window = time.Minute
+	rules[0].Conditions.MaxMemberAge = time.Hour
+
+	var (
+		logs = NewCache(10)
+		now  = time.Now()
+		m    *discordgo.MessageCreate
+	)
+
+	post := func(id, author, content string, joined time.Time) []Match {
+		m = &discordgo.MessageCreate{Message: &discordgo.Message{
+			ID:        id,
+			Author:    &discordgo.User{ID: author},
+			Member:    &discordgo.Member{JoinedAt: joined},
+			Content:   content,
+			Timestamp: now,
+		}}
+		logs.Add(NewLog(m.Message, content, nil, nil))
+
+		return Run(m, content, describeAuthor(m.Message), logs, rules)
+	}
+
+	// Members greeting one another are not a raid.
+	for idx, author := range []string{"a", "b", "c"} {
+		if matches := post(strconv.Itoa(idx), author, "hi all", now); len(matches) != 0 {
+			t.Fatalf("expected short content not to match, got %v", matches)
+		}
+	}
+
+	// Nor is an established member taking part.
+	post("3", "a", scamMessage, now)
+	post("4", "d", scamMessage, now.Add(-24*time.Hour))
+
+	if matches := post("5", "b", scamMessage, now); len(matches) != 0 {
+		t.Fatalf("expected established member not to take part, got %v", matches)
+	}
+
+	matches := post("6", "c", scamMessage, now)
+	if len(matches) != 1 || len(matches[0].Logs) != 3 {
+		t.Fatalf("expected 3 message(s) to match with 3 new members, got %v", matches)
+	}
+
+	if slices.ContainsFunc(matches[0].Logs, func(log *Log) bool {
+		return log.Message.Author.ID == "d"
+	}) {
+		t.Errorf("expected established member to be left out, got %v", matches[0].Logs)
+	}
+}
+
+func BenchmarkFingerprint(b *testing.B) {
+	for b.Loop() {
+		Fingerprint(scamMessage)
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	rules := []HeuristicRule{{ID: "CHANNEL_SPAM_NEAR_DUPE", Duplicated: true, Similarity: 0.85}}
+	rules[0].Thresholds.Messages = 5
+	rules[0].Thresholds.Window = 15 * time.Second
+
+	for _, size := range []int{500, 2000, 5000, 10000} {
+		b.Run(fmt.Sprintf("Cache%d", size), func(b *testing.B) {
+			var (
+				logs = NewCache(size)
+				now  = time.Now()
+			)
+			// Fill the cache with messages from a hundred authors, with
+			// the author under test having sent one in every hundred.
+			for idx := range size {
+				message := &discordgo.Message{
+					ID:        strconv.Itoa(idx),
+					Author:    &discordgo.User{ID: strconv.Itoa(idx % 100)},
+					Content:   fmt.Sprintf("%s %d", scamMessage, idx),
+					Timestamp: now,
+				}
+				logs.Add(NewLog(message, message.ID, nil, nil))
+			}
+
+			m := &discordgo.MessageCreate{Message: &discordgo.Message{
+				ID:        strconv.Itoa(size - 1),
+				Author:    &discordgo.User{ID: strconv.Itoa((size - 1) % 100)},
+				Content:   scamMessage,
+				Timestamp: now,
+			}}
+
+			for b.Loop() {
+				Run(m, m.ID, Author{}, logs, rules)
+			}
+		})
+	}
+}
@@ -4,52 +4,163 @@
 package antispam
 
 import (
-	"regexp"
+	"fmt"
+	"slices"
 	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type RuleMode string
+
+const (
+	ModeEnforce RuleMode = "enforce" // Apply the rule actions (default).
+	ModeShadow  RuleMode = "shadow"  // Only report matches, taking no action.
 )
 
+func (m *RuleMode) UnmarshalYAML(node *yaml.Node) error {
+	switch mode := RuleMode(node.Value); mode {
+	case ModeEnforce, ModeShadow:
+		*m = mode
+	default:
+		return fmt.Errorf("antispam: unknown rule mode %q", node.Value)
+	}
+
+	return nil
+}
+
 type HeuristicRule struct {
-	ID         string `yaml:"id"`
-	Duplicated bool   `yaml:"duplicated"`
+	ID         string   `yaml:"id"`
+	Mode       RuleMode `yaml:"mode"`
+	Duplicated bool     `yaml:"duplicated"`
 	Thresholds struct {
-		Messages int           `yaml:"messages"`
-		Channels int           `yaml:"channels"`
-		Mentions int           `yaml:"mentions"`
-		Window   time.Duration `yaml:"window"`
+		Messages int `yaml:"messages"`
+		Channels int `yaml:"channels"`
+		Mentions int `yaml:"mentions"`
+		// Distinct accounts posting the same (or, given a similarity,
+		// near-same) content, making the rule look at the messages of
+		// every member rather than just the author.
+		Authors int           `yaml:"authors"`
+		Window  time.Duration `yaml:"window"`
 	} `yaml:"thresholds"`
-	Timeout time.Duration `yaml:"timeout"`
+	// Messages with content at least this similar (0-1) to the triggering
+	// message are counted as duplicates by duplicated rules, rather than
+	// only identical ones.
+	Similarity float64       `yaml:"similarity"`
+	Channels   ChannelScope  `yaml:"channels"`
+	Conditions Conditions    `yaml:"conditions"`
+	Content    Content       `yaml:"content"`
+	Timeout    time.Duration `yaml:"timeout"`
+	Actions    []Action      `yaml:"actions"`
+	Escalation Escalation    `yaml:"escalation"`
 }
 
+// Channels or categories a rule is limited to, or exempted from.  The
+// most specific entry wins, so a channel may be excluded from an included
+// category, or included despite its category being excluded.  A rule
+// without any included channels applies everywhere not excluded.
+type ChannelScope struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Allows reports whether a message with the scope (see Log.Scope) falls
+// within the channels.
+func (c *ChannelScope) Allows(scope []string) bool {
+	for _, id := range scope {
+		if slices.Contains(c.Exclude, id) {
+			return false
+		}
+
+		if slices.Contains(c.Include, id) {
+			return true
+		}
+	}
+
+	return len(c.Include) == 0
+}
+
+// Content shorter than this (as fingerprinted, see Log.Length) is too
+// common to be taken for coordinated spam, e.g., several members greeting
+// one another, unless the rule matches on content too.
+const minCoordinatedLength int = 16
+
+// Coordinated rules look for the same content posted by several
+// accounts, e.g., a raid of fresh accounts each posting an invite once.
+func (r *HeuristicRule) Coordinated() bool { return r.Thresholds.Authors > 0 }
+
+// Shadow rules are evaluated and reported like any other, but never
+// have their actions applied.
+func (r *HeuristicRule) Shadow() bool { return r.Mode == ModeShadow }
+
+// Match of a heuristic rule against the logged messages.
+type Match struct {
+	Rule *HeuristicRule
+	Logs []*Log
+}
+
+// Enforced returns the first match of a rule that is not in shadow mode,
+// rules being listed in order of priority, or nil if there is none.
+func Enforced(matches []Match) *Match {
+	for idx := range matches {
+		if !matches[idx].Rule.Shadow() {
+			return &matches[idx]
+		}
+	}
+
+	return nil
+}
+
+// Evaluate the rules against the logs of the author, or, for coordinated
+// rules, the logs of every member.
 func evaluate(
-	hash string,
+	current *Log,
+	author Author,
 	logs []*Log,
+	all []*Log,
 	rules []HeuristicRule,
-) ([]*Log, *HeuristicRule) {
+) []Match {
 	var (
-		matchRule *HeuristicRule
-		matchLogs []*Log
+		matches   []Match
 		timestamp = time.Now().UTC()
 	)
 
-	for _, rule := range rules {
-		results := evaluateRule(hash, logs, rule, timestamp)
-		if len(results) > 0 {
-			matchLogs = results
-			matchRule = &rule
+	for idx := range rules {
+		if !rules[idx].Conditions.Match(author, timestamp) {
+			continue
+		}
+
+		target := logs
+		if rules[idx].Coordinated() {
+			target = all
+		}
 
-			break
+		results := evaluateRule(current, target, rules[idx], timestamp)
+		if len(results) > 0 {
+			matches = append(matches, Match{Rule: &rules[idx], Logs: results})
 		}
 	}
 
-	return matchLogs, matchRule
+	return matches
 }
 
 func evaluateRule(
-	hash string,
+	current *Log,
 	logs []*Log,
 	rule HeuristicRule,
 	timestamp time.Time,
 ) []*Log {
+	// Messages sent outside of the channels the rule applies to neither
+	// trigger the rule nor count towards it.
+	if !rule.Channels.Allows(current.Scope()) {
+		return nil
+	}
+
+	if rule.Coordinated() && rule.Content.Empty() &&
+		current.Length() < minCoordinatedLength {
+		return nil
+	}
+
 	target := make([]*Log, 0, len(logs))
 
 	for idx := range logs {
@@ -58,15 +169,24 @@ func evaluateRule(
 			continue
 		}
 
+		if !rule.Channels.Allows(log.Scope()) {
+			continue
+		}
+		// Only members meeting the conditions of the rule take part, as
+		// the actions are applied to each of them.
+		if rule.Coordinated() && !rule.Conditions.Match(log.Author(), timestamp) {
+			continue
+		}
+
 		target = append(target, log)
 	}
 
-	if rule.Duplicated {
+	if rule.Duplicated || rule.Coordinated() {
 		var dupe []*Log
 
 		for idx := range target {
 			log := target[idx]
-			if log.Hash == hash {
+			if log.Duplicate(current, rule.Similarity) {
 				dupe = append(dupe, log)
 			}
 		}
@@ -74,10 +194,36 @@ func evaluateRule(
 		target = dupe
 	}
 
+	if !rule.Content.Empty() {
+		var matched []*Log
+
+		for idx := range target {
+			log := target[idx]
+			if rule.Content.Match(log) {
+				matched = append(matched, log)
+			}
+		}
+
+		target = matched
+	}
+
 	if rule.Thresholds.Messages > 0 && len(target) < rule.Thresholds.Messages {
 		return nil
 	}
 
+	if rule.Coordinated() {
+		authors := make(map[string]struct{})
+
+		for idx := range target {
+			log := target[idx]
+			authors[log.Message.Author.ID] = struct{}{}
+		}
+
+		if len(authors) < rule.Thresholds.Authors {
+			return nil
+		}
+	}
+
 	if rule.Thresholds.Channels > 0 {
 		channels := make(map[string]struct{})
 
@@ -94,13 +240,11 @@ func evaluateRule(
 	if rule.Thresholds.Mentions > 0 {
 		var matched bool
 
-		re := regexp.MustCompile(`<@!?(\d+)>`)
-
 		for idx := range target {
 			log := target[idx]
 
 			mentions := len(
-				re.FindAllStringSubmatch(log.Message.Content, -1),
+				mentionRegex.FindAllStringSubmatch(log.Message.Content, -1),
 			)
 
 			if mentions >= rule.Thresholds.Mentions {
@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/yaml.v3"
+)
+
+// Similarity of names at which one is taken to impersonate the other,
+// unless configured otherwise.
+const defaultNameSimilarity float64 = 0.85
+
+// Names shorter than this (once reduced to their skeleton) are too
+// common to tell impersonation apart from coincidence, e.g., "ed".
+const minNameLength int = 4
+
+// ImpersonationRule is the rule that impersonation offences are recorded
+// under.  They are not counted towards the escalation of heuristic rules
+// (see Offences.Count), being about the name of a member rather than
+// their messages.
+const ImpersonationRule string = "IMPERSONATION"
+
+// ImpersonationSettings of the checks made of the names and avatars of
+// members upon joining, or changing them, against the configured
+// protected names and the members holding any of the staff roles.
+type ImpersonationSettings struct {
+	ProtectedNames []string `yaml:"protected_names"`
+	StaffRoleIDs   []string `yaml:"staff_role_ids"`
+	// Names at least this similar (0-1) to a protected or staff name are
+	// taken to impersonate it, 0.85 unless given.
+	Similarity float64 `yaml:"similarity"`
+	// Whether members with the same avatar as a staff member (as far as
+	// Discord's avatar hash goes) are taken to impersonate them.
+	Avatars bool `yaml:"avatars"`
+	// Actions applied to impersonators, besides alerting moderators.
+	Actions []Action `yaml:"actions"`
+}
+
+func (s *ImpersonationSettings) UnmarshalYAML(node *yaml.Node) error {
+	type plain ImpersonationSettings
+
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+
+	if s.Similarity < 0 || s.Similarity > 1 {
+		return fmt.Errorf("antispam: impersonation similarity must be within 0-1, got %g", s.Similarity)
+	}
+
+	for idx := range s.Actions {
+		switch s.Actions[idx].Type {
+		case ActionDelete:
+			return errors.New("antispam: impersonation actions cannot delete messages")
+		case ActionTimeout:
+			if s.Actions[idx].Duration == 0 {
+				return errors.New("antispam: impersonation timeout action requires a duration")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *ImpersonationSettings) Enabled() bool {
+	return len(s.ProtectedNames) > 0 || len(s.StaffRoleIDs) > 0
+}
+
+// Identity of a member, being the names they go by and their avatars.
+type Identity struct {
+	UserID  string
+	Names   []string
+	Avatars []string
+}
+
+func NewIdentity(member *discordgo.Member) Identity {
+	identity := Identity{UserID: member.User.ID}
+
+	for _, name := range []string{
+		member.User.Username,
+		member.User.GlobalName,
+		member.Nick,
+	} {
+		if name != "" && !slices.Contains(identity.Names, name) {
+			identity.Names = append(identity.Names, name)
+		}
+	}
+
+	for _, avatar := range []string{member.User.Avatar, member.Avatar} {
+		if avatar != "" {
+			identity.Avatars = append(identity.Avatars, avatar)
+		}
+	}
+
+	return identity
+}
+
+// Impersonation of a protected name or staff member by a member.
+type Impersonation struct {
+	// Name of the member, or their avatar.
+	Name string
+	// Protected name or name of the staff member impersonated.
+	Target string
+	// Staff member impersonated, if any.
+	UserID     string
+	Avatar     bool
+	Similarity float64
+}
+
+func (i *Impersonation) String() string {
+	target := i.Target
+	if i.UserID != "" {
+		target = fmt.Sprintf("<@%s>", i.UserID)
+	}
+
+	if i.Avatar {
+		return "Avatar of " + target
+	}
+
+	return fmt.Sprintf("%q resembles %s (%.0f%%)", i.Name, target, i.Similarity*100)
+}
+
+// Characters names tend to have swapped for others alike, on top of the
+// folding of lookalike characters: digits and symbols, and uppercase I
+// for lowercase L.
+var nameFolds = map[rune]rune{
+	'0': 'o', '1': 'l', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '|': 'l', '!': 'l', 'i': 'l',
+}
+
+// Name reduced to the letters and digits it resembles, such that names
+// rendering much the same (e.g., "FreeBSD Mod", "freebsd_m0d" and
+// "FrееBSD Mоd" in Cyrillic) share the same skeleton.
+func nameSkeleton(name string) string {
+	return sequences.Replace(strings.Map(func(r rune) rune {
+		if folded, ok := nameFolds[r]; ok {
+			return folded
+		}
+
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+
+		return r
+	}, Normalise(name)))
+}
+
+// Similarity of two names, from 0 (nothing in common) to 1 (rendering
+// the same), by the edit distance between their skeletons.  Protected
+// names contained in the name count as rendering the same, e.g.,
+// "Official FreeBSD Mod" for "FreeBSD Mod".
+func nameSimilarity(name, target string, contains bool) float64 {
+	length := max(len([]rune(name)), len([]rune(target)))
+	if min(len([]rune(name)), len([]rune(target))) < minNameLength {
+		return 0
+	}
+
+	if contains && strings.Contains(name, target) {
+		return 1
+	}
+
+	return 1 - float64(Distance(name, target))/float64(length)
+}
+
+// Impersonates returns the closest impersonation by the member of any of
+// the protected names or staff members, or nil if there is none.  Staff
+// members are never taken to impersonate each other, nor themselves.
+func (s *ImpersonationSettings) Impersonates(member Identity, staff []Identity) *Impersonation {
+	if slices.ContainsFunc(staff, func(i Identity) bool { return i.UserID == member.UserID }) {
+		return nil
+	}
+
+	var (
+		closest   *Impersonation
+		threshold = s.Similarity
+	)
+
+	if threshold == 0 {
+		threshold = defaultNameSimilarity
+	}
+
+	check := func(name, target, userID string, contains bool) {
+		similarity := nameSimilarity(nameSkeleton(name), nameSkeleton(target), contains)
+		if similarity >= threshold &&
+			(closest == nil || similarity > closest.Similarity) {
+			closest = &Impersonation{
+				Name:       name,
+				Target:     target,
+				UserID:     userID,
+				Similarity: similarity,
+			}
+		}
+	}
+
+	for _, name := range member.Names {
+		for _, target := range s.ProtectedNames {
+			check(name, target, "", true)
+		}
+
+		for idx := range staff {
+			for _, target := range staff[idx].Names {
+				check(name, target, staff[idx].UserID, false)
+			}
+		}
+	}
+
+	if !s.Avatars {
+		return closest
+	}
+	// A copied avatar is the strongest sign of all, so takes precedence.
+	for _, avatar := range member.Avatars {
+		for idx := range staff {
+			if slices.Contains(staff[idx].Avatars, avatar) && len(staff[idx].Names) > 0 {
+				return &Impersonation{
+					Name:       avatar,
+					Target:     staff[idx].Names[0],
+					UserID:     staff[idx].UserID,
+					Avatar:     true,
+					Similarity: 1,
+				}
+			}
+		}
+	}
+
+	return closest
+}
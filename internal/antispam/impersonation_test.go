@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestImpersonates(t *testing.T) {
+	var (
+		settings = ImpersonationSettings{
+			ProtectedNames: []string{"FreeBSD Mod", "FreeBSD Admin"},
+			Avatars:        true,
+		}
+		staff = []Identity{
+			{UserID: "1", Names: []string{"lcook", "Lewis Cook"}, Avatars: []string{"a1b2c3"}},
+			{UserID: "2", Names: []string{"ed"}},
+		}
+	)
+
+	tests := []struct {
+		name   string
+		member Identity
+		target string
+		avatar bool
+	}{
+		{"Protected", Identity{UserID: "10", Names: []string{"freebsd_mod"}}, "FreeBSD Mod", false},
+		{"ProtectedLeet", Identity{UserID: "10", Names: []string{"FreeBSD M0d"}}, "FreeBSD Mod", false},
+		{"ProtectedConfusable", Identity{UserID: "10", Names: []string{"Frее\u200bBSD Аdmin"}}, "FreeBSD Admin", false},
+		{"ProtectedContained", Identity{UserID: "10", Names: []string{"Official FreeBSD Admin Team"}}, "FreeBSD Admin", false},
+		{"Staff", Identity{UserID: "10", Names: []string{"Lewis Cook."}}, "Lewis Cook", false},
+		{"StaffTypo", Identity{UserID: "10", Names: []string{"joe", "Lewls Coook"}}, "Lewis Cook", false},
+		{"StaffUppercaseI", Identity{UserID: "10", Names: []string{"Icook"}}, "lcook", false},
+		{"Avatar", Identity{UserID: "10", Names: []string{"someone"}, Avatars: []string{"a1b2c3"}}, "lcook", true},
+		{"Unrelated", Identity{UserID: "10", Names: []string{"FreeBSD fan"}}, "", false},
+		{"ShortName", Identity{UserID: "10", Names: []string{"ed"}}, "", false},
+		{"StaffThemselves", Identity{UserID: "1", Names: []string{"lcook"}, Avatars: []string{"a1b2c3"}}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			impersonation := settings.Impersonates(tt.member, staff)
+			if tt.target == "" {
+				if impersonation != nil {
+					t.Errorf("expected no impersonation, got %s", impersonation.String())
+				}
+
+				return
+			}
+
+			if impersonation == nil {
+				t.Fatalf("expected impersonation of %q, got none", tt.target)
+			}
+
+			if impersonation.Target != tt.target || impersonation.Avatar != tt.avatar {
+				t.Errorf("expected impersonation of %q (avatar %t), got %+v", tt.target, tt.avatar, impersonation)
+			}
+		})
+	}
+}
+
+func TestImpersonationSettings(t *testing.T) {
+	for _, config := range []string{
+		"similarity: 1.5",
+		"actions: [delete]",
+		"actions: [timeout]",
+	} {
+		var settings ImpersonationSettings
+		if err := yaml.Unmarshal([]byte(config), &settings); err == nil {
+			t.Errorf("expected %q to be rejected", config)
+		}
+	}
+
+	var settings ImpersonationSettings
+	if err := yaml.Unmarshal([]byte("actions: [{type: timeout, duration: 1h}, kick]"), &settings); err != nil {
+		t.Errorf("expected actions to be accepted, got %v", err)
+	}
+}
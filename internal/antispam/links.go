@@ -0,0 +1,468 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type LinkVerdict string
+
+const (
+	LinkAllowed   LinkVerdict = "allowed"   // Host (or a parent domain) is allowlisted.
+	LinkBlocked   LinkVerdict = "blocked"   // Host (or a parent domain) is blocklisted.
+	LinkLookalike LinkVerdict = "lookalike" // Host impersonates one of the protected domains.
+)
+
+// Domains commonly impersonated by phishing links.  Hosts rendering the
+// same as, or within a couple of characters of, one of these are treated
+// as lookalikes unless they are the genuine article.
+var protectedDomains = []string{
+	"discord.com",
+	"discord.gg",
+	"discord.gift",
+	"discordapp.com",
+	"steamcommunity.com",
+	"steampowered.com",
+}
+
+// Masked links, i.e., `[text](url)`, where both the text and target may
+// hold a URL.
+var markdownLinkRegex = regexp.MustCompile(`\[([^\]]*)\]\(\s*<?([^)\s>]+)>?\s*\)`)
+
+// URLs found in the message content, masked links and embeds.
+func extractURLs(message *discordgo.Message) []string {
+	var (
+		urls []string
+		seen = make(map[string]struct{})
+	)
+
+	add := func(text string) {
+		for _, match := range urlRegex.FindAllString(text, -1) {
+			if _, ok := seen[match]; !ok {
+				seen[match] = struct{}{}
+				urls = append(urls, match)
+			}
+		}
+	}
+
+	add(message.Content)
+
+	for _, match := range markdownLinkRegex.FindAllStringSubmatch(message.Content, -1) {
+		add(match[1])
+		add(match[2])
+	}
+
+	for _, embed := range message.Embeds {
+		add(embed.URL)
+		add(embed.Title)
+		add(embed.Description)
+
+		if embed.Author != nil {
+			add(embed.Author.URL)
+		}
+
+		for _, field := range embed.Fields {
+			add(field.Value)
+		}
+	}
+
+	return urls
+}
+
+// Normalised hosts of the URLs found in the message.
+func extractHosts(message *discordgo.Message) []string {
+	var hosts []string
+
+	for _, match := range extractURLs(message) {
+		u, err := url.Parse(match)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+
+		if host := normaliseHost(u.Hostname()); !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+func normaliseHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimSuffix(host, ".")
+	host = decodeHost(host)
+
+	return strings.TrimPrefix(host, "www.")
+}
+
+// Sequences of letters rendering much like a single letter in most
+// fonts, e.g., discorcl.com.
+var sequences = strings.NewReplacer("rn", "m", "cl", "d", "vv", "w")
+
+// Host folded to the ASCII characters it resembles.
+func skeleton(host string) string {
+	return sequences.Replace(strings.Map(func(r rune) rune {
+		if invisible(r) {
+			return -1
+		}
+
+		return fold(r)
+	}, host))
+}
+
+// Whether the host is, or is a subdomain of, the domain.
+func withinDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// Last two labels of the host, which is near enough the registered
+// domain for the purpose of spotting lookalikes.
+func registered(host string) string {
+	labels := strings.Split(host, ".")
+	if len(labels) <= 2 {
+		return host
+	}
+
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// Whether the host impersonates one of the protected domains, either by
+// rendering the same using lookalike characters, embedding the domain as
+// a prefix (e.g., discord.com.example.net), or being a small number of
+// edits away from it.
+func lookalike(host string) bool {
+	for _, domain := range protectedDomains {
+		if withinDomain(host, domain) {
+			return false
+		}
+	}
+
+	var (
+		folded = skeleton(host)
+		base   = registered(folded)
+	)
+
+	for _, domain := range protectedDomains {
+		if withinDomain(folded, domain) ||
+			strings.HasPrefix(folded, domain+".") ||
+			strings.Contains(folded, "."+domain+".") {
+			return true
+		}
+
+		threshold := 1
+		if len(domain) >= 14 {
+			threshold = 2
+		}
+
+		if Distance(base, domain) <= threshold {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LinkList is a list of blocked and allowed domains kept in a plain text
+// file, one domain per line, optionally prefixed with `block` (default)
+// or `allow`.  Lines starting with `#` are comments.  For example:
+//
+//	# Known phishing domains.
+//	steamcommunlty.com
+//	block discord-gifts.org
+//	allow discord.media
+//
+// Entries apply to the domain and all of its subdomains, with the most
+// specific entry winning.  Changes made to the file, whether by hand or
+// through Update in another process, are picked up on the next check,
+// and Update leaves comments in place.
+type LinkList struct {
+	path string
+
+	mu      sync.RWMutex
+	blocked map[string]struct{}
+	allowed map[string]struct{}
+	size    int64
+	modTime time.Time
+}
+
+func OpenLinkList(path string) (*LinkList, error) {
+	l := &LinkList{
+		path:    path,
+		blocked: make(map[string]struct{}),
+		allowed: make(map[string]struct{}),
+	}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *LinkList) Path() string { return l.path }
+
+// Len returns the number of blocked and allowed domains.
+func (l *LinkList) Len() (int, int) {
+	l.refresh()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.blocked), len(l.allowed)
+}
+
+// Verdict on the (normalised) host.  Hosts neither listed nor lookalikes
+// of protected domains have an empty verdict.  A nil list only checks for
+// lookalikes.
+func (l *LinkList) Verdict(host string) LinkVerdict {
+	if l != nil {
+		l.refresh()
+
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+
+		for domain := host; domain != ""; {
+			if _, ok := l.allowed[domain]; ok {
+				return LinkAllowed
+			}
+
+			if _, ok := l.blocked[domain]; ok {
+				return LinkBlocked
+			}
+
+			_, parent, found := strings.Cut(domain, ".")
+			if !found {
+				break
+			}
+
+			domain = parent
+		}
+	}
+
+	if lookalike(host) {
+		return LinkLookalike
+	}
+
+	return ""
+}
+
+// Update the list, blocking and allowing the given domains and removing
+// any entries for others, then write it back to disk.
+func (l *LinkList) Update(block, allow, remove []string) error {
+	l.refresh()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, domain := range remove {
+		domain = normaliseHost(domain)
+		delete(l.blocked, domain)
+		delete(l.allowed, domain)
+	}
+
+	for _, domain := range block {
+		if domain = normaliseHost(domain); domain != "" {
+			delete(l.allowed, domain)
+			l.blocked[domain] = struct{}{}
+		}
+	}
+
+	for _, domain := range allow {
+		if domain = normaliseHost(domain); domain != "" {
+			delete(l.blocked, domain)
+			l.allowed[domain] = struct{}{}
+		}
+	}
+
+	return l.write()
+}
+
+// Write the list beside the current file and rename it into place, so
+// that readers never observe a partially written list.  Comments, and
+// entries left as they are, are kept where they were in the file, with
+// new entries appended to it.
+func (l *LinkList) write() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o750); err != nil {
+		return err
+	}
+
+	current, err := os.ReadFile(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var (
+		writer  = bufio.NewWriter(tmp)
+		written = make(map[string]struct{})
+	)
+
+	for line := range strings.Lines(string(current)) {
+		domain, allow, err := parseLinkEntry(line)
+		if err != nil {
+			continue
+		}
+
+		if domain != "" {
+			entries := l.blocked
+			if allow {
+				entries = l.allowed
+			}
+
+			if _, ok := entries[domain]; !ok {
+				continue
+			}
+
+			if _, ok := written[domain]; ok {
+				continue
+			}
+
+			written[domain] = struct{}{}
+		}
+
+		writer.WriteString(strings.TrimSuffix(line, "\n") + "\n")
+	}
+
+	for _, domain := range slices.Sorted(maps.Keys(l.blocked)) {
+		if _, ok := written[domain]; !ok {
+			fmt.Fprintf(writer, "block %s\n", domain)
+		}
+	}
+
+	for _, domain := range slices.Sorted(maps.Keys(l.allowed)) {
+		if _, ok := written[domain]; !ok {
+			fmt.Fprintf(writer, "allow %s\n", domain)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+
+	l.size, l.modTime = info.Size(), info.ModTime()
+
+	return nil
+}
+
+// Domain of the entry on the line, and whether it is allowed rather than
+// blocked.  Blank lines and comments have no domain.
+func parseLinkEntry(line string) (string, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", false, nil
+	}
+
+	var allow bool
+
+	if kind, domain, found := strings.Cut(line, " "); found {
+		switch kind {
+		case "allow":
+			allow = true
+		case "block":
+		default:
+			return "", false, fmt.Errorf("antispam: invalid link list entry %q", line)
+		}
+
+		line = domain
+	}
+
+	return normaliseHost(line), allow, nil
+}
+
+func (l *LinkList) refresh() {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return
+	}
+
+	l.mu.RLock()
+	changed := info.Size() != l.size || !info.ModTime().Equal(l.modTime)
+	l.mu.RUnlock()
+
+	if changed {
+		l.load()
+	}
+}
+
+func (l *LinkList) load() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var (
+		blocked = make(map[string]struct{})
+		allowed = make(map[string]struct{})
+		scanner = bufio.NewScanner(file)
+	)
+
+	for scanner.Scan() {
+		domain, allow, err := parseLinkEntry(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%w in %s", err, l.path)
+		}
+
+		if domain == "" {
+			continue
+		}
+
+		if allow {
+			allowed[domain] = struct{}{}
+		} else {
+			blocked[domain] = struct{}{}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	l.blocked, l.allowed = blocked, allowed
+	l.size, l.modTime = info.Size(), info.ModTime()
+
+	return nil
+}
@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDecodeHost(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+	}{
+		{"example.com", "example.com"},
+		{"xn--mnchen-3ya.de", "münchen.de"},
+		{"xn--80ak6aa92e.com", "аррӏе.com"},
+		{"xn--dscord-pvf.com", "dіscord.com"},
+		{"xn--a-ecp!.com", "xn--a-ecp!.com"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.input, func(t *testing.T) {
+			if actual := decodeHost(tc.input); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExtractHosts(t *testing.T) {
+	message := &discordgo.Message{
+		Content: "see <https://WWW.Example.com/a> and [https://discord.com](https://xn--dscord-pvf.com/gift) " +
+			"or https://example.com/b",
+		Embeds: []*discordgo.MessageEmbed{
+			{URL: "https://embed.example.net/", Description: "http://example.org."},
+		},
+	}
+
+	expected := []string{
+		"example.com",
+		"discord.com",
+		"dіscord.com",
+		"embed.example.net",
+		"example.org",
+	}
+
+	if actual := extractHosts(message); !slices.Equal(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestLookalike(t *testing.T) {
+	tt := []struct {
+		host     string
+		expected bool
+	}{
+		{"discord.com", false},
+		{"cdn.discordapp.com", false},
+		{"steamcommunity.com", false},
+		{"example.com", false},
+		{"discord.dev", false},
+		{"dіscord.com", true},
+		{"steamcommunlty.com", true},
+		{"steamcomnunity.ru", false},
+		{"stearncommunity.com", true},
+		{"discord.com.example.net", true},
+		{"gift.discorcl.com", true},
+		{"ｄiscord.gg", true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.host, func(t *testing.T) {
+			if actual := lookalike(tc.host); actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLinkList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.txt")
+
+	err := os.WriteFile(path, []byte(
+		"# Phishing domains.\nexample.com\nblock example.net\nallow safe.example.net\n",
+	), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := OpenLinkList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		host     string
+		expected LinkVerdict
+	}{
+		{"example.com", LinkBlocked},
+		{"sub.example.com", LinkBlocked},
+		{"example.net", LinkBlocked},
+		{"safe.example.net", LinkAllowed},
+		{"a.safe.example.net", LinkAllowed},
+		{"example.org", ""},
+		{"steamcommunlty.com", LinkLookalike},
+	}
+	for _, tc := range tt {
+		if actual := list.Verdict(tc.host); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.host, tc.expected, actual)
+		}
+	}
+
+	// A second handle, such as one held by another process, picks up the
+	// changes made through the first.
+	other, err := OpenLinkList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := list.Update(
+		[]string{"Example.ORG."},
+		[]string{"steamcommunlty.com"},
+		[]string{"example.com"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	// Modification times may be too coarse to tell the writes apart, the
+	// size of the file changing aside.
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+
+	tt = []struct {
+		host     string
+		expected LinkVerdict
+	}{
+		{"example.com", ""},
+		{"example.org", LinkBlocked},
+		{"steamcommunlty.com", LinkAllowed},
+	}
+	for _, tc := range tt {
+		if actual := other.Verdict(tc.host); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.host, tc.expected, actual)
+		}
+	}
+
+	// Comments and entries left alone stay where they were.
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# Phishing domains.\nblock example.net\nallow safe.example.net\n" +
+		"block example.org\nallow steamcommunlty.com\n"
+	if string(contents) != expected {
+		t.Errorf("expected list to be\n%s\ngot\n%s", expected, contents)
+	}
+
+	var nilList *LinkList
+	if actual := nilList.Verdict("dіscord.com"); actual != LinkLookalike {
+		t.Errorf("expected %q from nil list, got %q", LinkLookalike, actual)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tt := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"discord", "", 7},
+		{"discord", "discord", 0},
+		{"discord", "dicsord", 2},
+		{"kitten", "sitting", 3},
+		{"dіscord", "discord", 1},
+	}
+	for _, tc := range tt {
+		if actual := Distance(tc.a, tc.b); actual != tc.expected {
+			t.Errorf("%q/%q: expected %d, got %d", tc.a, tc.b, tc.expected, actual)
+		}
+	}
+}
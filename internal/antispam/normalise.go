@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Characters commonly used to visually impersonate ASCII letters and
+// digits, folded to the character they resemble.  Not exhaustive, but
+// covers the usual suspects seen in scam messages: Cyrillic, Greek and
+// a handful of Latin extensions.
+var confusables = map[rune]rune{
+	// Cyrillic.
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's',
+	'і': 'i', 'ї': 'i', 'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'һ': 'h',
+	'ո': 'n', 'ս': 'u', 'ց': 'g', 'ɡ': 'g', 'ӏ': 'l', 'г': 'r',
+	// Greek.
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w', 'ϲ': 'c',
+	// Latin extensions and symbols.
+	'ı': 'i', 'ł': 'l', 'ƚ': 'l', 'ø': 'o', 'đ': 'd', 'ħ': 'h', 'ŀ': 'l',
+	'ɑ': 'a', 'ɩ': 'i', 'ʀ': 'r', 'ᴅ': 'd', 'ᴇ': 'e', 'ɴ': 'n', 'ᴏ': 'o',
+	'ᴛ': 't', 'ᴜ': 'u', 'ᴠ': 'v', 'ᴡ': 'w', 'ᴢ': 'z',
+	'ℓ': 'l', '℮': 'e', 'ⅰ': 'i', 'ⅼ': 'l', 'ⅽ': 'c', 'ⅾ': 'd', 'ⅿ': 'm',
+}
+
+// Whether the character renders as nothing at all, used to split up
+// words so that they evade plain substring matching.
+func invisible(r rune) bool {
+	switch r {
+	case '\u00AD', '\u034F', '\u061C', '\u115F', '\u1160', '\u17B4',
+		'\u17B5', '\u180E', '\u3164', '\uFEFF', '\uFFA0':
+		return true
+	}
+
+	return (r >= '\u200B' && r <= '\u200F') ||
+		(r >= '\u202A' && r <= '\u202E') ||
+		(r >= '\u2060' && r <= '\u206F') ||
+		(r >= '\uFE00' && r <= '\uFE0F')
+}
+
+// Fold a character to the ASCII character it resembles, if any.
+func fold(r rune) rune {
+	switch {
+	// Fullwidth forms of the printable ASCII range.
+	case r >= '\uFF01' && r <= '\uFF5E':
+		return r - '\uFF01' + '!'
+	// Mathematical alphanumeric symbols, e.g., bold or script letters,
+	// repeat the Latin alphabet in blocks of 52 (A-Z then a-z).
+	case r >= '\U0001D400' && r <= '\U0001D6A3':
+		offset := (r - '\U0001D400') % 52
+		if offset < 26 {
+			return 'a' + offset
+		}
+
+		return 'a' + offset - 26
+	// Mathematical digits, repeated in blocks of 10.
+	case r >= '\U0001D7CE' && r <= '\U0001D7FF':
+		return '0' + (r-'\U0001D7CE')%10
+	// Circled letters.
+	case r >= '\u24B6' && r <= '\u24CF':
+		return 'a' + r - '\u24B6'
+	case r >= '\u24D0' && r <= '\u24E9':
+		return 'a' + r - '\u24D0'
+	}
+
+	if folded, ok := confusables[r]; ok {
+		return folded
+	}
+
+	return r
+}
+
+// Normalise content prior to matching it against keywords: characters
+// are lowercased and folded to the ASCII character they resemble,
+// invisible characters are dropped and runs of whitespace collapsed.
+func Normalise(content string) string {
+	var (
+		builder strings.Builder
+		space   bool
+	)
+
+	builder.Grow(len(content))
+
+	for _, r := range content {
+		if invisible(r) {
+			continue
+		}
+
+		if unicode.IsSpace(r) {
+			space = builder.Len() > 0
+			continue
+		}
+
+		if space {
+			builder.WriteByte(' ')
+
+			space = false
+		}
+
+		builder.WriteRune(fold(unicode.ToLower(r)))
+	}
+
+	return builder.String()
+}
+
+// Distance between two strings, being the number of single character
+// insertions, deletions or substitutions needed to turn one into the
+// other (Levenshtein distance).
+func Distance(a, b string) int {
+	var (
+		source = []rune(a)
+		target = []rune(b)
+		prev   = make([]int, len(target)+1)
+		curr   = make([]int, len(target)+1)
+	)
+
+	for idx := range prev {
+		prev[idx] = idx
+	}
+
+	for i := range source {
+		curr[0] = i + 1
+
+		for j := range target {
+			cost := 1
+			if source[i] == target[j] {
+				cost = 0
+			}
+
+			curr[j+1] = min(prev[j+1]+1, curr[j]+1, prev[j]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(target)]
+}
@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import "testing"
+
+func TestNormalise(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Case", "FREE Nitro", "free nitro"},
+		{"Whitespace", "  free \n\t nitro  ", "free nitro"},
+		{"Invisible", "fr\u200bee n\u2060itro\ufeff", "free nitro"},
+		{"Fullwidth", "ＦＲＥＥ", "free"},
+		{"Confusables", "ѕтеаm", "steam"},
+		{"Mathematical", "\U0001D41F\U0001D42B\U0001D41E\U0001D41E", "free"},
+		{"Circled", "ⓕⓡⓔⓔ", "free"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := Normalise(tc.input); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
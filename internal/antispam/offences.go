@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lcook/pulsar/internal/store"
+)
+
+// Offence of a member triggering an enforced heuristic rule, along with
+// the actions applied.
+type Offence struct {
+	UserID  string    `json:"user_id"`
+	Rule    string    `json:"rule"`
+	Time    time.Time `json:"time"`
+	Actions []string  `json:"actions"`
+}
+
+func (o *Offence) key() string {
+	return fmt.Sprintf("%s:%d", o.UserID, o.Time.UnixNano())
+}
+
+func (o *Offence) String() string {
+	return fmt.Sprintf(
+		"<t:%d:f> %s: %s",
+		o.Time.Unix(),
+		strings.ToLower(o.Rule),
+		strings.Join(o.Actions, ", "),
+	)
+}
+
+// Offences is the history of offences of every member, used to escalate
+// the actions applied to repeat offenders.  The history is kept in a
+// store when given a path, and otherwise in memory for as long as the
+// bot runs.
+type Offences struct {
+	store *store.Store[Offence]
+
+	mu     sync.Mutex
+	memory []Offence
+}
+
+func OpenOffences(path string) (*Offences, error) {
+	if path == "" {
+		return &Offences{}, nil
+	}
+
+	history, err := store.Open[Offence](path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Offences{store: history}, nil
+}
+
+// OpenOffencesReadOnly opens the history at path for reading only, e.g.,
+// to show the offences of a member, leaving it to the antispam handler to
+// record them.
+func OpenOffencesReadOnly(path string) (*Offences, error) {
+	history, err := store.OpenReadOnly[Offence](path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Offences{store: history}, nil
+}
+
+func (o *Offences) Add(offence Offence) error {
+	if o.store != nil {
+		return o.store.Put(offence.key(), offence)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.memory = append(o.memory, offence)
+
+	return nil
+}
+
+// Remove the offence from the history, e.g., when found to be a false
+// positive, so that it no longer counts towards escalation.
+func (o *Offences) Remove(offence Offence) error {
+	if o.store != nil {
+		return o.store.Delete(offence.key())
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.memory = slices.DeleteFunc(o.memory, func(other Offence) bool {
+		return other.key() == offence.key()
+	})
+
+	return nil
+}
+
+// History of offences of the member, oldest first.
+func (o *Offences) History(userID string) []Offence {
+	var history []Offence
+
+	if o.store != nil {
+		o.store.Range(func(_ string, offence Offence) bool {
+			if offence.UserID == userID {
+				history = append(history, offence)
+			}
+
+			return true
+		})
+	} else {
+		o.mu.Lock()
+		for _, offence := range o.memory {
+			if offence.UserID == userID {
+				history = append(history, offence)
+			}
+		}
+		o.mu.Unlock()
+	}
+
+	slices.SortFunc(history, func(a, b Offence) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return history
+}
+
+// Count returns the number of offences of the member within the window
+// preceding now, or ever if the window is zero, used to escalate the
+// actions of heuristic rules.  Impersonation offences are left out.
+func (o *Offences) Count(userID string, window time.Duration, now time.Time) int {
+	var count int
+
+	for _, offence := range o.History(userID) {
+		if offence.Rule == ImpersonationRule {
+			continue
+		}
+
+		if window == 0 || now.Sub(offence.Time) < window {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Summarise the most recent offences of the history, newest first and
+// one per line, noting how many older offences were left out.
+func Summarise(history []Offence, limit int) string {
+	var (
+		lines   = make([]string, 0, min(len(history), limit)+1)
+		omitted = max(len(history)-limit, 0)
+	)
+
+	for idx := len(history) - 1; idx >= omitted; idx-- {
+		lines = append(lines, history[idx].String())
+	}
+
+	if omitted > 0 {
+		lines = append(lines, fmt.Sprintf("-# %d older offence(s)", omitted))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOffences(t *testing.T) {
+	var (
+		now  = time.Now()
+		path = filepath.Join(t.TempDir(), "offences.jsonl")
+	)
+
+	for _, path := range []string{"", path} {
+		offences, err := OpenOffences(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, offence := range []Offence{
+			{UserID: "1", Rule: "CHANNEL_SPAM", Time: now.Add(-60 * 24 * time.Hour)},
+			{UserID: "1", Rule: "MENTIONS_SPAM", Time: now.Add(-time.Hour)},
+			{UserID: "2", Rule: "CHANNEL_SPAM", Time: now.Add(-time.Hour)},
+			{UserID: "1", Rule: "CHANNEL_SPAM", Time: now.Add(-2 * time.Hour)},
+			{UserID: "2", Rule: ImpersonationRule, Time: now.Add(-3 * time.Hour)},
+		} {
+			if err := offences.Add(offence); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		history := offences.History("1")
+		if len(history) != 3 || history[2].Rule != "MENTIONS_SPAM" {
+			t.Fatalf("expected 3 offences oldest first, got %+v", history)
+		}
+
+		if count := offences.Count("1", 30*24*time.Hour, now); count != 2 {
+			t.Errorf("expected 2 offences within window, got %d", count)
+		}
+
+		if count := offences.Count("1", 0, now); count != 3 {
+			t.Errorf("expected 3 offences without window, got %d", count)
+		}
+
+		// Impersonation does not count towards escalation.
+		if count := offences.Count("2", 0, now); count != 1 {
+			t.Errorf("expected 1 offence without impersonation, got %d", count)
+		}
+
+		if count := offences.Count("3", 0, now); count != 0 {
+			t.Errorf("expected no offences, got %d", count)
+		}
+	}
+
+	// Offences found to be false positives no longer count.
+	offences, err := OpenOffences("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offence := Offence{UserID: "1", Rule: "CHANNEL_SPAM", Time: now}
+	offences.Add(offence)
+	offences.Add(Offence{UserID: "1", Rule: "CHANNEL_SPAM", Time: now.Add(-time.Hour)})
+
+	if err := offences.Remove(offence); err != nil {
+		t.Fatal(err)
+	}
+
+	if history := offences.History("1"); len(history) != 1 || !history[0].Time.Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected offence to be removed, got %+v", history)
+	}
+
+	// Offences persist across handles, e.g., after a restart.
+	offences, err = OpenOffences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history := offences.History("1"); len(history) != 3 {
+		t.Errorf("expected 3 persisted offences, got %d", len(history))
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	var (
+		now     = time.Unix(1765324800, 0)
+		history = []Offence{
+			{Rule: "CHANNEL_SPAM", Time: now, Actions: []string{"delete"}},
+			{Rule: "MENTIONS_SPAM", Time: now.Add(time.Hour), Actions: []string{"timeout (1h0m0s)"}},
+			{Rule: "SCAM_LINKS", Time: now.Add(2 * time.Hour), Actions: []string{"ban (1d)", "delete"}},
+		}
+	)
+
+	expected := strings.Join([]string{
+		"<t:1765332000:f> scam_links: ban (1d), delete",
+		"<t:1765328400:f> mentions_spam: timeout (1h0m0s)",
+		"-# 1 older offence(s)",
+	}, "\n")
+
+	if actual := Summarise(history, 2); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	if actual := Summarise(history, 5); strings.Count(actual, "\n") != 2 {
+		t.Errorf("expected all offences, got %q", actual)
+	}
+}
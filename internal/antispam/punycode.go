@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const acePrefix string = "xn--"
+
+// Decode the internationalised labels of a host name, so that `xn--`
+// labels are compared by the characters they render as.  Labels that
+// fail to decode are left as they are.
+func decodeHost(host string) string {
+	if !strings.Contains(host, acePrefix) {
+		return host
+	}
+
+	labels := strings.Split(host, ".")
+	for idx, label := range labels {
+		if !strings.HasPrefix(label, acePrefix) {
+			continue
+		}
+
+		if decoded, err := idna.Lookup.ToUnicode(label); err == nil {
+			labels[idx] = decoded
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
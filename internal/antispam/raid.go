@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lcook/pulsar/internal/store"
+)
+
+// RaidSettings of the join-rate monitor, entering raid mode when at least
+// `joins` members, or `new_accounts` members with accounts younger than
+// `account_age`, join within the window.
+type RaidSettings struct {
+	Joins       int           `yaml:"joins"`
+	NewAccounts int           `yaml:"new_accounts"`
+	AccountAge  time.Duration `yaml:"account_age"`
+	Window      time.Duration `yaml:"window"`
+	// Guild verification level (1-4) raised to while in raid mode, left
+	// as is when zero or already as high.
+	VerificationLevel int `yaml:"verification_level"`
+	// Slowmode applied to the channels while in raid mode.
+	Slowmode         time.Duration `yaml:"slowmode"`
+	SlowmodeChannels []string      `yaml:"slowmode_channels"`
+	// Members joining while in raid mode are timed out for this long,
+	// unless zero.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (s *RaidSettings) Enabled() bool {
+	return s.Window > 0 && (s.Joins > 0 || s.NewAccounts > 0)
+}
+
+// Raid is raid mode as entered for a guild, along with the settings in
+// place beforehand so they can be restored once it ends.
+type Raid struct {
+	GuildID     string    `json:"guild_id"`
+	Started     time.Time `json:"started"`
+	Joins       int       `json:"joins"`
+	NewAccounts int       `json:"new_accounts"`
+	// Members that joined within the window leading up to raid mode.
+	Members []string `json:"members"`
+	// Previous verification level, if it was raised.
+	VerificationLevel *int `json:"verification_level,omitempty"`
+	// Previous slowmode (in seconds) of each channel it was applied to.
+	Slowmode map[string]int `json:"slowmode,omitempty"`
+}
+
+// Member joining a guild, as tracked within the window.
+type join struct {
+	userID string
+	time   time.Time
+	young  bool
+}
+
+// RaidMonitor tracks the rate at which members join each guild, and the
+// guilds in raid mode.  Raid mode is written through to a store when given
+// a path, so that it survives restarts and the previous settings can still
+// be restored.
+type RaidMonitor struct {
+	Settings RaidSettings
+
+	// Held across changing the settings of a guild upon entering raid mode
+	// and restoring them upon ending it (see Lock).
+	changes sync.Mutex
+
+	mu     sync.Mutex
+	joins  map[string][]join
+	raids  map[string]Raid
+	store  *store.Store[Raid]
+	ignore map[string]time.Time
+}
+
+func NewRaidMonitor(settings RaidSettings, path string) (*RaidMonitor, error) {
+	r := &RaidMonitor{
+		Settings: settings,
+		joins:    make(map[string][]join),
+		raids:    make(map[string]Raid),
+		ignore:   make(map[string]time.Time),
+	}
+
+	if path != "" {
+		raids, err := store.Open[Raid](path)
+		if err != nil {
+			return nil, err
+		}
+
+		raids.Range(func(guildID string, raid Raid) bool {
+			r.raids[guildID] = raid
+			return true
+		})
+
+		r.store = raids
+	}
+
+	return r, nil
+}
+
+// Join records the member joining the guild, entering raid mode if the
+// join rate exceeds the thresholds and returning it.  Nil is returned
+// otherwise, including while already in raid mode.
+func (r *RaidMonitor) Join(guildID, userID string, created, joined time.Time) *Raid {
+	if r == nil || !r.Settings.Enabled() {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		recent []join
+		young  int
+	)
+
+	for _, j := range r.joins[guildID] {
+		if joined.Sub(j.time) < r.Settings.Window {
+			recent = append(recent, j)
+		}
+	}
+
+	recent = append(recent, join{
+		userID: userID,
+		time:   joined,
+		young:  joined.Sub(created) < r.Settings.AccountAge,
+	})
+	r.joins[guildID] = recent
+
+	if _, ok := r.active(guildID); ok {
+		return nil
+	}
+	// Joins from before raid mode was last ended have already been dealt
+	// with, and would otherwise have it entered again straight away.
+	if ended, ok := r.ignore[guildID]; ok {
+		if joined.Sub(ended) >= r.Settings.Window {
+			delete(r.ignore, guildID)
+		}
+
+		for len(recent) > 0 && !recent[0].time.After(ended) {
+			recent = recent[1:]
+		}
+	}
+
+	for _, j := range recent {
+		if j.young {
+			young++
+		}
+	}
+
+	if (r.Settings.Joins == 0 || len(recent) < r.Settings.Joins) &&
+		(r.Settings.NewAccounts == 0 || young < r.Settings.NewAccounts) {
+		return nil
+	}
+
+	raid := Raid{
+		GuildID:     guildID,
+		Started:     joined,
+		Joins:       len(recent),
+		NewAccounts: young,
+		Members:     make([]string, 0, len(recent)),
+	}
+
+	for _, j := range recent {
+		raid.Members = append(raid.Members, j.userID)
+	}
+	// Entered before returning, so that members joining meanwhile do not
+	// have raid mode entered again.  Failing to persist it is no reason
+	// not to, and the raid mode is saved again once the settings have
+	// been changed anyway.
+	r.save(raid)
+
+	return &raid
+}
+
+// Lock serialises entering and ending raid mode, to be held across the
+// whole of changing the settings of the guild upon entering it, or
+// restoring them upon ending it, so that raid mode is never ended while
+// only some of the settings have been changed (and recorded).
+func (r *RaidMonitor) Lock() {
+	if r != nil {
+		r.changes.Lock()
+	}
+}
+
+func (r *RaidMonitor) Unlock() {
+	if r != nil {
+		r.changes.Unlock()
+	}
+}
+
+// Active returns the raid mode of the guild, if in raid mode.
+func (r *RaidMonitor) Active(guildID string) (Raid, bool) {
+	if r == nil {
+		return Raid{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.active(guildID)
+}
+
+func (r *RaidMonitor) active(guildID string) (Raid, bool) {
+	raid, ok := r.raids[guildID]
+
+	return raid, ok
+}
+
+// Save changes to the raid mode of the guild, e.g., the settings changed
+// upon entering it.
+func (r *RaidMonitor) Save(raid Raid) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.save(raid)
+}
+
+func (r *RaidMonitor) save(raid Raid) error {
+	r.raids[raid.GuildID] = raid
+
+	if r.store != nil {
+		return r.store.Put(raid.GuildID, raid)
+	}
+
+	return nil
+}
+
+// End raid mode for the guild, returning it so that the previous
+// settings can be restored.
+func (r *RaidMonitor) End(guildID string, now time.Time) (Raid, bool, error) {
+	if r == nil {
+		return Raid{}, false, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	raid, ok := r.active(guildID)
+	if !ok {
+		return raid, false, nil
+	}
+
+	r.ignore[guildID] = now
+	delete(r.raids, guildID)
+
+	if r.store != nil {
+		return raid, true, r.store.Delete(guildID)
+	}
+
+	return raid, true, nil
+}
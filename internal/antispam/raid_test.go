@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRaidMonitor(t *testing.T) {
+	var (
+		now      = time.Now()
+		old      = now.Add(-365 * 24 * time.Hour)
+		path     = filepath.Join(t.TempDir(), "raid.jsonl")
+		settings = RaidSettings{
+			Joins:       5,
+			NewAccounts: 3,
+			AccountAge:  24 * time.Hour,
+			Window:      time.Minute,
+		}
+	)
+
+	raids, err := NewRaidMonitor(settings, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	join := func(guildID string, idx int, created time.Time) *Raid {
+		joined := now.Add(time.Duration(idx) * time.Second)
+		return raids.Join(guildID, strconv.Itoa(idx), created, joined)
+	}
+
+	// Joins spread out beyond the window never add up.
+	for idx := range 10 {
+		joined := now.Add(time.Duration(idx) * 15 * time.Second)
+		if raid := raids.Join("0", strconv.Itoa(idx), old, joined); raid != nil {
+			t.Fatalf("expected no raid mode with spread out joins, got %+v", raid)
+		}
+	}
+
+	for idx := range 4 {
+		if raid := join("1", idx, old); raid != nil {
+			t.Fatalf("expected no raid mode after %d join(s)", idx+1)
+		}
+	}
+
+	raid := join("1", 4, old)
+	if raid == nil || raid.Joins != 5 || len(raid.Members) != 5 {
+		t.Fatalf("expected raid mode with 5 joins, got %+v", raid)
+	}
+
+	if raid := join("1", 5, old); raid != nil {
+		t.Errorf("expected raid mode to be entered once, got %+v", raid)
+	}
+
+	for idx := range 2 {
+		if raid := join("2", idx, now); raid != nil {
+			t.Fatalf("expected no raid mode after %d new account(s)", idx+1)
+		}
+	}
+
+	if raid := join("2", 2, now); raid == nil || raid.NewAccounts != 3 {
+		t.Errorf("expected raid mode with 3 new accounts, got %+v", raid)
+	}
+
+	// Raid mode persists across handles, e.g., after a restart.
+	level := 1
+	raid.VerificationLevel = &level
+
+	if err := raids.Save(*raid); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewRaidMonitor(settings, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active, ok := reopened.Active("1")
+	if !ok || active.VerificationLevel == nil || *active.VerificationLevel != 1 {
+		t.Fatalf("expected raid mode with previous settings, got %+v", active)
+	}
+
+	ended, ok, err := raids.End("1", now.Add(6*time.Second))
+	if err != nil || !ok || ended.Joins != 5 {
+		t.Fatalf("expected raid mode to end, got %+v (%v)", ended, err)
+	}
+
+	if _, ok := raids.Active("1"); ok {
+		t.Error("expected raid mode to have ended")
+	}
+
+	// Joins before raid mode ended no longer count towards entering it.
+	for idx := 7; idx < 11; idx++ {
+		if raid := join("1", idx, old); raid != nil {
+			t.Fatalf("expected no raid mode after ending it, got %+v", raid)
+		}
+	}
+
+	if raid := join("1", 11, old); raid == nil || raid.Joins != 5 {
+		t.Errorf("expected raid mode with 5 further joins, got %+v", raid)
+	}
+}
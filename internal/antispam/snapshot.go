@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/lcook/pulsar/internal/archive"
+	"github.com/lcook/pulsar/internal/cache"
+)
+
+// Logged message as written to a snapshot of the message cache.
+type snapshotEntry struct {
+	Message     *discordgo.Message `json:"message"`
+	Hash        string             `json:"hash"`
+	Fingerprint uint64             `json:"fingerprint,omitempty"`
+	Length      int                `json:"length,omitempty"`
+	Deleted     bool               `json:"deleted,omitempty"`
+	Handled     bool               `json:"handled,omitempty"`
+	Scope       []string           `json:"scope,omitempty"`
+}
+
+// Copy of the message with just the details the rules, and handlers of
+// the cache, make use of.
+func trimMessage(message *discordgo.Message) *discordgo.Message {
+	trimmed := &discordgo.Message{
+		ID:           message.ID,
+		ChannelID:    message.ChannelID,
+		GuildID:      message.GuildID,
+		Content:      message.Content,
+		Timestamp:    message.Timestamp,
+		Attachments:  message.Attachments,
+		StickerItems: message.StickerItems,
+		Embeds:       message.Embeds,
+	}
+
+	if message.Author != nil {
+		trimmed.Author = &discordgo.User{
+			ID:         message.Author.ID,
+			Username:   message.Author.Username,
+			GlobalName: message.Author.GlobalName,
+			Avatar:     message.Author.Avatar,
+		}
+	}
+
+	return trimmed
+}
+
+// Strip the content of the trimmed message, leaving what identifies it.
+func stripContent(message *discordgo.Message) *discordgo.Message {
+	message.Content = ""
+	message.Attachments = nil
+	message.StickerItems = nil
+	message.Embeds = nil
+
+	return message
+}
+
+// MaxWindow returns the largest window of any of the rules, being the
+// furthest back any rule looks at logged messages.
+func MaxWindow(rules []HeuristicRule) time.Duration {
+	var window time.Duration
+	for idx := range rules {
+		window = max(window, rules[idx].Thresholds.Window)
+	}
+
+	return window
+}
+
+// Snapshot writes the messages held in the cache to path, oldest first,
+// encrypted with the key as they include the content of each message.
+// Without a key, the content is left out and the snapshot written as is,
+// keeping what duplicate and coordinated rules need to carry on, i.e.,
+// the hash and fingerprint of the content, but not what content rules
+// match on.
+func Snapshot(logs *cache.Index[Log], path string, key []byte) error {
+	var entries []snapshotEntry
+
+	logs.ForEach(func(log *Log) {
+		message := trimMessage(log.Message)
+		if key == nil {
+			message = stripContent(message)
+		}
+
+		entries = append(entries, snapshotEntry{
+			Message:     message,
+			Hash:        log.Hash,
+			Fingerprint: log.Fingerprint(),
+			Length:      log.Length(),
+			Deleted:     log.Deleted(),
+			Handled:     log.Handled(),
+			Scope:       log.scope,
+		})
+	})
+
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		return writeFile(path, buf)
+	}
+
+	return archive.WriteFile(path, buf, key)
+}
+
+// Write the data to path beside the previous file, renaming it into place
+// so that a crash midway leaves the previous file intact.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Restore adds the messages in the snapshot at path, decrypted with the
+// key (or as is without one, see Snapshot), to the cache, other than those
+// older than maxAge (see MaxWindow) which no rule would look at anymore.
+// The messages are analysed afresh, so the current link list applies to
+// them.  Returns the number of messages restored; a missing snapshot
+// restores nothing.
+func Restore(
+	logs *cache.Index[Log],
+	path string,
+	key []byte,
+	maxAge time.Duration,
+	links *LinkList,
+) (int, error) {
+	var (
+		buf []byte
+		err error
+	)
+
+	if key == nil {
+		buf, err = os.ReadFile(path)
+	} else {
+		buf, err = archive.ReadFile(path, key)
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var entries []snapshotEntry
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return 0, err
+	}
+
+	var (
+		now      = time.Now()
+		restored int
+	)
+
+	for _, entry := range entries {
+		if entry.Message == nil || entry.Message.Author == nil ||
+			now.Sub(entry.Message.Timestamp) > maxAge {
+			continue
+		}
+
+		a := analyse(entry.Message, links)
+		// Messages with their content left out keep its fingerprint.
+		if entry.Message.Content == "" {
+			a.fingerprint = entry.Fingerprint
+			a.length = entry.Length
+		}
+
+		log := logs.Add(Log{
+			Message:  entry.Message,
+			Hash:     entry.Hash,
+			scope:    entry.Scope,
+			analysis: a,
+		})
+		if entry.Deleted {
+			log.MarkDeleted()
+		}
+
+		if entry.Handled {
+			log.MarkHandled()
+		}
+
+		restored++
+	}
+
+	return restored, nil
+}
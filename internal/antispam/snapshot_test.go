@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package antispam
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSnapshot(t *testing.T) {
+	var (
+		now    = time.Now()
+		path   = filepath.Join(t.TempDir(), "antispam.json")
+		source = NewCache(10)
+		key    = make([]byte, 32)
+	)
+
+	for idx, age := range []time.Duration{time.Hour, 20 * time.Second, 10 * time.Second, time.Second} {
+		message := &discordgo.Message{
+			ID:        string(rune('1' + idx)),
+			ChannelID: "727023752348434436",
+			Author:    &discordgo.User{ID: "1", Email: "user@example.com"},
+			Content:   "claim at https://steamcommunlty.com/gift",
+			Timestamp: now.Add(-age),
+			Member:    &discordgo.Member{Nick: "user"},
+		}
+		source.Add(NewLog(message, message.ID, []string{message.ChannelID, "100"}, nil))
+	}
+
+	source.ForEach(func(log *Log) {
+		switch log.Message.ID {
+		case "3":
+			log.MarkDeleted()
+		case "4":
+			log.MarkHandled()
+		}
+	})
+
+	if err := Snapshot(source, path, key); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCache(10)
+
+	count, err := Restore(restored, path, key, 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 3 {
+		t.Fatalf("expected 3 messages within the window, got %d", count)
+	}
+
+	var ids []string
+
+	restored.ForEach(func(log *Log) {
+		ids = append(ids, log.Message.ID)
+
+		if log.Deleted() != (log.Message.ID == "3") {
+			t.Errorf("message %s: unexpected deleted=%v", log.Message.ID, log.Deleted())
+		}
+
+		if log.Handled() != (log.Message.ID == "4") {
+			t.Errorf("message %s: unexpected handled=%v", log.Message.ID, log.Handled())
+		}
+
+		if log.Message.Author.Email != "" || log.Message.Member != nil {
+			t.Errorf("message %s: expected details beyond metadata to be dropped", log.Message.ID)
+		}
+
+		if !slices.Equal(log.Scope(), []string{"727023752348434436", "100"}) {
+			t.Errorf("message %s: unexpected scope %v", log.Message.ID, log.Scope())
+		}
+
+		if !slices.Equal(log.Verdicts(), []LinkVerdict{LinkLookalike}) {
+			t.Errorf("message %s: expected message to be analysed, got %v", log.Message.ID, log.Verdicts())
+		}
+	})
+
+	if !slices.Equal(ids, []string{"2", "3", "4"}) {
+		t.Errorf("expected messages 2-4 in order, got %v", ids)
+	}
+
+	if count, err := Restore(restored, filepath.Join(t.TempDir(), "missing.json"), key, time.Minute, nil); err != nil || count != 0 {
+		t.Errorf("expected missing snapshot to restore nothing, got %d (%v)", count, err)
+	}
+}
+
+func TestSnapshotWithoutKey(t *testing.T) {
+	var (
+		path    = filepath.Join(t.TempDir(), "antispam-state.json")
+		source  = NewCache(10)
+		content = "claim at https://steamcommunlty.com/gift"
+	)
+
+	message := &discordgo.Message{
+		ID:        "1",
+		ChannelID: "727023752348434436",
+		Author:    &discordgo.User{ID: "1"},
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+	source.Add(NewLog(message, "hash", nil, nil))
+
+	if err := Snapshot(source, path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(raw), "steamcommunlty") {
+		t.Error("expected content to be left out of the snapshot")
+	}
+
+	restored := NewCache(10)
+	if count, err := Restore(restored, path, nil, time.Minute, nil); err != nil || count != 1 {
+		t.Fatalf("expected 1 message restored, got %d (%v)", count, err)
+	}
+
+	log, _ := restored.Get("1")
+	current := NewLog(&discordgo.Message{Content: content + " 91kd"}, "other", nil, nil)
+
+	if log.Message.Content != "" || !log.Duplicate(&current, 0.85) {
+		t.Errorf("expected fingerprint to be kept without content, got %q", log.Message.Content)
+	}
+}
+
+func TestMaxWindow(t *testing.T) {
+	rules := make([]HeuristicRule, 3)
+	rules[0].Thresholds.Window = 15 * time.Second
+	rules[1].Thresholds.Window = time.Minute
+	rules[2].Thresholds.Window = 30 * time.Second
+
+	if window := MaxWindow(rules); window != time.Minute {
+		t.Errorf("expected 1m, got %s", window)
+	}
+}
@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package archive
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/lcook/pulsar/internal/store"
+)
+
+// Size of the AES-256 key messages are encrypted with.
+const keySize int = 32
+
+// KeyEnv is the environment variable the encryption key is read from when
+// not configured.
+const KeyEnv string = "PULSAR_ENCRYPTION_KEY"
+
+// ErrNoKey is returned by Key when no encryption key is configured.
+var ErrNoKey = errors.New("no encryption key configured")
+
+// Settings of the message archive, keeping up to `max_messages` messages
+// for `max_age` (or the retention of their channel, if given) so that
+// edits and deletions of messages no longer held by the state cache are
+// still logged.  A channel with a retention of zero is not archived.
+type Settings struct {
+	MaxMessages int                      `yaml:"max_messages"`
+	MaxAge      time.Duration            `yaml:"max_age"`
+	Channels    map[string]time.Duration `yaml:"channels"`
+
+	Attachments AttachmentSettings `yaml:"attachments"`
+}
+
+func (s *Settings) Enabled() bool {
+	return s.MaxMessages > 0 && s.MaxAge > 0
+}
+
+// Retention returns how long messages of the channel are kept for.
+func (s *Settings) Retention(channelID string) time.Duration {
+	if retention, ok := s.Channels[channelID]; ok {
+		return retention
+	}
+
+	return s.MaxAge
+}
+
+// Archived message, encrypted, along with what is needed to expire it
+// without decrypting it.
+type entry struct {
+	ChannelID string    `json:"channel_id"`
+	Created   time.Time `json:"created"`
+	Data      []byte    `json:"data"`
+}
+
+// Archive is a size- and age-bounded store of messages, encrypted at rest
+// with AES-GCM.
+type Archive struct {
+	Settings Settings
+
+	store *store.Store[entry]
+	aead  cipher.AEAD
+	now   func() time.Time
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Encrypt the data, prefixed by the nonce.  The ID is authenticated
+// alongside the data, so that it cannot be passed off as that of another
+// message (or attachment).
+func seal(aead cipher.AEAD, data []byte, id string) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, data, []byte(id)), nil
+}
+
+func open(aead cipher.AEAD, data []byte, id string) ([]byte, error) {
+	size := aead.NonceSize()
+	if len(data) < size {
+		return nil, errors.New("encrypted data too short")
+	}
+
+	return aead.Open(nil, data[:size], data[size:], []byte(id))
+}
+
+// Encrypt the data with the key for keeping outside of the archive, e.g.,
+// alongside other details in a store, authenticating the ID with it (see
+// seal).
+func Encrypt(data, key []byte, id string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return seal(aead, data, id)
+}
+
+// Decrypt the data encrypted by Encrypt with the same key and ID.
+func Decrypt(data, key []byte, id string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, data, id)
+}
+
+func Open(settings Settings, path string, key []byte) (*Archive, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := store.Open[entry](path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Archive{
+		Settings: settings,
+		store:    s,
+		aead:     aead,
+		now:      time.Now,
+	}, nil
+}
+
+// Key returns the base64 encoded key, or otherwise the key held by the
+// KeyEnv environment variable, decoded.  The key is never generated, as
+// one kept beside the data it encrypts would protect nothing.
+func Key(encoded string) ([]byte, error) {
+	if encoded == "" {
+		encoded = os.Getenv(KeyEnv)
+	}
+
+	if encoded == "" {
+		return nil, ErrNoKey
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", keySize, len(key))
+	}
+
+	return key, nil
+}
+
+// Copy of the message with just the details logged on edit or deletion.
+func trimMessage(message *discordgo.Message) *discordgo.Message {
+	trimmed := &discordgo.Message{
+		ID:           message.ID,
+		ChannelID:    message.ChannelID,
+		GuildID:      message.GuildID,
+		Type:         message.Type,
+		Content:      message.Content,
+		Timestamp:    message.Timestamp,
+		Attachments:  message.Attachments,
+		StickerItems: message.StickerItems,
+	}
+
+	if message.Author != nil {
+		trimmed.Author = &discordgo.User{
+			ID:         message.Author.ID,
+			Username:   message.Author.Username,
+			GlobalName: message.Author.GlobalName,
+			Avatar:     message.Author.Avatar,
+			Bot:        message.Author.Bot,
+		}
+	}
+
+	return trimmed
+}
+
+// Put the message in the archive, replacing any earlier version of it,
+// unless its channel is not archived.  The oldest messages are dropped
+// once the archive is full.
+func (a *Archive) Put(message *discordgo.Message) error {
+	if a.Settings.Retention(message.ChannelID) <= 0 {
+		return nil
+	}
+
+	created, err := discordgo.SnowflakeTimestamp(message.ID)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(trimMessage(message))
+	if err != nil {
+		return err
+	}
+
+	data, err := seal(a.aead, buf, message.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.store.Put(message.ID, entry{
+		ChannelID: message.ChannelID,
+		Created:   created,
+		Data:      data,
+	}); err != nil {
+		return err
+	}
+
+	if a.store.Len() > a.Settings.MaxMessages {
+		_, err = a.Prune()
+	}
+
+	return err
+}
+
+// Get the archived message with the ID, unless expired.
+func (a *Archive) Get(id string) (*discordgo.Message, bool) {
+	e, ok := a.store.Get(id)
+	if !ok || a.expired(e) {
+		return nil, false
+	}
+
+	buf, err := open(a.aead, e.Data, id)
+	if err != nil {
+		return nil, false
+	}
+
+	var message discordgo.Message
+	if err := json.Unmarshal(buf, &message); err != nil {
+		return nil, false
+	}
+
+	return &message, true
+}
+
+func (a *Archive) Delete(id string) error {
+	return a.store.Delete(id)
+}
+
+func (a *Archive) Len() int {
+	return a.store.Len()
+}
+
+func (a *Archive) expired(e entry) bool {
+	retention := a.Settings.Retention(e.ChannelID)
+
+	return retention <= 0 || a.now().Sub(e.Created) > retention
+}
+
+// Prune removes the expired messages and, when over the limit, the oldest
+// messages down to nine tenths of it, so that a full archive is not pruned
+// on every message.  It returns the number of messages removed.
+func (a *Archive) Prune() (int, error) {
+	var (
+		created []time.Time
+		cutoff  time.Time
+	)
+
+	a.store.Range(func(_ string, e entry) bool {
+		if !a.expired(e) {
+			created = append(created, e.Created)
+		}
+
+		return true
+	})
+
+	if len(created) > a.Settings.MaxMessages {
+		slices.SortFunc(created, func(a, b time.Time) int {
+			return b.Compare(a)
+		})
+		// Messages created at the same time as the newest one dropped
+		// are dropped too, erring on the side of a smaller archive.
+		cutoff = created[a.Settings.MaxMessages*9/10]
+	}
+
+	return a.store.Prune(func(_ string, e entry) bool {
+		return a.expired(e) || !e.Created.After(cutoff)
+	})
+}
@@ -0,0 +1,223 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package archive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord epoch of snowflake timestamps, in milliseconds.
+const discordEpoch int64 = 1420070400000
+
+// Snowflake of a message created at the time, with seq telling apart
+// those created at the same time.
+func snowflake(created time.Time, seq int) string {
+	return strconv.FormatInt((created.UnixMilli()-discordEpoch)<<22|int64(seq), 10)
+}
+
+func message(id, channelID, content string) *discordgo.Message {
+	return &discordgo.Message{
+		ID:        id,
+		ChannelID: channelID,
+		Content:   content,
+		Author:    &discordgo.User{ID: "1", Username: "lcook"},
+	}
+}
+
+func TestArchive(t *testing.T) {
+	var (
+		now      = time.Now()
+		dir      = t.TempDir()
+		path     = filepath.Join(dir, "archive.jsonl")
+		settings = Settings{
+			MaxMessages: 10,
+			MaxAge:      time.Hour,
+			Channels:    map[string]time.Duration{"short": time.Minute, "never": 0},
+		}
+	)
+
+	key := make([]byte, keySize)
+
+	archive, err := Open(settings, path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive.now = func() time.Time { return now }
+
+	var (
+		recent = snowflake(now.Add(-30*time.Second), 0)
+		older  = snowflake(now.Add(-30*time.Minute), 0)
+	)
+
+	for _, m := range []*discordgo.Message{
+		message(recent, "general", "hello world"),
+		message(older, "general", "an older hello"),
+		message(snowflake(now.Add(-30*time.Minute), 1), "short", "expired already"),
+		message(snowflake(now, 0), "never", "not archived"),
+	} {
+		if err := archive.Put(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if archive.Len() != 3 {
+		t.Errorf("expected 3 archived messages, got %d", archive.Len())
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(buf, []byte("hello")) {
+		t.Error("expected message content to be encrypted at rest")
+	}
+
+	reopened, err := Open(settings, path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened.now = archive.now
+
+	m, ok := reopened.Get(recent)
+	if !ok || m.Content != "hello world" || m.Author.ID != "1" {
+		t.Errorf("expected archived message, got %+v", m)
+	}
+
+	if _, ok := reopened.Get(snowflake(now.Add(-30*time.Minute), 1)); ok {
+		t.Error("expected message past its channel retention to be expired")
+	}
+
+	archive.now = func() time.Time { return now.Add(45 * time.Minute) }
+
+	if _, ok := archive.Get(older); ok {
+		t.Error("expected message past the maximum age to be expired")
+	}
+
+	if pruned, err := archive.Prune(); err != nil || pruned != 2 {
+		t.Errorf("expected 2 expired messages to be pruned, got %d (%v)", pruned, err)
+	}
+
+	if err := archive.Delete(recent); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := archive.Get(recent); ok {
+		t.Error("expected deleted message to be removed")
+	}
+
+	other := make([]byte, keySize)
+	copy(other, key)
+	other[0] ^= 0xff
+
+	if err := archive.Put(message(recent, "general", "hello again")); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong, err := Open(settings, path, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrong.now = archive.now
+
+	if _, ok := wrong.Get(recent); ok {
+		t.Error("expected message not to be decrypted with another key")
+	}
+}
+
+func TestArchiveLimit(t *testing.T) {
+	var (
+		now      = time.Now()
+		settings = Settings{MaxMessages: 10, MaxAge: time.Hour}
+		key      = make([]byte, keySize)
+	)
+
+	archive, err := Open(settings, filepath.Join(t.TempDir(), "archive.jsonl"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx := range 11 {
+		created := now.Add(time.Duration(idx-20) * time.Second)
+		if err := archive.Put(message(snowflake(created, 0), "general", "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if archive.Len() != 9 {
+		t.Errorf("expected full archive to be pruned down to 9 messages, got %d", archive.Len())
+	}
+
+	if _, ok := archive.Get(snowflake(now.Add(-20*time.Second), 0)); ok {
+		t.Error("expected oldest message to be dropped")
+	}
+
+	if _, ok := archive.Get(snowflake(now.Add(-10*time.Second), 0)); !ok {
+		t.Error("expected newest message to be kept")
+	}
+}
+
+func TestKey(t *testing.T) {
+	t.Setenv(KeyEnv, "")
+
+	if _, err := Key(""); !errors.Is(err, ErrNoKey) {
+		t.Errorf("expected no key to be an error, got %v", err)
+	}
+
+	var (
+		configured = bytes.Repeat([]byte{1}, keySize)
+		env        = bytes.Repeat([]byte{2}, keySize)
+	)
+
+	t.Setenv(KeyEnv, base64.StdEncoding.EncodeToString(env))
+
+	if key, err := Key(""); err != nil || !bytes.Equal(key, env) {
+		t.Errorf("expected key from the environment to be used, got %v", err)
+	}
+
+	if key, err := Key(base64.StdEncoding.EncodeToString(configured)); err != nil ||
+		!bytes.Equal(key, configured) {
+		t.Errorf("expected configured key to be used, got %v", err)
+	}
+
+	if _, err := Key("c2hvcnQ="); err == nil {
+		t.Error("expected short key to be rejected")
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	var (
+		key  = make([]byte, keySize)
+		data = []byte("claim at https://steamcommunlty.com/gift")
+	)
+
+	sealed, err := Encrypt(data, key, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(sealed, data) {
+		t.Error("expected data to be encrypted")
+	}
+
+	if opened, err := Decrypt(sealed, key, "1"); err != nil || !bytes.Equal(opened, data) {
+		t.Errorf("expected data to be decrypted, got %q (%v)", opened, err)
+	}
+
+	if _, err := Decrypt(sealed, key, "2"); err == nil {
+		t.Error("expected data to be rejected under another ID")
+	}
+}
@@ -0,0 +1,366 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/lcook/pulsar/internal/store"
+)
+
+// How long downloading an attachment may take.
+const downloadTimeout = 30 * time.Second
+
+// AttachmentSettings of the attachment cache, downloading attachments of
+// up to `max_size` bytes with one of the content types (matched by prefix,
+// e.g., "image/", or any when none are given) as they are sent, so that
+// they can be uploaded to the log channel once the message is deleted.
+// Files are kept for `max_age`, and the oldest dropped once they add up to
+// more than `max_total_size`.
+type AttachmentSettings struct {
+	MaxSize            int64         `yaml:"max_size"`
+	MaxTotalSize       int64         `yaml:"max_total_size"`
+	MaxAge             time.Duration `yaml:"max_age"`
+	ContentTypes       []string      `yaml:"content_types"`
+	ExcludedChannelIDs []string      `yaml:"excluded_channel_ids"`
+}
+
+func (s *AttachmentSettings) Enabled() bool {
+	return s.MaxSize > 0 && s.MaxTotalSize > 0 && s.MaxAge > 0
+}
+
+// Allowed returns whether the attachment is within the size and content
+// type limits.
+func (s *AttachmentSettings) Allowed(attachment *discordgo.MessageAttachment) bool {
+	if attachment.Size <= 0 || int64(attachment.Size) > s.MaxSize {
+		return false
+	}
+
+	if len(s.ContentTypes) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(s.ContentTypes, func(prefix string) bool {
+		return strings.HasPrefix(attachment.ContentType, prefix)
+	})
+}
+
+// Attachment as cached.
+type Attachment struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Cached attachments of a message.
+type attachmentsEntry struct {
+	Created     time.Time    `json:"created"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+func (e attachmentsEntry) size() int64 {
+	var size int64
+	for _, attachment := range e.Attachments {
+		size += attachment.Size
+	}
+
+	return size
+}
+
+// Attachments is a size- and age-bounded cache of message attachments,
+// each kept encrypted in a file of its own under the directory of the
+// message.
+type Attachments struct {
+	Settings AttachmentSettings
+
+	dir    string
+	store  *store.Store[attachmentsEntry]
+	aead   cipher.AEAD
+	client *http.Client
+	now    func() time.Time
+}
+
+func OpenAttachments(
+	settings AttachmentSettings,
+	dir string,
+	key []byte,
+) (*Attachments, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := store.Open[attachmentsEntry](filepath.Join(dir, "attachments.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Attachments{
+		Settings: settings,
+		dir:      dir,
+		store:    s,
+		aead:     aead,
+		client:   &http.Client{Timeout: downloadTimeout},
+		now:      time.Now,
+	}, nil
+}
+
+func (a *Attachments) path(messageID, attachmentID string) string {
+	return filepath.Join(a.dir, messageID, attachmentID)
+}
+
+func (a *Attachments) download(url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	// Read one byte past the limit to tell whether the file is over it,
+	// as the size given for the attachment is not to be trusted.
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, a.Settings.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(buf)) > a.Settings.MaxSize {
+		return nil, fmt.Errorf("larger than %d bytes", a.Settings.MaxSize)
+	}
+
+	return buf, nil
+}
+
+// Fetch the attachments of the message within the limits, returning the
+// number cached.  Attachments failing to download are skipped, with the
+// first error returned once the rest are cached.
+func (a *Attachments) Fetch(message *discordgo.Message) (int, error) {
+	created, err := discordgo.SnowflakeTimestamp(message.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		cached = attachmentsEntry{Created: created}
+		first  error
+	)
+
+	for _, attachment := range message.Attachments {
+		if !a.Settings.Allowed(attachment) {
+			continue
+		}
+
+		size, err := a.fetch(message.ID, attachment)
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("%s: %w", attachment.Filename, err)
+			}
+
+			continue
+		}
+
+		cached.Attachments = append(cached.Attachments, Attachment{
+			ID:          attachment.ID,
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Size:        size,
+		})
+	}
+
+	if len(cached.Attachments) == 0 {
+		return 0, first
+	}
+
+	if err := a.store.Put(message.ID, cached); err != nil {
+		return 0, err
+	}
+
+	if a.total() > a.Settings.MaxTotalSize {
+		if _, err := a.Prune(); err != nil {
+			return len(cached.Attachments), err
+		}
+	}
+
+	return len(cached.Attachments), first
+}
+
+// Download the attachment and write it to disk, returning its size.
+func (a *Attachments) fetch(
+	messageID string,
+	attachment *discordgo.MessageAttachment,
+) (int64, error) {
+	buf, err := a.download(attachment.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := seal(a.aead, buf, messageID+"/"+attachment.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Join(a.dir, messageID), 0o750); err != nil {
+		return 0, err
+	}
+
+	return int64(len(buf)), os.WriteFile(a.path(messageID, attachment.ID), data, 0o600)
+}
+
+// Files returns the cached attachments of the message, ready to be
+// uploaded, unless expired.
+func (a *Attachments) Files(messageID string) ([]*discordgo.File, error) {
+	e, ok := a.store.Get(messageID)
+	if !ok || a.expired(e) {
+		return nil, nil
+	}
+
+	files := make([]*discordgo.File, 0, len(e.Attachments))
+
+	for _, attachment := range e.Attachments {
+		data, err := os.ReadFile(a.path(messageID, attachment.ID))
+		if err != nil {
+			return files, err
+		}
+
+		buf, err := open(a.aead, data, messageID+"/"+attachment.ID)
+		if err != nil {
+			return files, fmt.Errorf("%s: %w", attachment.Filename, err)
+		}
+
+		files = append(files, &discordgo.File{
+			Name:        attachment.Filename,
+			ContentType: attachment.ContentType,
+			Reader:      bytes.NewReader(buf),
+		})
+	}
+
+	return files, nil
+}
+
+// Remove the cached attachments of the message.
+func (a *Attachments) Remove(messageID string) error {
+	if _, ok := a.store.Get(messageID); !ok {
+		return nil
+	}
+
+	if err := os.RemoveAll(filepath.Join(a.dir, messageID)); err != nil {
+		return err
+	}
+
+	return a.store.Delete(messageID)
+}
+
+func (a *Attachments) expired(e attachmentsEntry) bool {
+	return a.now().Sub(e.Created) > a.Settings.MaxAge
+}
+
+// Total size of the cached attachments.
+func (a *Attachments) total() int64 {
+	var total int64
+
+	a.store.Range(func(_ string, e attachmentsEntry) bool {
+		total += e.size()
+		return true
+	})
+
+	return total
+}
+
+// Prune removes the expired attachments and, when over the total size,
+// the oldest attachments down to nine tenths of it, along with any files
+// left behind without an entry (e.g., by a download interrupted by a
+// restart).  It returns the number of messages whose attachments were
+// removed.
+func (a *Attachments) Prune() (int, error) {
+	type cached struct {
+		id string
+		e  attachmentsEntry
+	}
+
+	var (
+		live  []cached
+		drop  = make(map[string]bool)
+		total int64
+	)
+
+	a.store.Range(func(id string, e attachmentsEntry) bool {
+		if a.expired(e) {
+			drop[id] = true
+		} else {
+			live = append(live, cached{id, e})
+			total += e.size()
+		}
+
+		return true
+	})
+
+	if total > a.Settings.MaxTotalSize {
+		slices.SortFunc(live, func(x, y cached) int {
+			return x.e.Created.Compare(y.e.Created)
+		})
+
+		for _, c := range live {
+			if total <= a.Settings.MaxTotalSize*9/10 {
+				break
+			}
+
+			drop[c.id] = true
+			total -= c.e.size()
+		}
+	}
+
+	pruned, err := a.store.Prune(func(id string, _ attachmentsEntry) bool {
+		return drop[id]
+	})
+	if err != nil {
+		return pruned, err
+	}
+
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return pruned, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if _, ok := a.store.Get(entry.Name()); ok {
+			continue
+		}
+		// Leave be the files of a download still in progress, which
+		// only gets an entry once complete.
+		info, err := entry.Info()
+		if err != nil || a.now().Sub(info.ModTime()) < 2*downloadTimeout {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(a.dir, entry.Name())); err != nil {
+			return pruned, err
+		}
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package archive
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAttachments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small.png":
+			w.Write([]byte("small image"))
+		case "/lying.png":
+			// Larger than the size given for the attachment.
+			w.Write(bytes.Repeat([]byte("x"), 64))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var (
+		now      = time.Now()
+		dir      = t.TempDir()
+		settings = AttachmentSettings{
+			MaxSize:      32,
+			MaxTotalSize: 1024,
+			MaxAge:       time.Hour,
+			ContentTypes: []string{"image/"},
+		}
+	)
+
+	attachments, err := OpenAttachments(settings, dir, make([]byte, keySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attachments.now = func() time.Time { return now }
+
+	attachment := func(id, name, contentType string, size int) *discordgo.MessageAttachment {
+		return &discordgo.MessageAttachment{
+			ID:          id,
+			URL:         server.URL + "/" + name,
+			Filename:    name,
+			ContentType: contentType,
+			Size:        size,
+		}
+	}
+
+	id := snowflake(now, 0)
+
+	cached, err := attachments.Fetch(&discordgo.Message{
+		ID: id,
+		Attachments: []*discordgo.MessageAttachment{
+			attachment("1", "small.png", "image/png", 11),
+			attachment("2", "large.png", "image/png", 1024),
+			attachment("3", "notes.txt", "text/plain", 10),
+			attachment("4", "lying.png", "image/png", 10),
+		},
+	})
+	if cached != 1 {
+		t.Errorf("expected 1 attachment to be cached, got %d", cached)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "lying.png") {
+		t.Errorf("expected oversized download to be reported, got %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, id, "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(data, []byte("small image")) {
+		t.Error("expected attachment to be encrypted at rest")
+	}
+
+	files, err := attachments.Files(id)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected 1 cached file, got %d (%v)", len(files), err)
+	}
+
+	if buf, _ := io.ReadAll(files[0].Reader); string(buf) != "small image" || files[0].Name != "small.png" {
+		t.Errorf("expected small.png to be cached, got %s %q", files[0].Name, buf)
+	}
+
+	attachments.now = func() time.Time { return now.Add(2 * time.Hour) }
+
+	if files, _ := attachments.Files(id); len(files) != 0 {
+		t.Error("expected expired attachments not to be returned")
+	}
+
+	if pruned, err := attachments.Prune(); err != nil || pruned != 1 {
+		t.Errorf("expected expired attachments to be pruned, got %d (%v)", pruned, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, id)); !os.IsNotExist(err) {
+		t.Errorf("expected pruned attachments to be removed from disk, got %v", err)
+	}
+}
+
+func TestAttachmentsLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 10))
+	}))
+	defer server.Close()
+
+	var (
+		now      = time.Now()
+		settings = AttachmentSettings{MaxSize: 10, MaxTotalSize: 30, MaxAge: time.Hour}
+	)
+
+	attachments, err := OpenAttachments(settings, t.TempDir(), make([]byte, keySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, 0, 4)
+
+	for idx := range 4 {
+		id := snowflake(now.Add(time.Duration(idx)*time.Second), 0)
+		ids = append(ids, id)
+
+		if _, err := attachments.Fetch(&discordgo.Message{
+			ID: id,
+			Attachments: []*discordgo.MessageAttachment{
+				{ID: "1", URL: server.URL, Filename: "file", Size: 10},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pruned down to nine tenths of the total size once over it.
+	for idx, id := range ids {
+		files, _ := attachments.Files(id)
+		if kept := len(files) > 0; kept != (idx >= 2) {
+			t.Errorf("message %d: expected kept to be %t", idx, idx >= 2)
+		}
+	}
+
+	if err := attachments.Remove(ids[3]); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := attachments.Files(ids[3]); len(files) != 0 {
+		t.Error("expected removed attachments not to be returned")
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package archive
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFile encrypts the data with the key and writes it to path.  The
+// file is written beside the previous one and renamed into place, so a
+// crash midway leaves the previous file intact.  The name of the file is
+// authenticated alongside the data, so that files cannot be swapped for
+// one another.
+func WriteFile(path string, data, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := seal(aead, data, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadFile reads the file at path written by WriteFile, decrypting it
+// with the key.
+func ReadFile(path string, key []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, data, filepath.Base(path))
+}
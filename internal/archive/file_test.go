@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "transcript")
+		key  = make([]byte, keySize)
+		data = []byte("claim at https://steamcommunlty.com/gift")
+	)
+
+	if err := WriteFile(path, data, key); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(raw, data) {
+		t.Error("expected file to be encrypted")
+	}
+
+	if read, err := ReadFile(path, key); err != nil || !bytes.Equal(read, data) {
+		t.Errorf("expected data to be read back, got %q (%v)", read, err)
+	}
+
+	other := bytes.Repeat([]byte{1}, keySize)
+	if _, err := ReadFile(path, other); err == nil {
+		t.Error("expected file to be unreadable with another key")
+	}
+
+	renamed := filepath.Join(dir, "other")
+	if err := os.Rename(path, renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadFile(renamed, key); err == nil {
+		t.Error("expected renamed file to be rejected")
+	}
+}
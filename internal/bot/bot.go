@@ -11,6 +11,9 @@ import (
 	"github.com/lcook/pulsar/internal/version"
 )
 
+// Default number of messages per channel held by the state cache.
+const defaultStateCacheSize int = 500
+
 type Bot struct {
 	Settings config.Settings
 	Session  *discordgo.Session
@@ -45,7 +48,11 @@ func (b *Bot) Run(
 	handlers ...[]any,
 ) error {
 	b.Session.Identify.Intents = intents
-	b.Session.State.MaxMessageCount = 500
+	b.Session.State.MaxMessageCount = defaultStateCacheSize
+
+	if b.Settings.StateCacheSize > 0 {
+		b.Session.State.MaxMessageCount = b.Settings.StateCacheSize
+	}
 
 	log.Info("Starting websocket connection with Discord")
 
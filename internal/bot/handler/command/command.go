@@ -4,9 +4,15 @@
 package command
 
 import (
+	"path/filepath"
 	"time"
 
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
 	"github.com/lcook/pulsar/internal/config"
+	"github.com/lcook/pulsar/internal/pulse/hook/git"
 )
 
 const (
@@ -18,6 +24,10 @@ type Handler struct {
 	Started  time.Time
 
 	commands []Command
+	history  *git.History
+	offences *antispam.Offences
+	raid     *antispam.RaidMonitor
+	tickets  *tickets
 }
 
 type Command struct {
@@ -26,33 +36,92 @@ type Command struct {
 	Handler     any
 }
 
-func New(settings config.Settings) *Handler {
+// New returns the command handler.  Raid mode is shared with the event
+// handler, which enters it, so that the raid command can end it.
+func New(settings config.Settings, raid *antispam.RaidMonitor) *Handler {
 	h := &Handler{
 		Settings: settings,
 		Started:  time.Now(),
+		raid:     raid,
 	}
 
 	available := map[string]Command{
-		"help": {"help", "Show this help page", h.Help},
-		"role": {"role", "Assign yourself to a defined role", h.Role},
+		"help": {"help", "Show this help page", guildOnly(h.Help)},
+		"role": {"role", "Assign yourself to a defined role", guildOnly(h.Role)},
 		"bug": {
 			"bug",
 			"Display information of a Bugzilla report providing an ID",
-			h.Bug,
+			guildOnly(h.Bug),
 		},
-		"status": {"status", "Display bot status", h.Status},
+		"status": {"status", "Display bot status", guildOnly(h.Status)},
 		"review": {
 			"review",
 			"Display information of a Phabricator differential revision providing an ID",
-			h.Review,
+			guildOnly(h.Review),
 		},
 		"user": {
 			"user",
 			"Display user information of a provided ID",
-			h.User,
+			guildOnly(h.User),
+		},
+		"commit": {
+			"commit",
+			"Display information of a relayed commit providing a hash",
+			guildOnly(h.Commit),
+		},
+		"raid": {
+			"raid",
+			"Display raid mode status, or end it with `end` (moderators only)",
+			guildOnly(h.Raid),
 		},
+		"modmail": {
+			"modmail",
+			"Message the bot directly to reach the moderators",
+			h.Modmail,
+		},
+	}
+
+	if settings.Directory != "" {
+		history, err := git.OpenHistoryReadOnly(settings.Directory)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"directory":     settings.Directory,
+				"error_message": err.Error(),
+			}).Warn("Unable to open commit history")
+		}
+
+		h.history = history
+
+		offences, err := antispam.OpenOffencesReadOnly(
+			filepath.Join(settings.Directory, "offences.jsonl"),
+		)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"directory":     settings.Directory,
+				"error_message": err.Error(),
+			}).Warn("Unable to open antispam offence history")
+		}
+
+		h.offences = offences
 	}
 
+	var tickets string
+	if settings.Directory != "" {
+		tickets = filepath.Join(settings.Directory, "modmail.jsonl")
+	}
+
+	t, err := openTickets(tickets)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":          tickets,
+			"error_message": err.Error(),
+		}).Warn("Unable to open modmail tickets, keeping them in memory")
+
+		t, _ = openTickets("")
+	}
+
+	h.tickets = t
+
 	for _, name := range settings.Commands {
 		if cmd, ok := available[name]; ok {
 			h.commands = append(h.commands, cmd)
@@ -62,6 +131,21 @@ func New(settings config.Settings) *Handler {
 	return h
 }
 
+// Wrap the handler of a command to ignore direct messages, which only the
+// modmail command handles.  Direct messages lack the guild and member the
+// other commands expect.
+func guildOnly(
+	handler func(*discordgo.Session, *discordgo.MessageCreate),
+) func(*discordgo.Session, *discordgo.MessageCreate) {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		if m.GuildID == "" || m.Member == nil {
+			return
+		}
+
+		handler(s, m)
+	}
+}
+
 func (h *Handler) Handlers() []any {
 	hnd := make([]any, 0, len(h.commands))
 	for _, handler := range h.commands {
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package command
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	commitSubExp string = "hash"
+	commitColor  int    = 0x6f42c1
+)
+
+func (h *Handler) Commit(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author.Bot || m.Author.ID == s.State.User.ID {
+		return
+	}
+
+	commitRegex := `(?:(?i)\` + h.Settings.Prefix + `commit\s+|(?:https?://)?cgit\.freebsd\.org/[\w-]+/commit/?\?(?:\S*?&)?id=|(?:https?://)?github\.com/freebsd/freebsd-[\w-]+/commit/)(?P<hash>[0-9a-fA-F]{7,40})`
+	if hash := messageMatchRegex(m, commitRegex, commitSubExp); hash != "" {
+		author := &discordgo.MessageEmbedAuthor{
+			Name:    "Git: Commit " + hash,
+			IconURL: "https://raw.githubusercontent.com/freebsd/freebsd-src/refs/heads/main/stand/images/freebsd-logo-rev.png",
+		}
+
+		if h.history == nil {
+			s.ChannelMessageSendEmbedReply(m.ChannelID, &discordgo.MessageEmbed{
+				Description: "Commit history is not available",
+				Color:       commitColor,
+				Author:      author,
+			}, m.Reference())
+
+			return
+		}
+
+		records := h.history.Lookup(hash)
+		switch {
+		case len(records) < 1:
+			s.ChannelMessageSendEmbedReply(m.ChannelID, &discordgo.MessageEmbed{
+				Description: fmt.Sprintf(
+					"Unable to find commit with hash matching **%s**",
+					hash,
+				),
+				Color:  commitColor,
+				Author: author,
+			}, m.Reference())
+
+			return
+		case len(records) > 1:
+			s.ChannelMessageSendEmbedReply(m.ChannelID, &discordgo.MessageEmbed{
+				Description: fmt.Sprintf(
+					"Commit hash **%s** is ambiguous, matching %d commits",
+					hash,
+					len(records),
+				),
+				Color:  commitColor,
+				Author: author,
+			}, m.Reference())
+
+			return
+		}
+
+		s.ChannelMessageSendEmbedReply(
+			m.ChannelID,
+			records[0].Embed(),
+			m.Reference(),
+		)
+	}
+}
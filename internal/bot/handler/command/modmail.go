@@ -0,0 +1,464 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/archive"
+	"github.com/lcook/pulsar/internal/bot/handler/event"
+	"github.com/lcook/pulsar/internal/store"
+)
+
+const embedColorModmail int = 0x2AA198
+
+// Number of messages fetched by a single request when writing the
+// transcript of a ticket.
+const transcriptBatch int = 100
+
+// Ticket opened by a member messaging the bot directly, with the
+// conversation taking place in a thread of the staff forum channel.
+type ticket struct {
+	UserID   string    `json:"user_id"`
+	ThreadID string    `json:"thread_id"`
+	Opened   time.Time `json:"opened"`
+}
+
+// Open tickets, keyed by member, kept in a store when given a path so that
+// tickets remain open across restarts, and otherwise in memory.
+type tickets struct {
+	mu     sync.Mutex
+	memory map[string]ticket
+	store  *store.Store[ticket]
+}
+
+func openTickets(path string) (*tickets, error) {
+	t := &tickets{memory: make(map[string]ticket)}
+	if path == "" {
+		return t, nil
+	}
+
+	s, err := store.Open[ticket](path)
+	if err != nil {
+		return nil, err
+	}
+
+	t.store = s
+
+	return t, nil
+}
+
+func (t *tickets) byUser(userID string) (ticket, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.store != nil {
+		return t.store.Get(userID)
+	}
+
+	tk, ok := t.memory[userID]
+
+	return tk, ok
+}
+
+func (t *tickets) byThread(threadID string) (ticket, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var (
+		found ticket
+		ok    bool
+	)
+
+	if t.store != nil {
+		t.store.Range(func(_ string, tk ticket) bool {
+			found, ok = tk, tk.ThreadID == threadID
+			return !ok
+		})
+
+		return found, ok
+	}
+
+	for _, tk := range t.memory {
+		if tk.ThreadID == threadID {
+			return tk, true
+		}
+	}
+
+	return found, false
+}
+
+func (t *tickets) open(tk ticket) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.store != nil {
+		return t.store.Put(tk.UserID, tk)
+	}
+
+	t.memory[tk.UserID] = tk
+
+	return nil
+}
+
+func (t *tickets) close(tk ticket) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.store != nil {
+		return t.store.Delete(tk.UserID)
+	}
+
+	delete(t.memory, tk.UserID)
+
+	return nil
+}
+
+// Modmail relays direct messages sent to the bot to a ticket thread in the
+// staff forum channel, opening one for the member if need be.  Moderators
+// answer within the thread with `reply` (signed with their name) or
+// `areply` (anonymously), and `close` the ticket once done, archiving the
+// thread and keeping a transcript of it.
+func (h *Handler) Modmail(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author.Bot || m.Author.ID == s.State.User.ID {
+		return
+	}
+
+	if h.Settings.Modmail.ForumChannel == "" || h.tickets == nil {
+		return
+	}
+
+	if m.GuildID == "" && directMessage(s, m) {
+		h.modmailReceive(s, m)
+		return
+	}
+
+	tk, ok := h.tickets.byThread(m.ChannelID)
+	if !ok || m.Member == nil || h.Settings.ModRole == "" ||
+		!hasRole(m.Member, h.Settings.ModRole) {
+		return
+	}
+
+	command, text, _ := strings.Cut(m.Content, " ")
+
+	switch command {
+	case h.Settings.Prefix + "reply":
+		h.modmailReply(s, m, tk, strings.TrimSpace(text), false)
+	case h.Settings.Prefix + "areply":
+		h.modmailReply(s, m, tk, strings.TrimSpace(text), true)
+	case h.Settings.Prefix + "close":
+		h.modmailClose(s, m, tk, strings.TrimSpace(text))
+	}
+}
+
+// Relay the direct message of a member to their ticket, opening one if
+// they have none.
+func (h *Handler) modmailReceive(s *discordgo.Session, m *discordgo.MessageCreate) {
+	content := m.Content
+	for _, attachment := range m.Attachments {
+		content += "\n" + attachment.URL
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Description: event.TruncateDescription(content),
+		Color:       embedColorModmail,
+		Author: &discordgo.MessageEmbedAuthor{
+			Name:    m.Author.Username,
+			IconURL: m.Author.AvatarURL("256"),
+		},
+		Timestamp: m.Timestamp.Format(time.RFC3339),
+	}
+
+	if tk, ok := h.tickets.byUser(m.Author.ID); ok {
+		_, err := s.ChannelMessageSendEmbed(tk.ThreadID, embed)
+		if err == nil {
+			s.MessageReactionAdd(m.ChannelID, m.ID, "📨")
+			return
+		}
+		// The thread is gone (e.g., deleted by hand), so open a new one.
+		log.WithFields(log.Fields{
+			"user_id":       m.Author.ID,
+			"thread_id":     tk.ThreadID,
+			"error_message": err.Error(),
+		}).Warn("Unable to relay message to modmail ticket, opening a new one")
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{
+			Name:   "User",
+			Value:  fmt.Sprintf("%s (%s)", m.Author.Mention(), m.Author.ID),
+			Inline: true,
+		},
+	}
+
+	forum, err := s.State.Channel(h.Settings.Modmail.ForumChannel)
+	if err != nil {
+		forum, err = s.Channel(h.Settings.Modmail.ForumChannel)
+	}
+
+	if err == nil {
+		member, err := s.GuildMember(forum.GuildID, m.Author.ID)
+		if err == nil && member.CommunicationDisabledUntil != nil &&
+			member.CommunicationDisabledUntil.After(time.Now()) {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name: "Timed out",
+				Value: fmt.Sprintf(
+					"Until <t:%d:f>",
+					member.CommunicationDisabledUntil.Unix(),
+				),
+				Inline: true,
+			})
+		}
+	}
+
+	thread, err := s.ForumThreadStartComplex(
+		h.Settings.Modmail.ForumChannel,
+		&discordgo.ThreadStart{
+			Name: fmt.Sprintf("%s (%s)", m.Author.Username, m.Author.ID),
+		},
+		&discordgo.MessageSend{
+			Content: fmt.Sprintf(
+				"-# New ticket opened by %s. Answer with `%sreply <message>` (or `%sareply` to answer anonymously) and `%sclose [reason]` once done.",
+				m.Author.Mention(),
+				h.Settings.Prefix,
+				h.Settings.Prefix,
+				h.Settings.Prefix,
+			),
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:  ":envelope: Modmail ticket",
+					Color:  embedColorModmail,
+					Fields: fields,
+				},
+				embed,
+			},
+		},
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"user_id":       m.Author.ID,
+			"error_message": err.Error(),
+		}).Error("Unable to open modmail ticket")
+
+		s.ChannelMessageSendReply(
+			m.ChannelID,
+			"Sorry, your message could not be passed on to the moderators. Please try again later.",
+			m.Reference(),
+		)
+
+		return
+	}
+
+	err = h.tickets.open(ticket{
+		UserID:   m.Author.ID,
+		ThreadID: thread.ID,
+		Opened:   time.Now(),
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"user_id":       m.Author.ID,
+			"error_message": err.Error(),
+		}).Error("Unable to store modmail ticket")
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":   m.Author.ID,
+		"thread_id": thread.ID,
+	}).Info("Modmail ticket opened")
+
+	s.ChannelMessageSendReply(
+		m.ChannelID,
+		"Thanks, your message has been passed on to the moderators. Any further messages you send here will be added to your ticket, and you will be answered here.",
+		m.Reference(),
+	)
+}
+
+// Relay the reply of a moderator to the member of the ticket.
+func (h *Handler) modmailReply(
+	s *discordgo.Session,
+	m *discordgo.MessageCreate,
+	tk ticket,
+	text string,
+	anonymous bool,
+) {
+	if text == "" {
+		return
+	}
+
+	author := &discordgo.MessageEmbedAuthor{Name: "Moderators"}
+	if !anonymous {
+		author = &discordgo.MessageEmbedAuthor{
+			Name:    m.Author.Username + " (moderator)",
+			IconURL: m.Author.AvatarURL("256"),
+		}
+	}
+
+	channel, err := s.UserChannelCreate(tk.UserID)
+	if err == nil {
+		_, err = s.ChannelMessageSendEmbed(channel.ID, &discordgo.MessageEmbed{
+			Description: event.TruncateDescription(text),
+			Color:       embedColorFreeBSD,
+			Author:      author,
+		})
+	}
+
+	if err != nil {
+		s.ChannelMessageSendReply(
+			m.ChannelID,
+			"Unable to deliver the reply: "+err.Error(),
+			m.Reference(),
+		)
+
+		return
+	}
+
+	s.MessageReactionAdd(m.ChannelID, m.ID, "✅")
+}
+
+// Close the ticket, letting the member know, keeping a transcript of the
+// thread and archiving it.
+func (h *Handler) modmailClose(
+	s *discordgo.Session,
+	m *discordgo.MessageCreate,
+	tk ticket,
+	reason string,
+) {
+	if err := h.tickets.close(tk); err != nil {
+		log.WithFields(log.Fields{
+			"user_id":       tk.UserID,
+			"error_message": err.Error(),
+		}).Error("Unable to remove modmail ticket")
+	}
+
+	notice := "Your ticket has been closed by the moderators. Send another message to open a new one."
+	if reason != "" {
+		notice = fmt.Sprintf("Your ticket has been closed by the moderators (%s). Send another message to open a new one.", reason)
+	}
+
+	if channel, err := s.UserChannelCreate(tk.UserID); err == nil {
+		s.ChannelMessageSend(channel.ID, notice)
+	}
+
+	transcript, err := modmailTranscript(s, tk.ThreadID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"thread_id":     tk.ThreadID,
+			"error_message": err.Error(),
+		}).Error("Unable to fetch modmail transcript")
+	}
+
+	name := fmt.Sprintf("%s-%d.txt", tk.UserID, tk.Opened.Unix())
+
+	if h.Settings.Directory != "" && transcript != nil {
+		// Transcripts are always attached to the thread, and also kept in
+		// the storage directory encrypted with the storage key, if any.
+		path := filepath.Join(h.Settings.Directory, "modmail", name+".enc")
+
+		key, err := archive.Key(h.Settings.EncryptionKey)
+		if err == nil {
+			err = archive.WriteFile(path, transcript, key)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":          path,
+				"error_message": err.Error(),
+			}).Error("Unable to store modmail transcript")
+		}
+	}
+
+	message := &discordgo.MessageSend{
+		Content: fmt.Sprintf("-# Ticket closed by %s.", m.Author.Mention()),
+	}
+
+	if reason != "" {
+		message.Content = fmt.Sprintf("-# Ticket closed by %s (%s).", m.Author.Mention(), reason)
+	}
+
+	if transcript != nil {
+		message.Files = []*discordgo.File{{
+			Name:        name,
+			ContentType: "text/plain",
+			Reader:      bytes.NewReader(transcript),
+		}}
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, message)
+
+	archived, locked := true, true
+
+	_, err = s.ChannelEdit(tk.ThreadID, &discordgo.ChannelEdit{
+		Archived: &archived,
+		Locked:   &locked,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"thread_id":     tk.ThreadID,
+			"error_message": err.Error(),
+		}).Error("Unable to archive modmail ticket")
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":      tk.UserID,
+		"thread_id":    tk.ThreadID,
+		"moderator_id": m.Author.ID,
+	}).Info("Modmail ticket closed")
+}
+
+// Transcript of the ticket thread, oldest message first.  Messages relayed
+// from the member are embeds and are written as such.
+func modmailTranscript(s *discordgo.Session, threadID string) ([]byte, error) {
+	var (
+		messages []*discordgo.Message
+		before   string
+	)
+
+	for {
+		batch, err := s.ChannelMessages(threadID, transcriptBatch, before, "", "")
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, batch...)
+
+		if len(batch) < transcriptBatch {
+			break
+		}
+
+		before = batch[len(batch)-1].ID
+	}
+
+	slices.Reverse(messages)
+
+	var buf bytes.Buffer
+
+	for _, message := range messages {
+		author, content := message.Author.Username, message.Content
+
+		for _, embed := range message.Embeds {
+			if embed.Author != nil && embed.Description != "" {
+				author, content = embed.Author.Name, embed.Description
+			}
+		}
+
+		fmt.Fprintf(
+			&buf,
+			"[%s] %s: %s\n",
+			message.Timestamp.UTC().Format(time.DateTime),
+			author,
+			content,
+		)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Raid shows whether the server is in raid mode, or with `end` ends it,
+// restoring the settings changed upon entering it.  Only usable by
+// moderators.
+func (h *Handler) Raid(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author.Bot || m.Author.ID == s.State.User.ID {
+		return
+	}
+
+	args := strings.Fields(m.Content)
+	if len(args) == 0 || args[0] != h.Settings.Prefix+"raid" {
+		return
+	}
+
+	if m.Member == nil || h.Settings.ModRole == "" ||
+		!hasRole(m.Member, h.Settings.ModRole) {
+		return
+	}
+
+	if len(args) == 1 {
+		raid, ok := h.raid.Active(m.GuildID)
+		if !ok {
+			s.ChannelMessageSendReply(m.ChannelID, "Not in raid mode.", m.Reference())
+			return
+		}
+
+		s.ChannelMessageSendReply(m.ChannelID, fmt.Sprintf(
+			"In raid mode since <t:%d:R> (%d join(s), %d new account(s)), end it with `%sraid end`.",
+			raid.Started.Unix(),
+			raid.Joins,
+			raid.NewAccounts,
+			h.Settings.Prefix,
+		), m.Reference())
+
+		return
+	}
+
+	if args[1] != "end" {
+		return
+	}
+
+	// Raid mode being entered is ended once all of the settings have been
+	// changed, and the previous ones recorded, so that they are restored.
+	h.raid.Lock()
+	defer h.raid.Unlock()
+
+	raid, ok, err := h.raid.End(m.GuildID, time.Now())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"guild_id":      m.GuildID,
+			"error_message": err.Error(),
+		}).Error("Unable to remove stored raid mode")
+	}
+
+	if !ok {
+		s.ChannelMessageSendReply(m.ChannelID, "Not in raid mode.", m.Reference())
+		return
+	}
+
+	var (
+		reason = discordgo.WithAuditLogReason(
+			"Raid mode ended by " + m.Author.Username,
+		)
+		restored []string
+	)
+
+	if raid.VerificationLevel != nil {
+		level := discordgo.VerificationLevel(*raid.VerificationLevel)
+
+		_, err := s.GuildEdit(
+			m.GuildID,
+			&discordgo.GuildParams{VerificationLevel: &level},
+			reason,
+		)
+		if err != nil {
+			restored = append(restored, "~~Verification level~~ (failed)")
+		} else {
+			restored = append(restored, fmt.Sprintf("Verification level (%d)", level))
+		}
+	}
+
+	for id, rate := range raid.Slowmode {
+		_, err := s.ChannelEdit(
+			id,
+			&discordgo.ChannelEdit{RateLimitPerUser: &rate},
+			reason,
+		)
+		if err != nil {
+			restored = append(restored, fmt.Sprintf("~~Slowmode of <#%s>~~ (failed)", id))
+		} else {
+			restored = append(restored, fmt.Sprintf("Slowmode of <#%s>", id))
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"guild_id":   m.GuildID,
+		"user_id":    m.Author.ID,
+		"join_count": raid.Joins,
+	}).Info("Raid mode ended")
+
+	if len(restored) == 0 {
+		restored = append(restored, "None")
+	}
+
+	s.ChannelMessageSendEmbedReply(m.ChannelID, &discordgo.MessageEmbed{
+		Title: ":white_check_mark: Raid mode ended",
+		Description: fmt.Sprintf(
+			"-# Raid mode, entered <t:%d:R>, ended by %s.",
+			raid.Started.Unix(),
+			m.Author.Mention(),
+		),
+		Color: embedColorFreeBSD,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "Restored",
+				Value: strings.Join(restored, "\n"),
+			},
+		},
+	}, m.Reference())
+}
@@ -22,7 +22,8 @@ type roleAction struct {
 }
 
 func (h *Handler) Role(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if m.Author.Bot || m.Author.ID == s.State.User.ID {
+	// Direct messages have no guild to act upon.
+	if m.Author.Bot || m.Author.ID == s.State.User.ID || m.Member == nil {
 		return
 	}
 
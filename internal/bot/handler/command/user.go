@@ -4,13 +4,20 @@
 package command
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
+
+	"github.com/lcook/pulsar/internal/antispam"
 )
 
+// Number of offences shown in the user embed.
+const maxOffences int = 10
+
 func (h *Handler) User(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if m.Author.Bot || m.Author.ID == s.State.User.ID {
+	// Direct messages have no guild to act upon.
+	if m.Author.Bot || m.Author.ID == s.State.User.ID || m.Member == nil {
 		return
 	}
 
@@ -104,6 +111,15 @@ func (h *Handler) User(s *discordgo.Session, m *discordgo.MessageCreate) {
 		}
 	}
 
+	if h.offences != nil {
+		if history := h.offences.History(user.ID); len(history) > 0 {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  fmt.Sprintf("Offences (%d)", len(history)),
+				Value: antispam.Summarise(history, maxOffences),
+			})
+		}
+	}
+
 	s.ChannelMessageSendEmbedReply(
 		m.ChannelID,
 		&discordgo.MessageEmbed{
@@ -28,12 +28,17 @@ func messageMatchRegex(
 	return ""
 }
 
-//nolint:unused
 func directMessage(
 	session *discordgo.Session,
 	message *discordgo.MessageCreate,
 ) bool {
-	channel, _ := session.Channel(message.ChannelID)
+	channel, err := session.State.Channel(message.ChannelID)
+	if err != nil {
+		channel, err = session.Channel(message.ChannelID)
+		if err != nil {
+			return false
+		}
+	}
 
 	return channel.Type == discordgo.ChannelTypeDM
 }
@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+)
+
+// Outcome of an antispam action applied to a member.
+type actionResult struct {
+	action  antispam.Action
+	summary string
+	err     error
+}
+
+func (r *actionResult) String() string {
+	if r.err != nil {
+		return fmt.Sprintf("~~%s~~ (failed)", r.summary)
+	}
+
+	return r.summary
+}
+
+// Enforcement of a rule against a member.
+type enforcement struct {
+	// Outcome of each action.
+	results []actionResult
+	// Number of actions applied successfully.
+	applied int
+	// Number of previous offences the actions were planned for.
+	previous int
+	// Offence recorded, if any action was applied.
+	offence *antispam.Offence
+}
+
+// Summary of the outcome of each action.
+func (e *enforcement) summaries() []string {
+	summaries := make([]string, 0, len(e.results))
+	for idx := range e.results {
+		summaries = append(summaries, e.results[idx].String())
+	}
+
+	return summaries
+}
+
+// Whether the action was applied successfully.
+func (e *enforcement) applies(action antispam.ActionType) bool {
+	return slices.ContainsFunc(e.results, func(r actionResult) bool {
+		return r.action.Type == action && r.err == nil
+	})
+}
+
+// Enforce the rule against the member, applying the actions planned for
+// their offence (see HeuristicRule.Escalate) and recording it.  The logs
+// are marked as handled, so that they do not match again with later
+// messages whether or not they were deleted.
+func (h *Handler) enforce(
+	session *discordgo.Session,
+	guildID string,
+	user *discordgo.User,
+	logs []*antispam.Log,
+	rule *antispam.HeuristicRule,
+) enforcement {
+	var (
+		now      = time.Now()
+		previous = h.Offences.Count(user.ID, rule.Escalation.Window, now)
+		plan     = rule.Escalate(previous)
+		results  = make([]actionResult, 0, len(plan))
+		actions  = make([]string, 0, len(plan))
+		applied  int
+		offence  *antispam.Offence
+	)
+
+	for idx := range logs {
+		logs[idx].MarkHandled()
+	}
+
+	for _, action := range plan {
+		result := h.applyAction(session, guildID, user, logs, rule, action)
+		if result.err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "enforce(event): Unable to apply action to member",
+				Fields: log.Fields{
+					"user_id":       user.ID,
+					"heuristic_id":  rule.ID,
+					"action":        action.String(),
+					"error_message": result.err.Error(),
+				},
+			}
+		} else {
+			applied++
+
+			actions = append(actions, action.String())
+		}
+
+		results = append(results, result)
+	}
+
+	if applied > 0 {
+		offence = &antispam.Offence{
+			UserID:  user.ID,
+			Rule:    rule.ID,
+			Time:    now,
+			Actions: actions,
+		}
+
+		if err := h.Offences.Add(*offence); err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "enforce(event): Unable to record offence",
+				Fields: log.Fields{
+					"user_id":       user.ID,
+					"heuristic_id":  rule.ID,
+					"error_message": err.Error(),
+				},
+			}
+		}
+	}
+
+	return enforcement{
+		results:  results,
+		applied:  applied,
+		previous: previous,
+		offence:  offence,
+	}
+}
+
+func (h *Handler) applyAction(
+	session *discordgo.Session,
+	guildID string,
+	user *discordgo.User,
+	logs []*antispam.Log,
+	rule *antispam.HeuristicRule,
+	action antispam.Action,
+) actionResult {
+	var (
+		reason = discordgo.WithAuditLogReason(
+			fmt.Sprintf("Message violation (%s)", strings.ToLower(rule.ID)),
+		)
+		result = actionResult{action: action}
+	)
+
+	switch action.Type {
+	case antispam.ActionDelete:
+		deleted, channels, err := h.deleteLogs(session, logs)
+		result.summary = fmt.Sprintf(
+			"Deleted %d message(s) from %d channel(s)",
+			deleted,
+			channels,
+		)
+		// Only a delete removing nothing at all counts as failed, as the
+		// messages that were deleted can still be restored.
+		switch {
+		case deleted == 0 && err != nil:
+			result.err = err
+		case deleted == 0:
+			result.err = errors.New("no messages deleted")
+		case err != nil:
+			h.Errors <- HandlerChannel{
+				Message: "applyAction(event): Unable to delete some of the messages",
+				Fields: log.Fields{
+					"user_id":       user.ID,
+					"heuristic_id":  rule.ID,
+					"deleted":       deleted,
+					"error_message": err.Error(),
+				},
+			}
+		}
+	case antispam.ActionTimeout:
+		timeout := time.Now().Add(action.Duration)
+		result.summary = "Timed out for " + action.Duration.String()
+		result.err = session.GuildMemberTimeout(guildID, user.ID, &timeout, reason)
+	case antispam.ActionKick:
+		result.summary = "Kicked"
+		result.err = session.GuildMemberDelete(guildID, user.ID, reason)
+	case antispam.ActionBan:
+		result.summary = fmt.Sprintf(
+			"Banned (removing %d day(s) of messages)",
+			action.DeleteMessageDays,
+		)
+		result.err = session.GuildBanCreateWithReason(
+			guildID,
+			user.ID,
+			fmt.Sprintf("Message violation (%s)", strings.ToLower(rule.ID)),
+			action.DeleteMessageDays,
+		)
+	case antispam.ActionQuarantine:
+		result.summary = fmt.Sprintf("Assigned <@&%s> role", action.RoleID)
+		result.err = session.GuildMemberRoleAdd(
+			guildID,
+			user.ID,
+			action.RoleID,
+			reason,
+		)
+	case antispam.ActionDM:
+		result.summary = "Sent direct message"
+
+		channel, err := session.UserChannelCreate(user.ID)
+		if err != nil {
+			result.err = err
+			break
+		}
+
+		_, result.err = session.ChannelMessageSend(channel.ID, action.Message)
+	case antispam.ActionAlert:
+		result.summary = "Alerted moderators"
+	}
+
+	return result
+}
+
+// Delete the logged messages, marking them as such in the cache so that
+// the resulting delete events are not logged.  Returns the number of
+// messages deleted and channels they were deleted from, along with the
+// errors of channels they could not be deleted from.
+func (h *Handler) deleteLogs(
+	session *discordgo.Session,
+	logs []*antispam.Log,
+) (int, int, error) {
+	bucket := make(map[string][]string)
+
+	for idx := range logs {
+		log := logs[idx]
+		bucket[log.Message.ChannelID] = append(
+			bucket[log.Message.ChannelID],
+			log.Message.ID,
+		)
+	}
+
+	for idx := range logs {
+		if l, ok := h.Logs.Get(logs[idx].Message.ID); ok {
+			l.MarkDeleted()
+		}
+	}
+
+	var (
+		deleted int
+		errs    []error
+	)
+
+	for channel, ids := range bucket {
+		if err := session.ChannelMessagesBulkDelete(channel, ids); err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", channel, err))
+			continue
+		}
+
+		deleted += len(ids)
+	}
+
+	return deleted, len(bucket), errors.Join(errs...)
+}
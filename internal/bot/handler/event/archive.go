@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/archive"
+)
+
+// How often expired messages and attachments are pruned from the message
+// archive and attachment cache, and alert reviews past retention.
+const archivePruneInterval = time.Hour
+
+// Maximum number of files, and their total size, uploaded in a single
+// message.
+const (
+	maxUploadFiles int   = 10
+	maxUploadSize  int64 = 10 << 20
+)
+
+// Open the message archive and attachment cache in the storage directory,
+// as enabled, encrypted with the storage key.  Neither is kept in memory
+// instead, as the state cache already covers recent messages.
+func (h *Handler) openArchive() {
+	var (
+		settings = h.Settings.MessageArchive
+		err      error
+	)
+
+	if settings.Enabled() {
+		path := filepath.Join(h.Settings.Directory, "archive.jsonl")
+
+		h.Archive, err = archive.Open(settings, path, h.key)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":          path,
+				"error_message": err.Error(),
+			}).Warn("Unable to open message archive, logging from the state cache only")
+		}
+	}
+
+	if settings.Attachments.Enabled() {
+		path := filepath.Join(h.Settings.Directory, "attachments")
+
+		h.Files, err = archive.OpenAttachments(settings.Attachments, path, h.key)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":          path,
+				"error_message": err.Error(),
+			}).Warn("Unable to open attachment cache, attachments of deleted messages are not kept")
+		}
+	}
+}
+
+// Archive the message, if the message archive is enabled, so that edits
+// and deletions of it are logged once it is no longer held by the state
+// cache.
+func (h *Handler) archiveMessage(message *discordgo.Message) {
+	if h.Archive == nil || message.GuildID == "" || message.Author == nil {
+		return
+	}
+
+	if err := h.Archive.Put(message); err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "archiveMessage(event): Unable to archive message",
+			Fields: log.Fields{
+				"message_id":    message.ID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+}
+
+// Message as it was before being edited or deleted, from the state cache
+// or otherwise the message archive.
+func (h *Handler) archivedMessage(
+	before *discordgo.Message,
+	messageID string,
+) *discordgo.Message {
+	if before != nil || h.Archive == nil {
+		return before
+	}
+
+	if message, ok := h.Archive.Get(messageID); ok {
+		return message
+	}
+
+	return nil
+}
+
+func (h *Handler) unarchiveMessage(messageID string) {
+	if h.Archive == nil {
+		return
+	}
+
+	if err := h.Archive.Delete(messageID); err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "unarchiveMessage(event): Unable to remove archived message",
+			Fields: log.Fields{
+				"message_id":    messageID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+}
+
+func (h *Handler) pruneArchive() {
+	if h.Archive != nil {
+		pruned, err := h.Archive.Prune()
+		if err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "pruneArchive(event): Unable to prune message archive",
+				Fields: log.Fields{
+					"error_message": err.Error(),
+				},
+			}
+		} else {
+			log.WithFields(log.Fields{
+				"pruned":   pruned,
+				"archived": h.Archive.Len(),
+			}).Debug("Pruned expired messages from the message archive")
+		}
+	}
+
+	if h.Files != nil {
+		pruned, err := h.Files.Prune()
+		if err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "pruneArchive(event): Unable to prune attachment cache",
+				Fields: log.Fields{
+					"error_message": err.Error(),
+				},
+			}
+		} else {
+			log.WithFields(log.Fields{
+				"pruned": pruned,
+			}).Debug("Pruned expired attachments from the attachment cache")
+		}
+	}
+}
+
+// Download the attachments of the message in the background, if the
+// attachment cache is enabled and the channel not excluded, so that they
+// can be uploaded to the log channel once the message is deleted.
+func (h *Handler) fetchAttachments(
+	session *discordgo.Session,
+	message *discordgo.Message,
+) {
+	if h.Files == nil || len(message.Attachments) == 0 {
+		return
+	}
+
+	for _, id := range channelScope(session, message.ChannelID) {
+		if slices.Contains(h.Files.Settings.ExcludedChannelIDs, id) {
+			return
+		}
+	}
+	// Attachments of channels hidden from members are never logged.
+	if !canViewChannel(session, message.GuildID, message.ChannelID) {
+		return
+	}
+
+	// Uploading the attachments waits on the download, as a message may
+	// be removed by antispam as soon as it is sent.
+	done := make(chan struct{})
+	h.downloads.Store(message.ID, done)
+
+	h.wg.Go(func() {
+		defer func() {
+			h.downloads.Delete(message.ID)
+			close(done)
+		}()
+
+		cached, err := h.Files.Fetch(message)
+		if err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "fetchAttachments(event): Unable to cache attachment",
+				Fields: log.Fields{
+					"message_id":    message.ID,
+					"error_message": err.Error(),
+				},
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"message_id": message.ID,
+			"cached":     cached,
+		}).Trace("fetchAttachments: attachments cached")
+	})
+}
+
+// Upload the cached attachments of the messages to the log channel as
+// replies to the log message, removing them from the cache.
+func (h *Handler) uploadAttachments(
+	session *discordgo.Session,
+	reply *discordgo.Message,
+	messageIDs ...string,
+) {
+	if h.Files == nil {
+		return
+	}
+
+	var files []*discordgo.File
+
+	for _, id := range messageIDs {
+		if done, ok := h.downloads.Load(id); ok {
+			<-done.(chan struct{})
+		}
+
+		cached, err := h.Files.Files(id)
+		if err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "uploadAttachments(event): Unable to read cached attachment",
+				Fields: log.Fields{
+					"message_id":    id,
+					"error_message": err.Error(),
+				},
+			}
+		}
+
+		files = append(files, cached...)
+	}
+
+	for len(files) > 0 {
+		var (
+			count int
+			size  int64
+		)
+		// Split the files across as many messages as needed, though
+		// always uploading at least one file per message.
+		for count < len(files) && count < maxUploadFiles {
+			var length int64
+			if reader, ok := files[count].Reader.(interface{ Len() int }); ok {
+				length = int64(reader.Len())
+			}
+
+			if count > 0 && size+length > maxUploadSize {
+				break
+			}
+
+			size += length
+			count++
+		}
+
+		_, err := session.ChannelMessageSendComplex(h.Settings.LogChannel, &discordgo.MessageSend{
+			Files:     files[:count],
+			Reference: reply.Reference(),
+			Flags:     discordgo.MessageFlagsSuppressNotifications,
+		})
+		if err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "uploadAttachments(event): Unable to upload attachments",
+				Fields: log.Fields{
+					"message_id":    reply.ID,
+					"error_message": err.Error(),
+				},
+			}
+		}
+
+		files = files[count:]
+	}
+
+	h.removeAttachments(messageIDs...)
+}
+
+func (h *Handler) removeAttachments(messageIDs ...string) {
+	if h.Files == nil {
+		return
+	}
+
+	for _, id := range messageIDs {
+		if err := h.Files.Remove(id); err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "removeAttachments(event): Unable to remove cached attachments",
+				Fields: log.Fields{
+					"message_id":    id,
+					"error_message": err.Error(),
+				},
+			}
+		}
+	}
+}
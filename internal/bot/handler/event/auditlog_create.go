@@ -5,74 +5,183 @@ package event
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
 )
 
+// Audit log entry as logged: a single line describing it, along with any
+// fields detailing it.  Entries are always posted to the log channel, and
+// forwarded to the alert channel (pinging moderators, if set) when worth
+// the attention of moderators.
+type auditLog struct {
+	icon        string
+	description string
+	summary     string
+	color       int
+	fields      []*discordgo.MessageEmbedField
+	logFields   log.Fields
+	forward     bool
+	ping        bool
+}
+
+// Logged actions of the audit log.  Each describes an entry of the action
+// as any number of logs, with none meaning the entry is not logged (e.g.,
+// a member update changing nothing of interest).  Actions targeting users
+// have the user shown as the author of the embed.
+type auditLogEvent struct {
+	user     bool
+	describe func(*Handler, *discordgo.Session, *discordgo.GuildAuditLogEntryCreate) []auditLog
+}
+
+var auditLogEvents = map[discordgo.AuditLogAction]auditLogEvent{
+	discordgo.AuditLogActionMemberKick:             {true, auditMemberRemoved(":hammer:", "kicked")},
+	discordgo.AuditLogActionMemberBanAdd:           {true, auditMemberRemoved(":hammer:", "banned")},
+	discordgo.AuditLogActionMemberBanRemove:        {true, auditMemberUnbanned},
+	discordgo.AuditLogActionMemberUpdate:           {true, auditMemberUpdated},
+	discordgo.AuditLogActionMemberRoleUpdate:       {true, auditMemberRolesUpdated},
+	discordgo.AuditLogActionChannelCreate:          {false, auditChannel("created")},
+	discordgo.AuditLogActionChannelUpdate:          {false, auditChannel("updated")},
+	discordgo.AuditLogActionChannelDelete:          {false, auditChannel("deleted")},
+	discordgo.AuditLogActionChannelOverwriteCreate: {false, auditChannelOverwrite},
+	discordgo.AuditLogActionChannelOverwriteUpdate: {false, auditChannelOverwrite},
+	discordgo.AuditLogActionChannelOverwriteDelete: {false, auditChannelOverwrite},
+	discordgo.AuditLogActionWebhookCreate:          {false, auditWebhookCreated},
+}
+
+// Channel changes shown when a channel is created, updated or deleted,
+// with updates changing none of them not logged.
+var auditChannelKeys = []discordgo.AuditLogChangeKey{
+	discordgo.AuditLogChangeKeyName,
+	discordgo.AuditLogChangeKeyTopic,
+	discordgo.AuditLogChangeKeyNSFW,
+	discordgo.AuditLogChangeKeyRateLimitPerUser,
+}
+
+// Permissions making a role sensitive, on top of the moderator role and
+// those configured as such.
+const sensitivePermissions int64 = discordgo.PermissionAdministrator |
+	discordgo.PermissionManageGuild |
+	discordgo.PermissionManageRoles |
+	discordgo.PermissionManageChannels |
+	discordgo.PermissionManageWebhooks |
+	discordgo.PermissionBanMembers |
+	discordgo.PermissionKickMembers |
+	discordgo.PermissionModerateMembers
+
+// Names of permissions shown for permission overwrites, in order.
+var permissionNames = []struct {
+	permission int64
+	name       string
+}{
+	{discordgo.PermissionAdministrator, "Administrator"},
+	{discordgo.PermissionViewChannel, "View Channel"},
+	{discordgo.PermissionManageChannels, "Manage Channel"},
+	{discordgo.PermissionManageRoles, "Manage Permissions"},
+	{discordgo.PermissionManageWebhooks, "Manage Webhooks"},
+	{discordgo.PermissionCreateInstantInvite, "Create Invite"},
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionSendMessagesInThreads, "Send Messages in Threads"},
+	{discordgo.PermissionCreatePublicThreads, "Create Public Threads"},
+	{discordgo.PermissionCreatePrivateThreads, "Create Private Threads"},
+	{discordgo.PermissionEmbedLinks, "Embed Links"},
+	{discordgo.PermissionAttachFiles, "Attach Files"},
+	{discordgo.PermissionAddReactions, "Add Reactions"},
+	{discordgo.PermissionUseExternalEmojis, "Use External Emojis"},
+	{discordgo.PermissionUseExternalStickers, "Use External Stickers"},
+	{discordgo.PermissionMentionEveryone, "Mention Everyone"},
+	{discordgo.PermissionManageMessages, "Manage Messages"},
+	{discordgo.PermissionManageThreads, "Manage Threads"},
+	{discordgo.PermissionReadMessageHistory, "Read Message History"},
+	{discordgo.PermissionSendTTSMessages, "Send TTS Messages"},
+	{discordgo.PermissionSendVoiceMessages, "Send Voice Messages"},
+	{discordgo.PermissionSendPolls, "Create Polls"},
+	{discordgo.PermissionUseApplicationCommands, "Use Application Commands"},
+	{discordgo.PermissionVoiceConnect, "Connect"},
+	{discordgo.PermissionVoiceSpeak, "Speak"},
+	{discordgo.PermissionVoiceStreamVideo, "Video"},
+	{discordgo.PermissionVoiceMuteMembers, "Mute Members"},
+	{discordgo.PermissionVoiceDeafenMembers, "Deafen Members"},
+	{discordgo.PermissionVoiceMoveMembers, "Move Members"},
+}
+
 func (h *Handler) AuditLogCreate(
 	s *discordgo.Session,
 	e *discordgo.GuildAuditLogEntryCreate,
 ) {
-	var (
-		icon     = ":hammer:"
-		verb     string
-		duration time.Duration
-	)
+	if e.ActionType == nil {
+		return
+	}
 
-	switch *e.ActionType {
-	case discordgo.AuditLogActionMemberKick:
-		verb = "kicked"
-	case discordgo.AuditLogActionMemberBanAdd:
-		verb = "banned"
-	case discordgo.AuditLogActionMemberUpdate:
-		var found bool
-
-		for _, val := range e.Changes {
-			if *val.Key != discordgo.AuditLogChangeKeyCommunicationDisabledUntil ||
-				val.NewValue == nil {
-				continue
-			}
+	if *e.ActionType == discordgo.AuditLogActionMessageDelete {
+		h.auditMessageDeleted(s, e.AuditLogEntry)
+		return
+	}
 
-			value, err := time.Parse(time.RFC3339, val.NewValue.(string))
-			if err != nil {
-				continue
-			}
+	event, ok := auditLogEvents[*e.ActionType]
+	if !ok {
+		return
+	}
 
-			timestamp, err := discordgo.SnowflakeTimestamp(e.ID)
-			if err != nil {
-				continue
-			}
+	logs := event.describe(h, s, e)
+	if len(logs) == 0 {
+		return
+	}
 
-			duration = value.Sub(timestamp).Abs()
-			found = true
+	var user *discordgo.User
 
-			break
-		}
+	if event.user {
+		var err error
+
+		user, err = s.User(e.TargetID)
+		if err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "AuditLogCreate(event): Unable to fetch user information",
+				Fields: log.Fields{
+					"user_id":       e.TargetID,
+					"error_message": err.Error(),
+				},
+			}
 
-		if !found {
 			return
 		}
+	}
 
-		icon = ":mute:"
-		verb = "timed out"
-	default:
-		return
+	for idx := range logs {
+		h.sendAuditLog(s, e, user, &logs[idx])
 	}
+}
 
+func (h *Handler) sendAuditLog(
+	s *discordgo.Session,
+	e *discordgo.GuildAuditLogEntryCreate,
+	user *discordgo.User,
+	l *auditLog,
+) {
 	var (
-		fields    = make([]*discordgo.MessageEmbedField, 0, 2)
-		logFields = make([]log.Fields, 0, 2)
+		fields    = make([]*discordgo.MessageEmbedField, 0, len(l.fields)+2)
+		logFields = make([]log.Fields, 0, 3)
 	)
+	// Members changing their own nickname and so on are not moderators.
+	if e.UserID != "" && e.UserID != e.TargetID {
+		logFields = append(logFields, log.Fields{"moderator": e.UserID})
 
-	logFields = append(logFields, log.Fields{"moderator": e.UserID})
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Moderator",
+			Value:  fmt.Sprintf("<@!%s>", e.UserID),
+			Inline: true,
+		})
+	}
+
+	fields = append(fields, l.fields...)
 
-	fields = append(fields, &discordgo.MessageEmbedField{
-		Name:   "Moderator",
-		Value:  fmt.Sprintf("<@!%s>", e.UserID),
-		Inline: true,
-	})
+	if l.logFields != nil {
+		logFields = append(logFields, l.logFields)
+	}
 
 	if e.Reason != "" {
 		logFields = append(
@@ -87,25 +196,25 @@ func (h *Handler) AuditLogCreate(
 		})
 	}
 
-	if verb == "timed out" && duration > 0 {
-		logFields = append(
-			logFields,
-			log.Fields{"duration": duration.String()},
-		)
+	embed := &discordgo.MessageEmbed{
+		Description: fmt.Sprintf("%s **%s**", l.icon, l.description),
+		Color:       l.color,
+		Fields:      fields,
+	}
 
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Duration",
-			Value:  duration.String(),
-			Inline: true,
-		})
+	if user != nil {
+		embed.Author = &discordgo.MessageEmbedAuthor{
+			Name:    user.Username,
+			IconURL: user.AvatarURL("256"),
+		}
 	}
 
-	user, err := s.User(e.TargetID)
+	message, err := sendSilentEmbed(s, h.Settings.LogChannel, embed)
 	if err != nil {
 		h.Errors <- HandlerChannel{
-			Message: "AuditLogCreate(event): Unable to fetch user information",
+			Message: "AuditLogCreate(event): Unable to send message embed",
 			Fields: log.Fields{
-				"user_id":       e.TargetID,
+				"target_id":     e.TargetID,
 				"error_message": err.Error(),
 			},
 		}
@@ -113,42 +222,459 @@ func (h *Handler) AuditLogCreate(
 		return
 	}
 
-	message, err := sendSilentEmbed(
-		s,
-		h.Settings.LogChannel,
-		&discordgo.MessageEmbed{
-			Description: fmt.Sprintf(
-				"%s **User %s has been %s**",
-				icon,
-				user.Mention(),
-				verb,
-			),
-			Color: embedDeleteColor,
-			Author: &discordgo.MessageEmbedAuthor{
-				Name:    user.Username,
-				IconURL: user.AvatarURL("256"),
+	if user != nil {
+		logUser(
+			user,
+			log.WarnLevel,
+			"AuditLogCreate(event): "+l.summary,
+			logFields...,
+		)
+	} else {
+		entry := log.WithField("target_id", e.TargetID)
+		for _, fields := range logFields {
+			entry = entry.WithFields(fields)
+		}
+
+		entry.Warn("AuditLogCreate(event): " + l.summary)
+	}
+
+	if l.forward {
+		h.ForwardAlert(s, message, l.ping)
+	}
+}
+
+// Change of the entry to the key, if any.
+func auditChange(
+	e *discordgo.GuildAuditLogEntryCreate,
+	key discordgo.AuditLogChangeKey,
+) *discordgo.AuditLogChange {
+	for _, change := range e.Changes {
+		if change.Key != nil && *change.Key == key {
+			return change
+		}
+	}
+
+	return nil
+}
+
+// Value of a change as shown in embeds.
+func auditValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "none"
+	case string:
+		if v == "" {
+			return "none"
+		}
+
+		return v
+	case bool:
+		if v {
+			return "yes"
+		}
+
+		return "no"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func auditMemberRemoved(icon, verb string) func(
+	*Handler,
+	*discordgo.Session,
+	*discordgo.GuildAuditLogEntryCreate,
+) []auditLog {
+	return func(
+		_ *Handler,
+		_ *discordgo.Session,
+		e *discordgo.GuildAuditLogEntryCreate,
+	) []auditLog {
+		return []auditLog{{
+			icon:        icon,
+			description: fmt.Sprintf("User <@%s> has been %s", e.TargetID, verb),
+			summary:     "User " + verb,
+			color:       embedDeleteColor,
+			forward:     true,
+		}}
+	}
+}
+
+func auditMemberUnbanned(
+	_ *Handler,
+	_ *discordgo.Session,
+	e *discordgo.GuildAuditLogEntryCreate,
+) []auditLog {
+	return []auditLog{{
+		icon:        ":unlock:",
+		description: fmt.Sprintf("User <@%s> has been unbanned", e.TargetID),
+		summary:     "User unbanned",
+		color:       embedUpdateColor,
+		forward:     true,
+	}}
+}
+
+// Timeouts given or lifted early, and nickname changes, of a member.
+func auditMemberUpdated(
+	_ *Handler,
+	_ *discordgo.Session,
+	e *discordgo.GuildAuditLogEntryCreate,
+) []auditLog {
+	var logs []auditLog
+
+	if change := auditChange(e, discordgo.AuditLogChangeKeyCommunicationDisabledUntil); change != nil {
+		if until, ok := change.NewValue.(string); ok && until != "" {
+			value, err := time.Parse(time.RFC3339, until)
+			timestamp, serr := discordgo.SnowflakeTimestamp(e.ID)
+
+			if err == nil && serr == nil {
+				duration := value.Sub(timestamp).Abs().Round(time.Second)
+
+				logs = append(logs, auditLog{
+					icon:        ":mute:",
+					description: fmt.Sprintf("User <@%s> has been timed out", e.TargetID),
+					summary:     "User timed out",
+					color:       embedDeleteColor,
+					fields: []*discordgo.MessageEmbedField{{
+						Name:   "Duration",
+						Value:  duration.String(),
+						Inline: true,
+					}},
+					logFields: log.Fields{"duration": duration.String()},
+					forward:   true,
+				})
+			}
+		} else if change.OldValue != nil {
+			logs = append(logs, auditLog{
+				icon:        ":speaker:",
+				description: fmt.Sprintf("Timeout of user <@%s> has been removed", e.TargetID),
+				summary:     "User timeout removed",
+				color:       embedUpdateColor,
+				forward:     true,
+			})
+		}
+	}
+
+	if change := auditChange(e, discordgo.AuditLogChangeKeyNick); change != nil {
+		before, after := auditValue(change.OldValue), auditValue(change.NewValue)
+
+		logs = append(logs, auditLog{
+			icon:        ":label:",
+			description: fmt.Sprintf("Nickname of user <@%s> has been changed", e.TargetID),
+			summary:     "User nickname changed",
+			color:       embedUpdateColor,
+			fields: []*discordgo.MessageEmbedField{
+				{Name: "Before", Value: TruncateContent(before), Inline: true},
+				{Name: "After", Value: TruncateContent(after), Inline: true},
 			},
-			Fields: fields,
-		},
+			logFields: log.Fields{"before": before, "after": after},
+		})
+	}
+
+	return logs
+}
+
+// IDs of the partial roles of a role change.
+func auditRoles(change *discordgo.AuditLogChange) []string {
+	if change == nil {
+		return nil
+	}
+
+	values, _ := change.NewValue.([]any)
+
+	roles := make([]string, 0, len(values))
+	for _, value := range values {
+		if role, ok := value.(map[string]any); ok {
+			if id, ok := role["id"].(string); ok {
+				roles = append(roles, id)
+			}
+		}
+	}
+
+	return roles
+}
+
+// Whether the role is the moderator role, configured as sensitive or
+// grants any sensitive permissions.
+func (h *Handler) sensitiveRole(
+	s *discordgo.Session,
+	guildID, roleID string,
+) bool {
+	if roleID == h.Settings.ModRole || slices.Contains(h.Settings.SensitiveRoleIDs, roleID) {
+		return true
+	}
+
+	role, err := s.State.Role(guildID, roleID)
+
+	return err == nil && role.Permissions&sensitivePermissions != 0
+}
+
+// Roles granted to and revoked from a member, alerting moderators when
+// any of them are sensitive.
+func auditMemberRolesUpdated(
+	h *Handler,
+	s *discordgo.Session,
+	e *discordgo.GuildAuditLogEntryCreate,
+) []auditLog {
+	var (
+		granted   = auditRoles(auditChange(e, discordgo.AuditLogChangeKeyRoleAdd))
+		revoked   = auditRoles(auditChange(e, discordgo.AuditLogChangeKeyRoleRemove))
+		sensitive []string
 	)
-	if err != nil {
-		h.Errors <- HandlerChannel{
-			Message: "AuditLogCreate(event): Unable to send message embed",
-			Fields: log.Fields{
-				"message_id":    message.ID,
-				"error_message": err.Error(),
-			},
+
+	for _, id := range slices.Concat(granted, revoked) {
+		if h.sensitiveRole(s, e.GuildID, id) {
+			sensitive = append(sensitive, id)
 		}
+	}
+	// Self-assigned roles, and those applied by antispam, are granted by
+	// the bot and logged elsewhere, if at all.
+	if e.UserID == s.State.User.ID && len(sensitive) == 0 {
+		return nil
+	}
 
-		return
+	mentions := func(roles []string) string {
+		list := make([]string, 0, len(roles))
+		for _, id := range roles {
+			list = append(list, fmt.Sprintf("<@&%s>", id))
+		}
+
+		return TruncateContent(strings.Join(list, " "))
+	}
+
+	l := auditLog{
+		icon:        ":busts_in_silhouette:",
+		description: fmt.Sprintf("Roles of user <@%s> have been updated", e.TargetID),
+		summary:     "User roles updated",
+		color:       embedUpdateColor,
+		logFields: log.Fields{
+			"granted": strings.Join(granted, ","),
+			"revoked": strings.Join(revoked, ","),
+		},
 	}
 
-	logUser(
-		user,
-		log.WarnLevel,
-		fmt.Sprintf("AuditLogCreate(event): User %s", verb),
-		logFields...,
+	if len(granted) > 0 {
+		l.fields = append(l.fields, &discordgo.MessageEmbedField{
+			Name:   "Granted",
+			Value:  mentions(granted),
+			Inline: true,
+		})
+	}
+
+	if len(revoked) > 0 {
+		l.fields = append(l.fields, &discordgo.MessageEmbedField{
+			Name:   "Revoked",
+			Value:  mentions(revoked),
+			Inline: true,
+		})
+	}
+
+	if len(sensitive) > 0 {
+		l.icon = ":warning:"
+		l.color = embedDeleteColor
+		l.forward, l.ping = true, true
+
+		l.fields = append(l.fields, &discordgo.MessageEmbedField{
+			Name:  "Sensitive role(s)",
+			Value: mentions(sensitive),
+		})
+	}
+
+	return []auditLog{l}
+}
+
+func auditChannel(verb string) func(
+	*Handler,
+	*discordgo.Session,
+	*discordgo.GuildAuditLogEntryCreate,
+) []auditLog {
+	return func(
+		_ *Handler,
+		s *discordgo.Session,
+		e *discordgo.GuildAuditLogEntryCreate,
+	) []auditLog {
+		// Channels changed by the bot, i.e., slowmode applied and lifted
+		// by raid mode, are logged as part of raid mode instead.
+		if e.UserID == s.State.User.ID {
+			return nil
+		}
+
+		var changes []string
+
+		for _, key := range auditChannelKeys {
+			change := auditChange(e, key)
+			if change == nil {
+				continue
+			}
+
+			switch verb {
+			case "created":
+				changes = append(changes, fmt.Sprintf("%s: %s", key, auditValue(change.NewValue)))
+			case "deleted":
+				changes = append(changes, fmt.Sprintf("%s: %s", key, auditValue(change.OldValue)))
+			default:
+				changes = append(changes, fmt.Sprintf(
+					"%s: %s → %s",
+					key,
+					auditValue(change.OldValue),
+					auditValue(change.NewValue),
+				))
+			}
+		}
+
+		if len(changes) == 0 && verb == "updated" {
+			return nil
+		}
+
+		channel := fmt.Sprintf("<#%s>", e.TargetID)
+		// Deleted channels can no longer be mentioned.
+		if change := auditChange(e, discordgo.AuditLogChangeKeyName); verb == "deleted" && change != nil {
+			channel = "#" + auditValue(change.OldValue)
+		}
+
+		l := auditLog{
+			icon:        ":file_folder:",
+			description: fmt.Sprintf("Channel %s has been %s", channel, verb),
+			summary:     "Channel " + verb,
+			color:       embedUpdateColor,
+			logFields:   log.Fields{"channel_id": e.TargetID},
+		}
+
+		if verb == "deleted" {
+			l.color = embedDeleteColor
+		}
+
+		if len(changes) > 0 {
+			l.fields = []*discordgo.MessageEmbedField{{
+				Name:  "Changes",
+				Value: TruncateContent(strings.Join(changes, "\n")),
+			}}
+		}
+
+		return []auditLog{l}
+	}
+}
+
+// Permissions of a permission bitfield change.
+func auditPermissions(value any) int64 {
+	s, _ := value.(string)
+	permissions, _ := strconv.ParseInt(s, 10, 64)
+
+	return permissions
+}
+
+func permissionList(permissions int64) string {
+	var names []string
+
+	for _, p := range permissionNames {
+		if permissions&p.permission != 0 {
+			names = append(names, p.name)
+			permissions &^= p.permission
+		}
+	}
+
+	if permissions != 0 {
+		names = append(names, fmt.Sprintf("other (%#x)", permissions))
+	}
+
+	return TruncateContent(strings.Join(names, ", "))
+}
+
+// Permissions allowed, denied and reset by a permission overwrite of a
+// channel being created, updated or deleted.
+func auditChannelOverwrite(
+	_ *Handler,
+	s *discordgo.Session,
+	e *discordgo.GuildAuditLogEntryCreate,
+) []auditLog {
+	// As with channels, permissions changed by the bot are not logged.
+	if e.Options == nil || e.UserID == s.State.User.ID {
+		return nil
+	}
+
+	var oldAllow, newAllow, oldDeny, newDeny int64
+
+	if change := auditChange(e, discordgo.AuditLogChangeKeyAllow); change != nil {
+		oldAllow, newAllow = auditPermissions(change.OldValue), auditPermissions(change.NewValue)
+	}
+
+	if change := auditChange(e, discordgo.AuditLogChangeKeyDeny); change != nil {
+		oldDeny, newDeny = auditPermissions(change.OldValue), auditPermissions(change.NewValue)
+	}
+
+	var (
+		allowed = newAllow &^ oldAllow
+		denied  = newDeny &^ oldDeny
+		reset   = (oldAllow | oldDeny) &^ (newAllow | newDeny)
 	)
 
-	h.ForwardAlert(s, message, false)
+	if allowed|denied|reset == 0 {
+		return nil
+	}
+
+	subject := fmt.Sprintf("<@%s>", e.Options.ID)
+	if e.Options.Type != nil && *e.Options.Type == discordgo.AuditLogOptionsTypeRole {
+		subject = fmt.Sprintf("<@&%s>", e.Options.ID)
+		// The everyone role cannot be mentioned without pinging everyone
+		// (or showing up as such).
+		if e.Options.ID == e.GuildID {
+			subject = "@everyone"
+		}
+	}
+
+	l := auditLog{
+		icon: ":lock:",
+		description: fmt.Sprintf(
+			"Permissions of %s in <#%s> have been changed",
+			subject,
+			e.TargetID,
+		),
+		summary:   "Channel permissions changed",
+		color:     embedUpdateColor,
+		logFields: log.Fields{"channel_id": e.TargetID, "overwrite_id": e.Options.ID},
+	}
+
+	for _, field := range []struct {
+		name        string
+		permissions int64
+	}{
+		{"Allowed", allowed},
+		{"Denied", denied},
+		{"Reset", reset},
+	} {
+		if field.permissions != 0 {
+			l.fields = append(l.fields, &discordgo.MessageEmbedField{
+				Name:  field.name,
+				Value: permissionList(field.permissions),
+			})
+		}
+	}
+
+	return []auditLog{l}
+}
+
+func auditWebhookCreated(
+	_ *Handler,
+	_ *discordgo.Session,
+	e *discordgo.GuildAuditLogEntryCreate,
+) []auditLog {
+	var name, channelID string
+
+	if change := auditChange(e, discordgo.AuditLogChangeKeyName); change != nil {
+		name = auditValue(change.NewValue)
+	}
+
+	if change := auditChange(e, discordgo.AuditLogChangeKeyChannelID); change != nil {
+		channelID = auditValue(change.NewValue)
+	}
+
+	return []auditLog{{
+		icon:        ":link:",
+		description: fmt.Sprintf("Webhook %s has been created in <#%s>", name, channelID),
+		summary:     "Webhook created",
+		color:       embedUpdateColor,
+		logFields:   log.Fields{"webhook_id": e.TargetID, "channel_id": channelID},
+		forward:     true,
+	}}
 }
@@ -5,6 +5,7 @@ package event
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
@@ -31,6 +32,25 @@ func (h *Handler) AutoModExecution(
 		return
 	}
 
+	actions := []reviewAction{reviewBan, reviewKick, reviewFalsePositive}
+	if am.Content != "" && h.reviews.restorable() {
+		actions = append(actions, reviewRestore)
+	}
+
+	components := h.reviews.add(review{
+		GuildID:  am.GuildID,
+		UserID:   user.ID,
+		Username: user.Username,
+		Avatar:   user.Avatar,
+		Rule:     am.RuleID,
+		Actions:  actions,
+		Messages: []reviewMessage{{
+			ChannelID: am.ChannelID,
+			Content:   am.Content,
+			Timestamp: time.Now(),
+		}},
+	})
+
 	message, err := sendSilentEmbed(s, h.Settings.LogChannel,
 		&discordgo.MessageEmbed{
 			Title: fmt.Sprintf(":shield: AutoMod alert (%s)", am.RuleID),
@@ -51,6 +71,7 @@ func (h *Handler) AutoModExecution(
 				},
 			},
 		},
+		components...,
 	)
 	if err != nil {
 		h.Errors <- HandlerChannel{
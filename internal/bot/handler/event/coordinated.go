@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+)
+
+// Number of participants listed in coordinated spam log embeds.
+const maxParticipants int = 15
+
+// ProcessCoordinated applies the actions of a coordinated rule to every
+// member taking part, each only for their own messages, and reports them
+// all in a single log embed rather than one per member.  Members not
+// meeting the conditions of the rule are left out of the match (see
+// antispam.Run), and so are never acted on.
+func (h *Handler) ProcessCoordinated(
+	session *discordgo.Session,
+	message *discordgo.MessageCreate,
+	match *antispam.Match,
+) {
+	var (
+		users   []*discordgo.User
+		authors = make(map[string][]*antispam.Log)
+	)
+
+	for idx := range match.Logs {
+		author := match.Logs[idx].Message.Author
+		if _, ok := authors[author.ID]; !ok {
+			users = append(users, author)
+		}
+
+		authors[author.ID] = append(authors[author.ID], match.Logs[idx])
+	}
+
+	var (
+		channels     = logChannels(match.Logs)
+		participants = make([]string, 0, min(len(users), maxParticipants)+1)
+		applied      int
+		deleted      bool
+	)
+
+	for idx, user := range users {
+		enforced := h.enforce(
+			session,
+			message.GuildID,
+			user,
+			authors[user.ID],
+			match.Rule,
+		)
+		applied += enforced.applied
+		deleted = deleted || enforced.applies(antispam.ActionDelete)
+
+		if idx < maxParticipants {
+			participants = append(participants, fmt.Sprintf(
+				"%s: %s",
+				user.Mention(),
+				strings.Join(enforced.summaries(), ", "),
+			))
+		}
+	}
+
+	if omitted := len(users) - maxParticipants; omitted > 0 {
+		participants = append(
+			participants,
+			fmt.Sprintf("-# %d more participant(s)", omitted),
+		)
+	}
+
+	logUser(
+		message.Author,
+		log.WarnLevel,
+		"ProcessCoordinated(event): Actions applied to members for coordinated spam",
+		log.Fields{
+			"message_count":     len(match.Logs),
+			"channel_count":     len(channels),
+			"participant_count": len(users),
+			"heuristic_id":      match.Rule.ID,
+		},
+	)
+
+	if applied == 0 ||
+		!canViewChannel(session, message.GuildID, message.ChannelID) {
+		return
+	}
+
+	embed, err := sendSilentEmbed(session, h.Settings.LogChannel,
+		&discordgo.MessageEmbed{
+			Title: fmt.Sprintf(
+				":rotating_light: Coordinated spam detected (%s)",
+				strings.ToLower(match.Rule.ID),
+			),
+			Description: fmt.Sprintf(
+				"-# Attention: %d message(s) from %d channel(s) sent by %d user(s) flagged as a suspected coordinated spam/raid with the same content.",
+				len(match.Logs),
+				len(channels),
+				len(users),
+			),
+			Color: embedDeleteColor,
+			Fields: []*discordgo.MessageEmbedField{
+				{
+					Name: "Content",
+					Value: buildContentField(
+						message.Content,
+						message.Attachments,
+						message.StickerItems,
+					),
+					Inline: true,
+				},
+				{
+					Name:   "Channel(s)",
+					Value:  strings.Join(channels, " "),
+					Inline: true,
+				},
+				{
+					Name:  fmt.Sprintf("Participant(s) (%d)", len(users)),
+					Value: TruncateContent(strings.Join(participants, "\n")),
+				},
+			},
+		},
+	)
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "ProcessCoordinated(event): Unable to send message embed",
+			Fields: log.Fields{
+				"heuristic_id":  match.Rule.ID,
+				"error_message": err.Error(),
+			},
+		}
+
+		return
+	}
+
+	h.ForwardAlert(session, embed, true)
+
+	// With the messages sharing the same content, the attachments of the
+	// one triggering the rule stand for those of all of them.
+	if deleted {
+		h.uploadAttachments(session, embed, message.ID)
+		h.removeAttachments(logIDs(match.Logs)...)
+	}
+}
@@ -5,13 +5,16 @@ package event
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/lcook/pulsar/internal/antispam"
+	"github.com/lcook/pulsar/internal/archive"
 	"github.com/lcook/pulsar/internal/cache"
 	"github.com/lcook/pulsar/internal/config"
 )
@@ -21,6 +24,9 @@ const (
 	embedUpdateColor int = 0x268BD2
 )
 
+// Number of offences shown in antispam log embeds.
+const maxOffences int = 5
+
 type HandlerChannel struct {
 	Message string
 	Fields  log.Fields
@@ -29,24 +35,158 @@ type HandlerChannel struct {
 type Handler struct {
 	Settings config.Settings
 	Events   []any
-	Logs     *cache.RingBuffer[antispam.Log]
+	Logs     *cache.Index[antispam.Log]
+	Links    *antispam.LinkList
+	Counter  *antispam.MessageCounter
+	Offences *antispam.Offences
+	Raid     *antispam.RaidMonitor
+	Archive  *archive.Archive
+	Files    *archive.Attachments
 	Errors   chan HandlerChannel
+
+	key           []byte
+	shadow        *shadowReports
+	impersonation *impersonationChecks
+	reviews       *reviews
+	deletions     *deleteAudits
+	downloads     sync.Map
+	stop          chan struct{}
+	wg            sync.WaitGroup
 }
 
-func New(settings config.Settings, buffer uint64) *Handler {
+func New(settings config.Settings, buffer int) *Handler {
 	h := &Handler{
 		Settings: settings,
-		Logs:     cache.NewRingBuffer[antispam.Log](buffer),
+		Logs:     antispam.NewCache(buffer),
 		Errors:   make(chan HandlerChannel),
+
+		impersonation: newImpersonationChecks(),
+		deletions:     newDeleteAudits(),
+	}
+
+	if settings.LinkList != "" {
+		links, err := antispam.OpenLinkList(settings.LinkList)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":          settings.LinkList,
+				"error_message": err.Error(),
+			}).Warn("Unable to open antispam link list")
+		}
+
+		h.Links = links
+	}
+
+	var counts string
+	if settings.Directory != "" {
+		counts = filepath.Join(settings.Directory, "messages.jsonl")
+	}
+
+	counter, err := antispam.NewMessageCounter(settings.Rules, counts)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":          counts,
+			"error_message": err.Error(),
+		}).Warn("Unable to open antispam message counts, counting in memory")
+		// Without a counter every member would appear to have sent no
+		// messages at all, so fall back to counting from now on.
+		counter, _ = antispam.NewMessageCounter(settings.Rules, "")
+	}
+
+	h.Counter = counter
+
+	var offences string
+	if settings.Directory != "" {
+		offences = filepath.Join(settings.Directory, "offences.jsonl")
+	}
+
+	h.Offences, err = antispam.OpenOffences(offences)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":          offences,
+			"error_message": err.Error(),
+		}).Warn("Unable to open antispam offence history, keeping it in memory")
+
+		h.Offences, _ = antispam.OpenOffences("")
+	}
+
+	var shadow string
+	if settings.Directory != "" {
+		shadow = filepath.Join(settings.Directory, "shadow.jsonl")
+	}
+
+	h.shadow, err = openShadowReports(shadow)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":          shadow,
+			"error_message": err.Error(),
+		}).Warn("Unable to open shadow rule match counts, counting in memory")
+
+		h.shadow, _ = openShadowReports("")
+	}
+
+	if settings.Raid.Enabled() {
+		var raids string
+		if settings.Directory != "" {
+			raids = filepath.Join(settings.Directory, "raid.jsonl")
+		}
+
+		h.Raid, err = antispam.NewRaidMonitor(settings.Raid, raids)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":          raids,
+				"error_message": err.Error(),
+			}).Warn("Unable to open antispam raid mode, keeping it in memory")
+
+			h.Raid, _ = antispam.NewRaidMonitor(settings.Raid, "")
+		}
 	}
 
+	if settings.Directory != "" {
+		h.key, err = archive.Key(settings.EncryptionKey)
+		if err != nil {
+			// Message content is only ever written to disk encrypted, so
+			// everything holding it is left out (or, for the antispam
+			// snapshot, stripped of it) without a key.
+			log.WithFields(log.Fields{
+				"environment":   archive.KeyEnv,
+				"error_message": err.Error(),
+			}).Warn("Unable to load storage encryption key, the message archive, attachment cache and restoring messages from alerts are disabled, and antispam snapshots leave out message content")
+		}
+	}
+
+	var reviews string
+	if settings.Directory != "" {
+		reviews = filepath.Join(settings.Directory, "reviews.jsonl")
+	}
+
+	h.reviews, err = openReviews(reviews, h.key)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":          reviews,
+			"error_message": err.Error(),
+		}).Warn("Unable to open alert reviews, keeping them in memory")
+
+		h.reviews, _ = openReviews("", nil)
+	}
+
+	if h.key != nil {
+		h.openArchive()
+	}
+
+	h.restore()
+
 	h.Events = append(h.Events, h.MessageCreate)
 	h.Events = append(h.Events, h.MessageDelete)
+	h.Events = append(h.Events, h.MessageDeleteBulk)
 	h.Events = append(h.Events, h.MessageUpdate)
+	h.Events = append(h.Events, h.GuildCreate)
+	h.Events = append(h.Events, h.GuildMembersChunk)
 	h.Events = append(h.Events, h.GuildMemberAdd)
+	h.Events = append(h.Events, h.GuildMemberUpdate)
 	h.Events = append(h.Events, h.GuildMemberRemove)
 	h.Events = append(h.Events, h.AutoModExecution)
 	h.Events = append(h.Events, h.AuditLogCreate)
+	h.Events = append(h.Events, h.InteractionCreate)
 
 	return h
 }
@@ -57,64 +197,17 @@ func (h *Handler) ProcessSpam(
 	logs []*antispam.Log,
 	rule *antispam.HeuristicRule,
 ) {
-	timeout := time.Now().Add(rule.Timeout)
-
-	if err := session.GuildMemberTimeout(
-		message.GuildID,
-		message.Author.ID,
-		&timeout,
-		discordgo.WithAuditLogReason(
-			fmt.Sprintf(
-				"Message violation (%s)",
-				strings.ToLower(rule.ID),
-			),
-		),
-	); err != nil {
-		h.Errors <- HandlerChannel{
-			Message: "ProcessSpam(event): Unable to apply timeout to member",
-			Fields: log.Fields{
-				"user_id":       message.Author.ID,
-				"heuristic_id":  rule.ID,
-				"timeout":       timeout.String(),
-				"error_message": err.Error(),
-			},
-		}
-
-		return
-	}
-
-	bucket := make(map[string][]string)
-
-	for idx := range logs {
-		log := logs[idx]
-		bucket[log.Message.ChannelID] = append(
-			bucket[log.Message.ChannelID],
-			log.Message.ID,
+	var (
+		enforced = h.enforce(
+			session,
+			message.GuildID,
+			message.Author,
+			logs,
+			rule,
 		)
-	}
-
-	h.Logs.ForEach(func(l *antispam.Log) {
-		for idx := range logs {
-			log := logs[idx]
-			if l.Message.ID == log.Message.ID {
-				l.MarkDeleted()
-				break
-			}
-		}
-	})
-
-	var deleted int
-
-	for channel, ids := range bucket {
-		if err := session.ChannelMessagesBulkDelete(channel, ids); err == nil {
-			deleted += len(ids)
-		}
-	}
-
-	channels := make([]string, 0, len(bucket))
-	for channel := range bucket {
-		channels = append(channels, fmt.Sprintf("<#%s>", channel))
-	}
+		channels  = logChannels(logs)
+		summaries = enforced.summaries()
+	)
 
 	var fields []*discordgo.MessageEmbedField
 
@@ -130,38 +223,88 @@ func (h *Handler) ProcessSpam(
 		})
 	}
 
+	var flagged []string
+
+	for idx := range logs {
+		for _, host := range logs[idx].Flagged() {
+			if !slices.Contains(flagged, host) {
+				flagged = append(flagged, host)
+			}
+		}
+	}
+
+	if len(flagged) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Link(s)",
+			Value:  TruncateContent(strings.Join(flagged, "\n")),
+			Inline: true,
+		})
+	}
+
 	fields = append(fields, &discordgo.MessageEmbedField{
 		Name:   "Channel(s)",
 		Value:  strings.Join(channels, " "),
 		Inline: true,
 	})
 
+	fields = append(fields, &discordgo.MessageEmbedField{
+		Name:  "Action(s)",
+		Value: strings.Join(summaries, "\n"),
+	})
+
+	if history := h.Offences.History(message.Author.ID); len(history) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("Offence(s) (%d)", len(history)),
+			Value: antispam.Summarise(history, maxOffences),
+		})
+	}
+
 	logUser(
 		message.Author,
 		log.WarnLevel,
-		"ProcessSpam(event): Member timed out and messages deleted for triggering antispam",
+		"ProcessSpam(event): Actions applied to member for triggering antispam",
 		log.Fields{
-			"deleted_count": deleted,
+			"message_count": len(logs),
 			"channel_count": len(channels),
 			"heuristic_id":  rule.ID,
-			"timeout":       rule.Timeout.String(),
+			"offences":      enforced.previous + 1,
+			"actions":       strings.Join(summaries, ", "),
 		},
 	)
 
-	if deleted > 1 &&
+	if enforced.applied > 0 &&
 		canViewChannel(session, message.GuildID, message.ChannelID) {
-		message, err := sendSilentEmbed(session, h.Settings.LogChannel,
+		actions := []reviewAction{reviewBan, reviewKick, reviewFalsePositive}
+		if enforced.applies(antispam.ActionTimeout) {
+			actions = append([]reviewAction{reviewLiftTimeout}, actions...)
+		}
+
+		if enforced.applies(antispam.ActionDelete) && h.reviews.restorable() {
+			actions = append(actions, reviewRestore)
+		}
+
+		components := h.reviews.add(review{
+			GuildID:  message.GuildID,
+			UserID:   message.Author.ID,
+			Username: message.Author.Username,
+			Avatar:   message.Author.Avatar,
+			Rule:     rule.ID,
+			Actions:  actions,
+			Offence:  enforced.offence,
+			Messages: reviewMessages(logs),
+		})
+
+		embed, err := sendSilentEmbed(session, h.Settings.LogChannel,
 			&discordgo.MessageEmbed{
 				Title: fmt.Sprintf(
 					":shield: Message violation triggered (%s)",
 					strings.ToLower(rule.ID),
 				),
 				Description: fmt.Sprintf(
-					"-# Attention: %d message(s) automatically removed from %d channel(s) due to suspected spam/phishing with potential malicious content. The user (%s) has been timed out for %s.",
-					deleted,
+					"-# Attention: %d message(s) from %d channel(s) sent by the user (%s) flagged due to suspected spam/phishing with potential malicious content.",
+					len(logs),
 					len(channels),
 					message.Author.Mention(),
-					rule.Timeout.String(),
 				),
 				Color: embedDeleteColor,
 				Author: &discordgo.MessageEmbedAuthor{
@@ -170,6 +313,7 @@ func (h *Handler) ProcessSpam(
 				},
 				Fields: fields,
 			},
+			components...,
 		)
 		if err != nil {
 			h.Errors <- HandlerChannel{
@@ -183,7 +327,11 @@ func (h *Handler) ProcessSpam(
 			return
 		}
 
-		h.ForwardAlert(session, message, true)
+		h.ForwardAlert(session, embed, true)
+
+		if enforced.applies(antispam.ActionDelete) {
+			h.uploadAttachments(session, embed, logIDs(logs)...)
+		}
 	}
 }
 
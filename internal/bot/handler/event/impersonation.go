@@ -0,0 +1,282 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+)
+
+// How long the staff members of a guild are kept for before being listed
+// from the state cache again.  Changes to staff members are picked up from
+// member events in the meantime.
+const staffRefreshInterval time.Duration = 10 * time.Minute
+
+// Identities of the staff members of each guild, along with the members
+// reported as impersonating them (or a protected name) so that further
+// updates of the member not changing their identity are not reported
+// over and over.
+type impersonationChecks struct {
+	mu       sync.Mutex
+	staff    map[string]map[string]antispam.Identity
+	listed   map[string]time.Time
+	reported map[string]string
+}
+
+func newImpersonationChecks() *impersonationChecks {
+	return &impersonationChecks{
+		staff:    make(map[string]map[string]antispam.Identity),
+		listed:   make(map[string]time.Time),
+		reported: make(map[string]string),
+	}
+}
+
+// Key identifying the names and avatars of a member.
+func identityKey(identity antispam.Identity) string {
+	return strings.Join(identity.Names, "\x00") + "\x01" +
+		strings.Join(identity.Avatars, "\x00")
+}
+
+func (h *Handler) isStaff(member *discordgo.Member) bool {
+	return member.User != nil && slices.ContainsFunc(member.Roles, func(id string) bool {
+		return slices.Contains(h.Settings.Impersonation.StaffRoleIDs, id)
+	})
+}
+
+// Identities of the members of the guild holding any of the staff roles,
+// listed from the members held by the state cache.
+func (h *Handler) staffIdentities(
+	session *discordgo.Session,
+	guildID string,
+) []antispam.Identity {
+	if len(h.Settings.Impersonation.StaffRoleIDs) == 0 {
+		return nil
+	}
+
+	c := h.impersonation
+
+	c.mu.Lock()
+	_, ok := c.staff[guildID]
+	fresh := time.Since(c.listed[guildID]) < staffRefreshInterval
+	c.mu.Unlock()
+	// Listed without holding the lock, so that checks of other members
+	// are not held up meanwhile.
+	if !ok || !fresh {
+		staff, err := h.listStaff(session, guildID)
+		if err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "staffIdentities(event): Unable to list guild members",
+				Fields: log.Fields{
+					"guild_id":      guildID,
+					"error_message": err.Error(),
+				},
+			}
+		} else {
+			c.mu.Lock()
+			c.staff[guildID] = staff
+			c.listed[guildID] = time.Now()
+			c.mu.Unlock()
+		}
+	}
+	// Falling back to the staff listed last time, if any, rather than have
+	// every name pass unchecked.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	identities := make([]antispam.Identity, 0, len(c.staff[guildID]))
+	for _, identity := range c.staff[guildID] {
+		identities = append(identities, identity)
+	}
+
+	return identities
+}
+
+// List the staff members of the guild held by the state cache, which is
+// filled in with every member once requested on joining the guild (see
+// GuildCreate).
+func (h *Handler) listStaff(
+	session *discordgo.Session,
+	guildID string,
+) (map[string]antispam.Identity, error) {
+	guild, err := session.State.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.State.RLock()
+	defer session.State.RUnlock()
+
+	staff := make(map[string]antispam.Identity)
+
+	for _, member := range guild.Members {
+		if h.isStaff(member) {
+			staff[member.User.ID] = antispam.NewIdentity(member)
+		}
+	}
+
+	return staff, nil
+}
+
+// Keep the staff members of the guild up to date with the member joining,
+// being updated or, given a nil member, leaving.
+func (h *Handler) updateStaff(guildID, userID string, member *discordgo.Member) {
+	c := h.impersonation
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	staff, ok := c.staff[guildID]
+	if !ok {
+		return
+	}
+
+	if member != nil && h.isStaff(member) {
+		staff[userID] = antispam.NewIdentity(member)
+	} else {
+		delete(staff, userID)
+	}
+}
+
+// GuildCreate requests every member of the guild, once joined, so that
+// the state cache holds the staff members checked against for
+// impersonation.
+func (h *Handler) GuildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
+	if len(h.Settings.Impersonation.StaffRoleIDs) == 0 {
+		return
+	}
+
+	if err := s.RequestGuildMembers(g.ID, "", 0, "", false); err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "GuildCreate(event): Unable to request guild members",
+			Fields: log.Fields{
+				"guild_id":      g.ID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+}
+
+// GuildMembersChunk has the staff members of the guild listed again once
+// every member requested has been received.
+func (h *Handler) GuildMembersChunk(_ *discordgo.Session, c *discordgo.GuildMembersChunk) {
+	if c.ChunkIndex != c.ChunkCount-1 {
+		return
+	}
+
+	h.impersonation.mu.Lock()
+	delete(h.impersonation.listed, c.GuildID)
+	h.impersonation.mu.Unlock()
+}
+
+// Check whether the member impersonates a protected name or staff member,
+// alerting moderators and applying the configured actions if so.
+func (h *Handler) checkImpersonation(
+	session *discordgo.Session,
+	guildID string,
+	member *discordgo.Member,
+) {
+	settings := &h.Settings.Impersonation
+	if !settings.Enabled() || member.User == nil || member.User.Bot {
+		return
+	}
+
+	for _, id := range h.Settings.ExcludedRoleIDs {
+		if slices.Contains(member.Roles, id) {
+			return
+		}
+	}
+
+	var (
+		identity      = antispam.NewIdentity(member)
+		key           = identityKey(identity)
+		impersonation = settings.Impersonates(
+			identity,
+			h.staffIdentities(session, guildID),
+		)
+	)
+
+	h.impersonation.mu.Lock()
+	if impersonation == nil || h.impersonation.reported[member.User.ID] == key {
+		if impersonation == nil {
+			delete(h.impersonation.reported, member.User.ID)
+		}
+
+		h.impersonation.mu.Unlock()
+
+		return
+	}
+
+	h.impersonation.reported[member.User.ID] = key
+	h.impersonation.mu.Unlock()
+
+	fields := []*discordgo.MessageEmbedField{
+		{
+			Name:  "Match",
+			Value: impersonation.String(),
+		},
+	}
+
+	if len(settings.Actions) > 0 {
+		enforced := h.enforce(
+			session,
+			guildID,
+			member.User,
+			nil,
+			&antispam.HeuristicRule{ID: antispam.ImpersonationRule, Actions: settings.Actions},
+		)
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Action(s)",
+			Value: strings.Join(enforced.summaries(), "\n"),
+		})
+	}
+
+	logUser(
+		member.User,
+		log.WarnLevel,
+		"checkImpersonation(event): Suspected impersonation by member",
+		log.Fields{
+			"name":       impersonation.Name,
+			"target":     impersonation.Target,
+			"similarity": fmt.Sprintf("%.2f", impersonation.Similarity),
+		},
+	)
+
+	message, err := sendSilentEmbed(session, h.Settings.LogChannel,
+		&discordgo.MessageEmbed{
+			Title: ":performing_arts: Suspected impersonation",
+			Description: fmt.Sprintf(
+				"-# Attention: User %s goes by a name or avatar resembling that of staff or a protected name. This might be a scam account - exercise caution.",
+				member.Mention(),
+			),
+			Color: embedUpdateColor,
+			Author: &discordgo.MessageEmbedAuthor{
+				Name:    member.User.Username,
+				IconURL: member.AvatarURL("256"),
+			},
+			Fields: fields,
+		},
+	)
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "checkImpersonation(event): Unable to send message embed",
+			Fields: log.Fields{
+				"user_id":       member.User.ID,
+				"error_message": err.Error(),
+			},
+		}
+
+		return
+	}
+
+	h.ForwardAlert(session, message, true)
+}
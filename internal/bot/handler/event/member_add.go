@@ -18,6 +18,15 @@ func (h *Handler) GuildMemberAdd(
 
 	created, _ := discordgo.SnowflakeTimestamp(m.User.ID)
 
+	if raid := h.Raid.Join(m.GuildID, m.User.ID, created, m.JoinedAt); raid != nil {
+		h.enterRaid(s, raid)
+	} else if _, ok := h.Raid.Active(m.GuildID); ok && h.Raid.Settings.Timeout > 0 {
+		h.timeoutRaider(s, m.GuildID, m.User.ID)
+	}
+
+	h.updateStaff(m.GuildID, m.User.ID, m.Member)
+	h.checkImpersonation(s, m.GuildID, m.Member)
+
 	age := m.JoinedAt.UTC().Sub(created.UTC())
 
 	if age <= h.Settings.MinumumAccountAge {
@@ -27,6 +36,15 @@ func (h *Handler) GuildMemberAdd(
 			"GuildMemberAdd(event): Suspected spam or advertising account joined",
 		)
 
+		components := h.reviews.add(review{
+			GuildID:  m.GuildID,
+			UserID:   m.User.ID,
+			Username: m.User.Username,
+			Avatar:   m.User.Avatar,
+			Rule:     "NEW_ACCOUNT",
+			Actions:  []reviewAction{reviewBan, reviewKick, reviewFalsePositive},
+		})
+
 		message, err := sendSilentEmbed(
 			s,
 			h.Settings.LogChannel,
@@ -43,6 +61,7 @@ func (h *Handler) GuildMemberAdd(
 					IconURL: m.User.AvatarURL("256"),
 				},
 			},
+			components...,
 		)
 		if err != nil {
 			h.Errors <- HandlerChannel{
@@ -17,4 +17,6 @@ func (h *Handler) GuildMemberRemove(
 	}
 
 	logUser(m.User, log.DebugLevel, "GuildMemberRemove(event): Member left")
+
+	h.updateStaff(m.GuildID, m.User.ID, nil)
 }
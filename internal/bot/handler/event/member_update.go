@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+)
+
+func (h *Handler) GuildMemberUpdate(
+	s *discordgo.Session,
+	m *discordgo.GuildMemberUpdate,
+) {
+	if m.Member == nil || m.User == nil {
+		return
+	}
+
+	h.updateStaff(m.GuildID, m.User.ID, m.Member)
+	// Most updates are of roles and the like, leaving nothing new to check
+	// where the member was known beforehand.
+	if m.BeforeUpdate != nil && m.BeforeUpdate.User != nil {
+		before, after := antispam.NewIdentity(m.BeforeUpdate), antispam.NewIdentity(m.Member)
+		if slices.Equal(before.Names, after.Names) &&
+			slices.Equal(before.Avatars, after.Avatars) {
+			return
+		}
+	}
+
+	logUser(m.User, log.TraceLevel, "GuildMemberUpdate(event): Member updated")
+
+	h.checkImpersonation(s, m.GuildID, m.Member)
+}
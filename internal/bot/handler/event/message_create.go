@@ -26,6 +26,9 @@ func (h *Handler) MessageCreate(
 		return
 	}
 
+	h.archiveMessage(m.Message)
+	h.fetchAttachments(s, m.Message)
+
 	if !h.Settings.Enabled {
 		return
 	}
@@ -55,19 +58,39 @@ func (h *Handler) MessageCreate(
 
 	hash := hashContent(content.String())
 
-	h.Logs.Add(antispam.Log{Message: m.Message, Hash: hash})
+	h.Logs.Add(antispam.NewLog(
+		m.Message,
+		hash,
+		channelScope(s, m.ChannelID),
+		h.Links,
+	))
 	log.WithFields(log.Fields{
 		"author_id":    m.Author.ID,
 		"channel_id":   m.ChannelID,
 		"content_hash": hash[0:12],
 	}).Trace("MessageCreate: content hashed for antispam analysis")
 
-	if len(h.Logs.Slice()) > 1 {
-		logs, rule := antispam.Run(m, hash, h.Logs, h.Settings.Rules)
-		if len(logs) == 0 || rule == nil {
-			return
+	// Rules are evaluated from the very first message, as content rules
+	// (e.g., a blocked link) may be triggered by a single message.
+	author := antispam.NewAuthor(m, h.Counter)
+
+	matches := antispam.Run(m, hash, author, h.Logs, h.Settings.Rules)
+	if len(matches) == 0 {
+		return
+	}
+
+	enforced := antispam.Enforced(matches)
+	if enforced != nil {
+		if enforced.Rule.Coordinated() {
+			h.ProcessCoordinated(s, m, enforced)
+		} else {
+			h.ProcessSpam(s, m, enforced.Logs, enforced.Rule)
 		}
+	}
 
-		h.ProcessSpam(s, m, logs, rule)
+	for idx := range matches {
+		if matches[idx].Rule.Shadow() {
+			h.ProcessShadow(s, m, &matches[idx], enforced)
+		}
 	}
 }
@@ -5,58 +5,66 @@ package event
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
-
-	"github.com/lcook/pulsar/internal/antispam"
 )
 
 func (h *Handler) MessageDelete(
 	s *discordgo.Session,
 	m *discordgo.MessageDelete,
 ) {
-	if m.BeforeDelete == nil {
+	// Messages no longer held by the state cache are logged from the
+	// archive instead, if enabled.
+	before := h.archivedMessage(m.BeforeDelete, m.ID)
+
+	// Messages deleted as spam are logged as such already, along with
+	// their attachments.
+	if l, ok := h.Logs.Get(m.ID); ok && l.Deleted() {
+		h.unarchiveMessage(m.ID)
 		return
 	}
 
-	if m.BeforeDelete.Author.ID == s.State.User.ID {
+	defer h.removeAttachments(m.ID)
+
+	if before == nil {
 		return
 	}
 
-	if m.BeforeDelete.Type != discordgo.MessageTypeDefault {
+	defer h.unarchiveMessage(m.ID)
+
+	if before.Author == nil || before.Author.ID == s.State.User.ID {
 		return
 	}
 
-	var spam bool
-
-	h.Logs.ForEach(func(l *antispam.Log) {
-		if l.Message.ID == m.ID && l.Deleted() {
-			spam = true
-		}
-	})
+	if before.Type != discordgo.MessageTypeDefault {
+		return
+	}
 
-	if !spam && canViewChannel(s, m.GuildID, m.ChannelID) {
-		message, err := sendSilentEmbed(
-			s,
-			h.Settings.LogChannel,
-			&discordgo.MessageEmbed{
+	if canViewChannel(s, m.GuildID, m.ChannelID) {
+		deletion := &loggedDelete{
+			message: before,
+			deleted: time.Now(),
+			embed: &discordgo.MessageEmbed{
 				Description: fmt.Sprintf(
 					"**:wastebasket: Message deleted by %s in <#%s>**",
-					m.BeforeDelete.Author.Mention(),
-					m.BeforeDelete.ChannelID,
+					before.Author.Mention(),
+					before.ChannelID,
 				),
 				Color: embedDeleteColor,
 				Author: &discordgo.MessageEmbedAuthor{
-					Name:    m.BeforeDelete.Author.Username,
-					IconURL: m.BeforeDelete.Author.AvatarURL("256"),
+					Name:    before.Author.Username,
+					IconURL: before.Author.AvatarURL("256"),
 				},
 				Timestamp: func() string {
 					var timestamp string
 
 					if snowflake, err := discordgo.SnowflakeTimestamp(
-						m.BeforeDelete.ID,
+						before.ID,
 					); err == nil {
 						elapsed := snowflake.Sub(time.Now().UTC()).Abs()
 						if elapsed >= time.Minute {
@@ -70,21 +78,384 @@ func (h *Handler) MessageDelete(
 					{
 						Name: "Content",
 						Value: buildContentField(
-							m.BeforeDelete.Content,
-							m.BeforeDelete.Attachments,
-							m.BeforeDelete.StickerItems),
+							before.Content,
+							before.Attachments,
+							before.StickerItems),
 					},
 				},
 			},
-		)
+		}
+
+		entry := h.deletedBy(s, m.GuildID, deletion)
+		if entry != nil {
+			deletion.attribute(entry)
+		}
+
+		message, err := sendSilentEmbed(s, h.Settings.LogChannel, deletion.embed)
 		if err != nil {
 			h.Errors <- HandlerChannel{
 				Message: "MessageDelete(event): Unable to send message embed",
 				Fields: log.Fields{
-					"message_id":    message.ID,
+					"message_id":    m.ID,
 					"error_message": err.Error(),
 				},
 			}
+
+			return
+		}
+
+		if entry == nil && m.GuildID != "" {
+			// The entry may yet be written, in which case the deletion
+			// is attributed once it arrives (see AuditLogCreate).
+			deletion.logID = message.ID
+			if entry := h.deletions.await(deletion, time.Now()); entry != nil {
+				h.attributeDelete(s, deletion, entry)
+			}
 		}
+
+		h.uploadAttachments(s, message, m.ID)
+	}
+}
+
+// Deletion of a message as logged, attributed to whoever deleted it once
+// the audit log entry of the deletion is found.
+type loggedDelete struct {
+	message *discordgo.Message
+	embed   *discordgo.MessageEmbed
+	logID   string
+	deleted time.Time
+}
+
+// Attribute the deletion to the user of the audit log entry.
+func (d *loggedDelete) attribute(entry *discordgo.AuditLogEntry) {
+	d.embed.Description = fmt.Sprintf(
+		"**:wastebasket: Message sent by %s deleted by <@%s> in <#%s>**",
+		d.message.Author.Mention(),
+		entry.UserID,
+		d.message.ChannelID,
+	)
+
+	d.embed.Fields = append(d.embed.Fields, &discordgo.MessageEmbedField{
+		Name:   "Deleted by",
+		Value:  fmt.Sprintf("<@%s>", entry.UserID),
+		Inline: true,
+	})
+
+	if entry.Reason != "" {
+		d.embed.Fields = append(d.embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Reason",
+			Value:  entry.Reason,
+			Inline: true,
+		})
+	}
+
+	logUser(
+		d.message.Author,
+		log.InfoLevel,
+		"MessageDelete(event): Message deleted by another user",
+		log.Fields{
+			"message_id": d.message.ID,
+			"channel_id": d.message.ChannelID,
+			"deleted_by": entry.UserID,
+		},
+	)
+}
+
+// Attribute the deletion, already logged, to the user of the audit log
+// entry.
+func (h *Handler) attributeDelete(
+	session *discordgo.Session,
+	deletion *loggedDelete,
+	entry *discordgo.AuditLogEntry,
+) {
+	deletion.attribute(entry)
+
+	if _, err := session.ChannelMessageEditEmbed(
+		h.Settings.LogChannel,
+		deletion.logID,
+		deletion.embed,
+	); err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "attributeDelete(event): Unable to edit message embed",
+			Fields: log.Fields{
+				"message_id":    deletion.message.ID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+}
+
+// How recently an audit log entry not seen before must have been created
+// to be taken as that of a deletion.
+const deleteAuditWindow = 15 * time.Second
+
+// How far apart the creation of a new audit log entry and the deletion
+// of a message may be for the entry to be taken as that of the deletion,
+// allowing for the latency of either arriving.  Entries of deletions not
+// logged (e.g., of messages no longer held) would otherwise be taken as
+// those of the next deletion of a message of the member in the channel,
+// however much later, such as the member deleting it themselves.
+const deleteAuditSkew = 2 * time.Second
+
+// How long the counts of audit log entries are kept for, well beyond the
+// few minutes Discord keeps adding to an entry.
+const deleteAuditExpiry = time.Hour
+
+// Number of audit log entries fetched when correlating a deletion.
+const deleteAuditLimit int = 10
+
+// Counts of the message deletion audit log entries seen.  Rather than
+// adding another entry, Discord bumps the count of a recent one when a
+// moderator deletes further messages of the same member in the same
+// channel, so a deletion is matched by either a new entry or a bumped
+// count.  New entries arrive as they are written (see AuditLogCreate),
+// while bumped counts do not, so the audit log is only fetched for the
+// deletion of a message of a member in a channel with an entry seen
+// already, sparing a request for the many members deleting their own
+// messages, which leave no entry at all.  Deletions not matched then
+// await a new entry arriving for a short while, with entries arriving
+// before the deletion awaiting it held for as long.
+type deleteAudits struct {
+	mu        sync.Mutex
+	entries   map[string]deleteAudit
+	pending   []*loggedDelete
+	unclaimed []*discordgo.AuditLogEntry
+}
+
+type deleteAudit struct {
+	count     int
+	targetID  string
+	channelID string
+	seen      time.Time
+}
+
+func newDeleteAudits() *deleteAudits {
+	return &deleteAudits{entries: make(map[string]deleteAudit)}
+}
+
+// Whether the entry is of a deletion of a message of the author in the
+// channel.
+func deleteAuditOf(entry *discordgo.AuditLogEntry, authorID, channelID string) bool {
+	return entry.TargetID == authorID &&
+		entry.Options != nil && entry.Options.ChannelID == channelID
+}
+
+// Whether the new entry is that of the deletion, being of a message of
+// the same author in the same channel and created about when the message
+// was deleted.
+func (d *loggedDelete) entryOf(entry *discordgo.AuditLogEntry) bool {
+	if !deleteAuditOf(entry, d.message.Author.ID, d.message.ChannelID) {
+		return false
+	}
+
+	created, err := discordgo.SnowflakeTimestamp(entry.ID)
+
+	return err == nil && created.Sub(d.deleted).Abs() <= deleteAuditSkew
+}
+
+// Record the count of the entry, as seen at the time.  Must be called
+// with the lock held.
+func (d *deleteAudits) record(entry *discordgo.AuditLogEntry, now time.Time) {
+	count, err := strconv.Atoi(entry.Options.Count)
+	if err != nil {
+		count = 1
+	}
+
+	d.entries[entry.ID] = deleteAudit{
+		count:     count,
+		targetID:  entry.TargetID,
+		channelID: entry.Options.ChannelID,
+		seen:      now,
+	}
+}
+
+// Drop the deletions and entries awaiting one another for longer than
+// the window, and the counts of entries past expiry.  Must be called with
+// the lock held.
+func (d *deleteAudits) expire(now time.Time) {
+	d.pending = slices.DeleteFunc(d.pending, func(deletion *loggedDelete) bool {
+		return now.Sub(deletion.deleted) > deleteAuditWindow
+	})
+
+	d.unclaimed = slices.DeleteFunc(d.unclaimed, func(entry *discordgo.AuditLogEntry) bool {
+		created, err := discordgo.SnowflakeTimestamp(entry.ID)
+		return err != nil || now.Sub(created) > deleteAuditWindow
+	})
+
+	for id, audit := range d.entries {
+		if now.Sub(audit.seen) > deleteAuditExpiry {
+			delete(d.entries, id)
+		}
+	}
+}
+
+// Whether an entry of a deletion of a message of the author in the
+// channel has been seen, the count of which a further deletion may have
+// bumped.
+func (d *deleteAudits) bumpable(authorID, channelID string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(now)
+
+	for _, audit := range d.entries {
+		if audit.targetID == authorID && audit.channelID == channelID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Await the entry of the deletion, returning the entry instead if it has
+// arrived already.
+func (d *deleteAudits) await(deletion *loggedDelete, now time.Time) *discordgo.AuditLogEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(now)
+
+	idx := slices.IndexFunc(d.unclaimed, deletion.entryOf)
+	if idx >= 0 {
+		entry := d.unclaimed[idx]
+		d.unclaimed = slices.Delete(d.unclaimed, idx, idx+1)
+
+		return entry
+	}
+
+	d.pending = append(d.pending, deletion)
+
+	return nil
+}
+
+// Claim the new entry for the earliest deletion awaiting it, if any,
+// otherwise holding on to it for a deletion yet to await it.  Entries
+// already matched when fetching the audit log are left alone.
+func (d *deleteAudits) claim(entry *discordgo.AuditLogEntry, now time.Time) *loggedDelete {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if entry.Options == nil {
+		return nil
+	}
+
+	if _, seen := d.entries[entry.ID]; seen {
+		return nil
+	}
+
+	d.record(entry, now)
+	d.expire(now)
+
+	idx := slices.IndexFunc(d.pending, func(deletion *loggedDelete) bool {
+		return deletion.entryOf(entry)
+	})
+	if idx < 0 {
+		d.unclaimed = append(d.unclaimed, entry)
+		return nil
+	}
+
+	deletion := d.pending[idx]
+	d.pending = slices.Delete(d.pending, idx, idx+1)
+
+	return deletion
+}
+
+// Entry matching a deletion of a message in the channel (or, for bulk
+// deletions targeting the channel itself, any channel if empty), recording
+// the counts of the entries.
+func (d *deleteAudits) match(
+	entries []*discordgo.AuditLogEntry,
+	channelID string,
+	now time.Time,
+) *discordgo.AuditLogEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(now)
+
+	var matched *discordgo.AuditLogEntry
+
+	for _, entry := range entries {
+		if entry.Options == nil ||
+			(channelID != "" && entry.Options.ChannelID != channelID) {
+			continue
+		}
+
+		previous, seen := d.entries[entry.ID]
+		d.record(entry, now)
+
+		if matched != nil {
+			continue
+		}
+
+		if seen {
+			if d.entries[entry.ID].count > previous.count {
+				matched = entry
+			}
+
+			continue
+		}
+
+		if created, err := discordgo.SnowflakeTimestamp(entry.ID); err == nil &&
+			now.Sub(created) <= deleteAuditWindow {
+			matched = entry
+		}
+	}
+
+	return matched
+}
+
+// Audit log entry of the deletion, if deleted by someone else (e.g., a
+// moderator or bot) bumping the count of an entry seen already.  New
+// entries are left to arrive (see deleteAudits), as are those of members
+// without any entry seen, whose deletions are most likely their own.
+func (h *Handler) deletedBy(
+	session *discordgo.Session,
+	guildID string,
+	deletion *loggedDelete,
+) *discordgo.AuditLogEntry {
+	var (
+		authorID  = deletion.message.Author.ID
+		channelID = deletion.message.ChannelID
+	)
+
+	if guildID == "" || !h.deletions.bumpable(authorID, channelID, deletion.deleted) {
+		return nil
+	}
+
+	entries, err := auditLogActions(
+		session,
+		guildID,
+		authorID,
+		discordgo.AuditLogActionMessageDelete,
+		deleteAuditLimit,
+	)
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "deletedBy(event): Unable to fetch audit log",
+			Fields: log.Fields{
+				"guild_id":      guildID,
+				"error_message": err.Error(),
+			},
+		}
+
+		return nil
+	}
+
+	return h.deletions.match(entries, channelID, time.Now())
+}
+
+// Attribute the deletion awaiting the new audit log entry, if any.  The
+// bot only deletes messages as spam, which are logged as such already.
+func (h *Handler) auditMessageDeleted(
+	session *discordgo.Session,
+	entry *discordgo.AuditLogEntry,
+) {
+	if entry.UserID == session.State.User.ID {
+		return
+	}
+
+	if deletion := h.deletions.claim(entry, time.Now()); deletion != nil {
+		h.attributeDelete(session, deletion, entry)
 	}
 }
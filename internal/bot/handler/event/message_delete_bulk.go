@@ -0,0 +1,278 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Number of authors listed in purge log embeds.
+const maxPurgeAuthors int = 15
+
+func (h *Handler) MessageDeleteBulk(
+	s *discordgo.Session,
+	m *discordgo.MessageDeleteBulk,
+) {
+	var (
+		messages []*discordgo.Message
+		removed  = make(map[string]bool)
+		ids      = make([]string, 0, len(m.Messages))
+	)
+	// The messages are dropped from the state cache before handlers are
+	// called, so they are recovered from the message archive, if enabled,
+	// or otherwise the antispam message cache.
+	for _, id := range m.Messages {
+		l, ok := h.Logs.Get(id)
+		if ok && l.Deleted() {
+			removed[id] = true
+		} else {
+			ids = append(ids, id)
+		}
+
+		if message := h.archivedMessage(nil, id); message != nil {
+			messages = append(messages, message)
+		} else if ok {
+			messages = append(messages, l.Message)
+		}
+	}
+
+	defer func() {
+		for _, id := range m.Messages {
+			h.unarchiveMessage(id)
+		}
+	}()
+
+	// Messages removed by antispam are logged as such already, along with
+	// their attachments, so a purge of only those is antispam's own and
+	// not logged again.  Otherwise, those among the purged messages are
+	// tagged as such.
+	if len(removed) == len(m.Messages) {
+		log.WithFields(log.Fields{
+			"channel_id":    m.ChannelID,
+			"message_count": len(m.Messages),
+			"antispam":      true,
+		}).Debug("MessageDeleteBulk: messages removed by antispam, not logged")
+
+		return
+	}
+
+	if !canViewChannel(s, m.GuildID, m.ChannelID) {
+		h.removeAttachments(ids...)
+		return
+	}
+
+	slices.SortFunc(messages, func(a, b *discordgo.Message) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	var (
+		authors []*discordgo.User
+		counts  = make(map[string]int)
+		spam    = make(map[string]int)
+	)
+
+	for _, message := range messages {
+		if message.Author == nil {
+			continue
+		}
+
+		if counts[message.Author.ID] == 0 {
+			authors = append(authors, message.Author)
+		}
+
+		counts[message.Author.ID]++
+
+		if removed[message.ID] {
+			spam[message.Author.ID]++
+		}
+	}
+
+	fields := make([]*discordgo.MessageEmbedField, 0, 5)
+	logFields := log.Fields{
+		"channel_id":    m.ChannelID,
+		"message_count": len(m.Messages),
+		"recovered":     len(messages),
+		"antispam":      len(removed),
+	}
+
+	if entry := h.purgedBy(s, m.GuildID, m.ChannelID); entry != nil {
+		logFields["purged_by"] = entry.UserID
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Purged by",
+			Value:  fmt.Sprintf("<@%s>", entry.UserID),
+			Inline: true,
+		})
+
+		if entry.Reason != "" {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:   "Reason",
+				Value:  entry.Reason,
+				Inline: true,
+			})
+		}
+	}
+
+	fields = append(fields, &discordgo.MessageEmbedField{
+		Name:   "Recovered",
+		Value:  fmt.Sprintf("%d of %d message(s)", len(messages), len(m.Messages)),
+		Inline: true,
+	})
+
+	if len(removed) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Removed by antispam",
+			Value:  fmt.Sprintf("%d message(s)", len(removed)),
+			Inline: true,
+		})
+	}
+
+	if len(authors) > 0 {
+		list := make([]string, 0, min(len(authors), maxPurgeAuthors)+1)
+		for idx, author := range authors {
+			if idx == maxPurgeAuthors {
+				list = append(list, fmt.Sprintf("-# %d more author(s)", len(authors)-idx))
+				break
+			}
+
+			line := fmt.Sprintf("%s: %d", author.Mention(), counts[author.ID])
+			if spam[author.ID] > 0 {
+				line += fmt.Sprintf(" (%d by antispam)", spam[author.ID])
+			}
+
+			list = append(list, line)
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("Author(s) (%d)", len(authors)),
+			Value: TruncateContent(strings.Join(list, "\n")),
+		})
+	}
+
+	send := &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{{
+			Description: fmt.Sprintf(
+				"**:wastebasket: %d message(s) purged in <#%s>**",
+				len(m.Messages),
+				m.ChannelID,
+			),
+			Color:  embedDeleteColor,
+			Fields: fields,
+		}},
+		Flags: discordgo.MessageFlagsSuppressNotifications,
+	}
+
+	if len(messages) > 0 {
+		send.Files = []*discordgo.File{{
+			Name:        fmt.Sprintf("purge-%s-%d.txt", m.ChannelID, time.Now().Unix()),
+			ContentType: "text/plain",
+			Reader:      bytes.NewReader(purgeTranscript(messages, removed)),
+		}}
+	}
+
+	message, err := s.ChannelMessageSendComplex(h.Settings.LogChannel, send)
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "MessageDeleteBulk(event): Unable to send message embed",
+			Fields: log.Fields{
+				"channel_id":    m.ChannelID,
+				"error_message": err.Error(),
+			},
+		}
+
+		h.removeAttachments(ids...)
+
+		return
+	}
+
+	log.WithFields(logFields).Info("MessageDeleteBulk(event): Messages purged")
+
+	h.uploadAttachments(s, message, ids...)
+}
+
+// Transcript of the purged messages, oldest first, with those removed by
+// antispam tagged as such.
+func purgeTranscript(messages []*discordgo.Message, removed map[string]bool) []byte {
+	var buf bytes.Buffer
+
+	for _, message := range messages {
+		author := "unknown"
+		if message.Author != nil {
+			author = fmt.Sprintf("%s (%s)", message.Author.Username, message.Author.ID)
+		}
+
+		content := make([]string, 0, 1+len(message.Attachments)+len(message.StickerItems))
+		content = append(content, message.Content)
+
+		for _, attachment := range message.Attachments {
+			content = append(content, fmt.Sprintf(
+				"<%s (%s)>",
+				attachment.Filename,
+				attachment.ContentType,
+			))
+		}
+
+		for _, sticker := range message.StickerItems {
+			content = append(content, fmt.Sprintf("<sticker:%s>", sticker.Name))
+		}
+
+		var tag string
+		if removed[message.ID] {
+			tag = " [antispam]"
+		}
+
+		fmt.Fprintf(
+			&buf,
+			"[%s]%s %s: %s\n",
+			message.Timestamp.UTC().Format(time.DateTime),
+			tag,
+			author,
+			strings.TrimSpace(strings.Join(content, " ")),
+		)
+	}
+
+	return buf.Bytes()
+}
+
+// Audit log entry of the purge of messages in the channel.
+func (h *Handler) purgedBy(
+	session *discordgo.Session,
+	guildID, channelID string,
+) *discordgo.AuditLogEntry {
+	if guildID == "" {
+		return nil
+	}
+
+	var matched *discordgo.AuditLogEntry
+
+	_, err := auditLogActionsRetry(
+		session,
+		guildID,
+		channelID,
+		discordgo.AuditLogActionMessageBulkDelete,
+		deleteAuditLimit,
+		func(entries []*discordgo.AuditLogEntry) bool {
+			matched = h.deletions.match(entries, "", time.Now())
+			return matched != nil
+		},
+	)
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "purgedBy(event): Unable to fetch audit log",
+			Fields: log.Fields{
+				"guild_id":      guildID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord epoch of snowflake timestamps, in milliseconds.
+const discordEpoch int64 = 1420070400000
+
+// Audit log entry of a deletion of a message of the author in the
+// channel, created at the time.
+func deleteEntry(created time.Time, authorID, channelID string) *discordgo.AuditLogEntry {
+	return &discordgo.AuditLogEntry{
+		ID:       strconv.FormatInt((created.UnixMilli()-discordEpoch)<<22, 10),
+		TargetID: authorID,
+		UserID:   "moderator",
+		Options:  &discordgo.AuditLogOptions{ChannelID: channelID, Count: "1"},
+	}
+}
+
+func deletion(deleted time.Time, authorID, channelID string) *loggedDelete {
+	return &loggedDelete{
+		message: &discordgo.Message{
+			ChannelID: channelID,
+			Author:    &discordgo.User{ID: authorID},
+		},
+		deleted: deleted,
+	}
+}
+
+func TestDeleteAudits(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Unclaimed", func(t *testing.T) {
+		audits := newDeleteAudits()
+
+		entry := deleteEntry(now, "1", "10")
+		if audits.claim(entry, now) != nil {
+			t.Fatal("expected entry without deletion awaiting it to be held")
+		}
+
+		if audits.await(deletion(now, "2", "10"), now) != nil {
+			t.Fatal("expected deletion of another member not to take the entry")
+		}
+
+		if audits.await(deletion(now, "1", "20"), now) != nil {
+			t.Fatal("expected deletion in another channel not to take the entry")
+		}
+
+		if audits.await(deletion(now.Add(500*time.Millisecond), "1", "10"), now) != entry {
+			t.Error("expected deletion to take the entry arriving before it")
+		}
+	})
+
+	t.Run("StaleUnclaimed", func(t *testing.T) {
+		audits := newDeleteAudits()
+
+		// The entry of a deletion that was never logged, followed by the
+		// member deleting a message of their own.
+		audits.claim(deleteEntry(now, "1", "10"), now)
+
+		later := now.Add(5 * time.Second)
+		if entry := audits.await(deletion(later, "1", "10"), later); entry != nil {
+			t.Errorf("expected stale entry to be left alone, got %v", entry)
+		}
+	})
+
+	t.Run("Pending", func(t *testing.T) {
+		audits := newDeleteAudits()
+
+		awaiting := deletion(now, "1", "10")
+		if audits.await(awaiting, now) != nil {
+			t.Fatal("expected deletion to await the entry")
+		}
+
+		if audits.claim(deleteEntry(now.Add(100*time.Millisecond), "1", "20"), now) != nil {
+			t.Error("expected entry of another channel not to be claimed")
+		}
+
+		if audits.claim(deleteEntry(now.Add(200*time.Millisecond), "2", "10"), now) != nil {
+			t.Error("expected entry of another member not to be claimed")
+		}
+
+		if audits.claim(deleteEntry(now.Add(time.Second), "1", "10"), now) != awaiting {
+			t.Error("expected entry to be claimed by the deletion awaiting it")
+		}
+	})
+
+	t.Run("StalePending", func(t *testing.T) {
+		audits := newDeleteAudits()
+
+		// The member deleting a message of their own, followed by a
+		// moderator deleting another.
+		audits.await(deletion(now, "1", "10"), now)
+
+		later := now.Add(5 * time.Second)
+		if audits.claim(deleteEntry(later, "1", "10"), later) != nil {
+			t.Error("expected later entry not to be claimed by the earlier deletion")
+		}
+	})
+
+	t.Run("Bumpable", func(t *testing.T) {
+		audits := newDeleteAudits()
+
+		if audits.bumpable("1", "10", now) {
+			t.Error("expected deletion without any entry seen not to be fetched")
+		}
+
+		audits.claim(deleteEntry(now, "1", "10"), now)
+
+		if !audits.bumpable("1", "10", now) {
+			t.Error("expected deletion with an entry seen to be fetched")
+		}
+
+		if audits.bumpable("1", "20", now) {
+			t.Error("expected deletion in another channel not to be fetched")
+		}
+
+		if audits.bumpable("1", "10", now.Add(2*deleteAuditExpiry)) {
+			t.Error("expected entry past expiry to be forgotten")
+		}
+	})
+}
@@ -14,19 +14,24 @@ func (h *Handler) MessageUpdate(
 	s *discordgo.Session,
 	m *discordgo.MessageUpdate,
 ) {
-	if m.BeforeUpdate == nil {
+	if m.Author == nil || m.Author.ID == s.State.User.ID || m.Member == nil || m.Author.Bot {
 		return
 	}
 
-	if m.Author.ID == s.State.User.ID || m.Member == nil || m.Author.Bot {
+	// Messages no longer held by the state cache are logged from the
+	// archive instead, if enabled.
+	before := h.archivedMessage(m.BeforeUpdate, m.ID)
+	if before == nil {
 		return
 	}
 
-	if m.BeforeUpdate.Content == m.Content &&
-		len(m.BeforeUpdate.Attachments) == len(m.Attachments) {
+	if before.Content == m.Content &&
+		len(before.Attachments) == len(m.Attachments) {
 		return
 	}
 
+	h.archiveMessage(m.Message)
+
 	link := fmt.Sprintf(
 		"%schannels/%s/%s/%s",
 		discordgo.EndpointDiscord,
@@ -55,9 +60,9 @@ func (h *Handler) MessageUpdate(
 					{
 						Name: "Before",
 						Value: buildContentField(
-							m.BeforeUpdate.Content,
-							m.BeforeUpdate.Attachments,
-							m.BeforeUpdate.StickerItems,
+							before.Content,
+							before.Attachments,
+							before.StickerItems,
 						),
 						Inline: true,
 					},
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+)
+
+const raidReason string = "Raid mode"
+
+// Enter raid mode, raising the verification level of the guild and
+// applying slowmode to the configured channels, recording the previous
+// settings so that they can be restored when raid mode is ended (see the
+// raid command).  Moderators are alerted regardless of whether changing
+// the settings succeeds.
+func (h *Handler) enterRaid(session *discordgo.Session, raid *antispam.Raid) {
+	h.Raid.Lock()
+	defer h.Raid.Unlock()
+	// Raid mode may have been ended before the settings could be changed,
+	// in which case there is nothing to restore them for.
+	if active, ok := h.Raid.Active(raid.GuildID); !ok || !active.Started.Equal(raid.Started) {
+		log.WithFields(log.Fields{
+			"guild_id": raid.GuildID,
+		}).Info("enterRaid(event): Raid mode ended before being entered")
+
+		return
+	}
+
+	var (
+		settings = h.Raid.Settings
+		reason   = discordgo.WithAuditLogReason(raidReason)
+		changes  []string
+	)
+
+	if settings.VerificationLevel > 0 {
+		guild, err := session.State.Guild(raid.GuildID)
+		if err != nil {
+			guild, err = session.Guild(raid.GuildID)
+		}
+
+		if err == nil && int(guild.VerificationLevel) < settings.VerificationLevel {
+			level := discordgo.VerificationLevel(settings.VerificationLevel)
+
+			_, err = session.GuildEdit(
+				raid.GuildID,
+				&discordgo.GuildParams{VerificationLevel: &level},
+				reason,
+			)
+			if err == nil {
+				previous := int(guild.VerificationLevel)
+				raid.VerificationLevel = &previous
+				changes = append(changes, fmt.Sprintf(
+					"Verification level raised from %d to %d",
+					previous,
+					level,
+				))
+			}
+		}
+
+		if err != nil {
+			h.Errors <- HandlerChannel{
+				Message: "enterRaid(event): Unable to raise verification level",
+				Fields: log.Fields{
+					"guild_id":      raid.GuildID,
+					"error_message": err.Error(),
+				},
+			}
+		}
+	}
+
+	if settings.Slowmode > 0 {
+		rate := int(settings.Slowmode.Seconds())
+		raid.Slowmode = make(map[string]int)
+
+		for _, id := range settings.SlowmodeChannels {
+			channel, err := session.State.Channel(id)
+			if err != nil {
+				channel, err = session.Channel(id)
+			}
+			// Channels already at least as slow are left alone, and so
+			// not restored when the raid ends either.
+			if err == nil && channel.RateLimitPerUser >= rate {
+				continue
+			}
+
+			if err == nil {
+				_, err = session.ChannelEdit(
+					id,
+					&discordgo.ChannelEdit{RateLimitPerUser: &rate},
+					reason,
+				)
+			}
+
+			if err != nil {
+				h.Errors <- HandlerChannel{
+					Message: "enterRaid(event): Unable to apply slowmode to channel",
+					Fields: log.Fields{
+						"channel_id":    id,
+						"error_message": err.Error(),
+					},
+				}
+
+				continue
+			}
+
+			raid.Slowmode[id] = channel.RateLimitPerUser
+		}
+
+		if len(raid.Slowmode) > 0 {
+			changes = append(changes, fmt.Sprintf(
+				"Slowmode of %s applied to %d channel(s)",
+				settings.Slowmode,
+				len(raid.Slowmode),
+			))
+		}
+	}
+
+	if err := h.Raid.Save(*raid); err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "enterRaid(event): Unable to save raid mode",
+			Fields: log.Fields{
+				"guild_id":      raid.GuildID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+
+	if settings.Timeout > 0 {
+		for _, id := range raid.Members {
+			h.timeoutRaider(session, raid.GuildID, id)
+		}
+
+		changes = append(changes, "New members timed out for "+settings.Timeout.String())
+	}
+
+	log.WithFields(log.Fields{
+		"guild_id":     raid.GuildID,
+		"join_count":   raid.Joins,
+		"new_accounts": raid.NewAccounts,
+	}).Warn("enterRaid(event): Join rate exceeded, entering raid mode")
+
+	if len(changes) == 0 {
+		changes = append(changes, "None")
+	}
+
+	members := make([]string, 0, len(raid.Members))
+	for _, id := range raid.Members {
+		members = append(members, fmt.Sprintf("<@%s>", id))
+	}
+
+	message, err := sendSilentEmbed(session, h.Settings.LogChannel,
+		&discordgo.MessageEmbed{
+			Title: ":rotating_light: Raid mode entered",
+			Description: fmt.Sprintf(
+				"-# Attention: %d member(s), %d with newly created accounts, joined within %s.  Raid mode remains in place until ended with the `%sraid end` command.",
+				raid.Joins,
+				raid.NewAccounts,
+				settings.Window,
+				h.Settings.Prefix,
+			),
+			Color: embedDeleteColor,
+			Fields: []*discordgo.MessageEmbedField{
+				{
+					Name:  "Member(s)",
+					Value: TruncateContent(strings.Join(members, " ")),
+				},
+				{
+					Name:  "Change(s)",
+					Value: strings.Join(changes, "\n"),
+				},
+			},
+		},
+	)
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "enterRaid(event): Unable to send message embed",
+			Fields: log.Fields{
+				"guild_id":      raid.GuildID,
+				"error_message": err.Error(),
+			},
+		}
+
+		return
+	}
+
+	h.ForwardAlert(session, message, true)
+}
+
+// Time out a member that joined during a raid.
+func (h *Handler) timeoutRaider(
+	session *discordgo.Session,
+	guildID, userID string,
+) {
+	timeout := time.Now().Add(h.Raid.Settings.Timeout)
+
+	err := session.GuildMemberTimeout(
+		guildID,
+		userID,
+		&timeout,
+		discordgo.WithAuditLogReason(raidReason),
+	)
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "timeoutRaider(event): Unable to time out member",
+			Fields: log.Fields{
+				"user_id":       userID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+}
@@ -0,0 +1,570 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+	"github.com/lcook/pulsar/internal/archive"
+	"github.com/lcook/pulsar/internal/store"
+)
+
+// Prefix of the custom IDs of review buttons, followed by the action and
+// the ID of the review, e.g., pulsar:review:ban:<id>.
+const reviewPrefix string = "pulsar:review:"
+
+// Reviews older than this are forgotten, leaving their buttons inert.
+const reviewRetention time.Duration = 30 * 24 * time.Hour
+
+// Action taken by a moderator reviewing an alert.
+type reviewAction string
+
+const (
+	reviewLiftTimeout   reviewAction = "untimeout"
+	reviewBan           reviewAction = "ban"
+	reviewKick          reviewAction = "kick"
+	reviewFalsePositive reviewAction = "dismiss"
+	reviewRestore       reviewAction = "restore"
+)
+
+var reviewButtons = map[reviewAction]struct {
+	label string
+	style discordgo.ButtonStyle
+}{
+	reviewLiftTimeout:   {"Lift timeout", discordgo.SecondaryButton},
+	reviewBan:           {"Ban", discordgo.DangerButton},
+	reviewKick:          {"Kick", discordgo.DangerButton},
+	reviewFalsePositive: {"Mark false positive", discordgo.SuccessButton},
+	reviewRestore:       {"Restore messages", discordgo.PrimaryButton},
+}
+
+// Message removed by antispam (or blocked by AutoMod), as restored when
+// found to be a false positive.
+type reviewMessage struct {
+	ChannelID string    `json:"channel_id"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	Restored  bool      `json:"restored,omitempty"`
+}
+
+// Decision of a moderator reviewing an alert.
+type reviewDecision struct {
+	Action      reviewAction `json:"action"`
+	ModeratorID string       `json:"moderator_id"`
+	Time        time.Time    `json:"time"`
+}
+
+// Review of an alert about a member, offering moderators the actions to
+// take from the alert itself.  Decisions are kept alongside, making up
+// the trail of who handled the alert and how.  The messages are kept as
+// Data in the store, encrypted with the storage key.
+type review struct {
+	GuildID   string            `json:"guild_id"`
+	UserID    string            `json:"user_id"`
+	Username  string            `json:"username"`
+	Avatar    string            `json:"avatar"`
+	Rule      string            `json:"rule"`
+	Created   time.Time         `json:"created"`
+	Actions   []reviewAction    `json:"actions"`
+	Offence   *antispam.Offence `json:"offence,omitempty"`
+	Messages  []reviewMessage   `json:"-"`
+	Data      []byte            `json:"data,omitempty"`
+	Decisions []reviewDecision  `json:"decisions,omitempty"`
+}
+
+// Whether the action was already taken, or has been made moot by banning
+// or kicking the member.
+func (r *review) decided(action reviewAction) bool {
+	for _, decision := range r.Decisions {
+		if decision.Action == action {
+			return true
+		}
+
+		if decision.Action == reviewBan || decision.Action == reviewKick {
+			switch action {
+			case reviewLiftTimeout, reviewBan, reviewKick:
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Buttons of the actions of the review, disabling those already taken.
+func (r *review) components(id string) []discordgo.MessageComponent {
+	buttons := make([]discordgo.MessageComponent, 0, len(r.Actions))
+	for _, action := range r.Actions {
+		buttons = append(buttons, discordgo.Button{
+			Label:    reviewButtons[action].label,
+			Style:    reviewButtons[action].style,
+			CustomID: reviewPrefix + string(action) + ":" + id,
+			Disabled: r.decided(action),
+		})
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: buttons},
+	}
+}
+
+// Reviews of alerts, kept in a store when given a path so that the
+// buttons of alerts keep working across restarts, and otherwise in
+// memory.  The messages of reviews are only ever stored encrypted with
+// the storage key, and are not kept in the store at all without one, in
+// which case they cannot be restored (see restorable).
+type reviews struct {
+	mu     sync.Mutex
+	memory map[string]review
+	store  *store.Store[review]
+	key    []byte
+}
+
+func openReviews(path string, key []byte) (*reviews, error) {
+	r := &reviews{memory: make(map[string]review), key: key}
+	if path == "" {
+		return r, nil
+	}
+
+	s, err := store.Open[review](path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.store = s
+	r.prune()
+
+	return r, nil
+}
+
+// Whether the messages of reviews are kept, and so can be restored.
+func (r *reviews) restorable() bool {
+	return r.store == nil || r.key != nil
+}
+
+// Forget the reviews past retention, done periodically as the store is
+// only otherwise added to.
+func (r *reviews) prune() {
+	if r.store == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.store.Prune(func(_ string, rv review) bool {
+		return time.Since(rv.Created) > reviewRetention
+	})
+}
+
+func (r *reviews) get(id string) (review, bool) {
+	if r.store == nil {
+		rv, ok := r.memory[id]
+
+		return rv, ok
+	}
+
+	rv, ok := r.store.Get(id)
+	if !ok || len(rv.Data) == 0 || r.key == nil {
+		return rv, ok
+	}
+
+	buf, err := archive.Decrypt(rv.Data, r.key, id)
+	if err == nil {
+		err = json.Unmarshal(buf, &rv.Messages)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"review_id":     id,
+			"error_message": err.Error(),
+		}).Warn("Unable to decrypt messages of alert review")
+	}
+
+	rv.Data = nil
+
+	return rv, ok
+}
+
+func (r *reviews) put(id string, rv review) error {
+	if r.store != nil {
+		rv.Data = nil
+
+		if r.key != nil && len(rv.Messages) > 0 {
+			buf, err := json.Marshal(rv.Messages)
+			if err != nil {
+				return err
+			}
+
+			if rv.Data, err = archive.Encrypt(buf, r.key, id); err != nil {
+				return err
+			}
+		}
+
+		rv.Messages = nil
+
+		return r.store.Put(id, rv)
+	}
+
+	for key, other := range r.memory {
+		if time.Since(other.Created) > reviewRetention {
+			delete(r.memory, key)
+		}
+	}
+
+	r.memory[id] = rv
+
+	return nil
+}
+
+// Add the review, returning the buttons to attach to the alert.  Without
+// any actions to offer, no buttons are returned.
+func (r *reviews) add(rv review) []discordgo.MessageComponent {
+	if len(rv.Actions) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rv.Created = time.Now()
+	id := strconv.FormatInt(rv.Created.UnixNano(), 36)
+
+	if err := r.put(id, rv); err != nil {
+		log.WithFields(log.Fields{
+			"user_id":       rv.UserID,
+			"error_message": err.Error(),
+		}).Warn("Unable to store alert review")
+
+		return nil
+	}
+
+	return rv.components(id)
+}
+
+// Claim the action of the review for the moderator, so that it is only
+// taken once should several moderators act at the same time.
+func (r *reviews) claim(id string, action reviewAction, moderatorID string) (review, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rv, ok := r.get(id)
+	if !ok {
+		return rv, errors.New("this alert can no longer be reviewed")
+	}
+
+	if !slices.Contains(rv.Actions, action) {
+		return rv, errors.New("this action is not available for the alert")
+	}
+
+	if rv.decided(action) {
+		return rv, errors.New("this alert has already been handled")
+	}
+
+	rv.Decisions = append(rv.Decisions, reviewDecision{
+		Action:      action,
+		ModeratorID: moderatorID,
+		Time:        time.Now(),
+	})
+
+	return rv, r.put(id, rv)
+}
+
+// Update the review, e.g., to record progress made taking an action.
+func (r *reviews) update(id string, fn func(*review)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rv, ok := r.get(id)
+	if !ok {
+		return errors.New("this alert can no longer be reviewed")
+	}
+
+	fn(&rv)
+
+	return r.put(id, rv)
+}
+
+// Release the claim of the action, as taking it failed.
+func (r *reviews) release(id string, action reviewAction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rv, ok := r.get(id)
+	if !ok {
+		return
+	}
+
+	rv.Decisions = slices.DeleteFunc(rv.Decisions, func(d reviewDecision) bool {
+		return d.Action == action
+	})
+
+	r.put(id, rv)
+}
+
+// Messages of the logs, as kept for restoring them.
+func reviewMessages(logs []*antispam.Log) []reviewMessage {
+	messages := make([]reviewMessage, 0, len(logs))
+	for idx := range logs {
+		message := logs[idx].Message
+		messages = append(messages, reviewMessage{
+			ChannelID: message.ChannelID,
+			Content:   message.Content,
+			Timestamp: message.Timestamp,
+		})
+	}
+
+	return messages
+}
+
+// InteractionCreate handles the buttons of alerts, taking the action on
+// behalf of the moderator and updating the alert to show who handled it.
+func (h *Handler) InteractionCreate(
+	s *discordgo.Session,
+	i *discordgo.InteractionCreate,
+) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+
+	custom, ok := strings.CutPrefix(i.MessageComponentData().CustomID, reviewPrefix)
+	if !ok {
+		return
+	}
+
+	action, id, ok := strings.Cut(custom, ":")
+	if !ok {
+		return
+	}
+
+	if i.Member == nil || h.Settings.ModRole == "" ||
+		!slices.Contains(i.Member.Roles, h.Settings.ModRole) {
+		respondEphemeral(s, i, "Only moderators can review alerts.")
+		return
+	}
+
+	rv, err := h.reviews.claim(id, reviewAction(action), i.Member.User.ID)
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("Unable to review: %s.", err))
+		return
+	}
+	// Taking the action may well take longer than an interaction can go
+	// unanswered, so the alert is updated once it has been taken.
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		h.reviews.release(id, reviewAction(action))
+
+		h.Errors <- HandlerChannel{
+			Message: "InteractionCreate(event): Unable to respond to interaction",
+			Fields: log.Fields{
+				"user_id":       rv.UserID,
+				"error_message": err.Error(),
+			},
+		}
+
+		return
+	}
+
+	summary, err := h.applyReview(s, id, &rv, reviewAction(action), i.Member.User)
+	if err != nil {
+		h.reviews.release(id, reviewAction(action))
+
+		s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+			Content: fmt.Sprintf("Unable to review: %s.", err),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":      rv.UserID,
+		"moderator_id": i.Member.User.ID,
+		"heuristic_id": rv.Rule,
+		"action":       action,
+	}).Info("InteractionCreate(event): Alert reviewed by moderator")
+
+	var embeds []*discordgo.MessageEmbed
+	if i.Message != nil {
+		embeds = i.Message.Embeds
+	}
+
+	if len(embeds) > 0 {
+		var (
+			embed = embeds[0]
+			line  = fmt.Sprintf(
+				"%s by %s <t:%d:R>",
+				summary,
+				i.Member.User.Mention(),
+				time.Now().Unix(),
+			)
+		)
+
+		idx := slices.IndexFunc(embed.Fields, func(f *discordgo.MessageEmbedField) bool {
+			return f.Name == "Review"
+		})
+		if idx < 0 {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "Review",
+				Value: line,
+			})
+		} else {
+			embed.Fields[idx].Value = TruncateContent(embed.Fields[idx].Value + "\n" + line)
+		}
+	}
+
+	components := rv.components(id)
+
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds:     &embeds,
+		Components: &components,
+	})
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "InteractionCreate(event): Unable to update alert",
+			Fields: log.Fields{
+				"user_id":       rv.UserID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+}
+
+// Take the action of the review, returning a summary of what was done.
+func (h *Handler) applyReview(
+	session *discordgo.Session,
+	id string,
+	rv *review,
+	action reviewAction,
+	moderator *discordgo.User,
+) (string, error) {
+	reason := discordgo.WithAuditLogReason(fmt.Sprintf(
+		"Alert (%s) reviewed by %s",
+		strings.ToLower(rv.Rule),
+		moderator.Username,
+	))
+
+	switch action {
+	case reviewLiftTimeout:
+		return "Timeout lifted", session.GuildMemberTimeout(
+			rv.GuildID,
+			rv.UserID,
+			nil,
+			reason,
+		)
+	case reviewBan:
+		return "Banned", session.GuildBanCreateWithReason(
+			rv.GuildID,
+			rv.UserID,
+			fmt.Sprintf("Alert (%s) reviewed by %s", strings.ToLower(rv.Rule), moderator.Username),
+			0,
+		)
+	case reviewKick:
+		return "Kicked", session.GuildMemberDelete(rv.GuildID, rv.UserID, reason)
+	case reviewFalsePositive:
+		if rv.Offence != nil {
+			if err := h.Offences.Remove(*rv.Offence); err != nil {
+				return "", err
+			}
+		}
+
+		return "Marked false positive", nil
+	case reviewRestore:
+		restored, err := h.restoreMessages(session, id, rv)
+
+		return fmt.Sprintf("Restored %d message(s)", restored), err
+	}
+
+	return "", fmt.Errorf("unknown action %q", action)
+}
+
+// Send the messages of the review back to the channels they were sent
+// in, on behalf of the member.  Messages are recorded as restored as they
+// are sent, so that restoring them again after failing partway does not
+// send those already restored twice.
+func (h *Handler) restoreMessages(
+	session *discordgo.Session,
+	id string,
+	rv *review,
+) (int, error) {
+	var (
+		user     = &discordgo.User{ID: rv.UserID, Avatar: rv.Avatar}
+		bucket   = make(map[string][]int)
+		restored int
+	)
+
+	for idx, message := range rv.Messages {
+		if !message.Restored {
+			bucket[message.ChannelID] = append(bucket[message.ChannelID], idx)
+		}
+	}
+
+	for channel, messages := range bucket {
+		// Messages are limited to ten embeds each.
+		for chunk := range slices.Chunk(messages, 10) {
+			embeds := make([]*discordgo.MessageEmbed, 0, len(chunk))
+			for _, idx := range chunk {
+				embeds = append(embeds, &discordgo.MessageEmbed{
+					Description: TruncateContent(rv.Messages[idx].Content),
+					Timestamp:   rv.Messages[idx].Timestamp.Format(time.RFC3339),
+					Color:       embedUpdateColor,
+					Author: &discordgo.MessageEmbedAuthor{
+						Name:    rv.Username,
+						IconURL: user.AvatarURL("256"),
+					},
+					Footer: &discordgo.MessageEmbedFooter{
+						Text: "Restored after review",
+					},
+				})
+			}
+
+			_, err := session.ChannelMessageSendComplex(channel, &discordgo.MessageSend{
+				Embeds: embeds,
+				Flags:  discordgo.MessageFlagsSuppressNotifications,
+			})
+			if err != nil {
+				return restored, err
+			}
+
+			restored += len(chunk)
+
+			if err := h.reviews.update(id, func(stored *review) {
+				for _, idx := range chunk {
+					stored.Messages[idx].Restored = true
+				}
+			}); err != nil {
+				return restored, err
+			}
+		}
+	}
+
+	return restored, nil
+}
+
+func respondEphemeral(
+	session *discordgo.Session,
+	interaction *discordgo.InteractionCreate,
+	content string,
+) {
+	session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
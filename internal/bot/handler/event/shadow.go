@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+	"github.com/lcook/pulsar/internal/store"
+)
+
+const embedShadowColor int = 0x6C71C4
+
+// Matches of shadow rules, counted per rule.  As nothing is done about
+// the messages matched, a rule keeps matching every further message sent
+// by the member within the rule window, so each member is only reported
+// once per window, though every match is counted.  Counts are kept in a
+// store when given a path, and otherwise in memory for as long as the bot
+// runs.
+type shadowReports struct {
+	store *store.Store[uint64]
+
+	mu       sync.Mutex
+	counts   map[string]uint64
+	reported map[string]time.Time
+}
+
+func openShadowReports(path string) (*shadowReports, error) {
+	s := &shadowReports{
+		counts:   make(map[string]uint64),
+		reported: make(map[string]time.Time),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	counts, err := store.Open[uint64](path)
+	if err != nil {
+		return nil, err
+	}
+
+	counts.Range(func(rule string, count uint64) bool {
+		s.counts[rule] = count
+		return true
+	})
+
+	s.store = counts
+
+	return s, nil
+}
+
+// Record a match of the rule by the member, returning the number of
+// times the rule has been matched and whether the match is to be
+// reported.
+func (s *shadowReports) record(
+	rule *antispam.HeuristicRule,
+	userID string,
+	now time.Time,
+) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts[rule.ID]++
+
+	count := s.counts[rule.ID]
+	if s.store != nil {
+		if err := s.store.Put(rule.ID, count); err != nil {
+			log.WithFields(log.Fields{
+				"heuristic_id":  rule.ID,
+				"error_message": err.Error(),
+			}).Error("Unable to store shadow rule match count")
+		}
+	}
+
+	for key, expiry := range s.reported {
+		if now.After(expiry) {
+			delete(s.reported, key)
+		}
+	}
+
+	key := rule.ID + ":" + userID
+	if _, ok := s.reported[key]; ok {
+		return count, false
+	}
+
+	s.reported[key] = now.Add(rule.Thresholds.Window)
+
+	return count, true
+}
+
+// ProcessShadow reports the match of a shadow rule to the shadow log
+// channel, alongside the actions the rule would have applied and the
+// enforced rule (if any) that was triggered by the same message.
+func (h *Handler) ProcessShadow(
+	session *discordgo.Session,
+	message *discordgo.MessageCreate,
+	match *antispam.Match,
+	enforced *antispam.Match,
+) {
+	count, report := h.shadow.record(match.Rule, message.Author.ID, time.Now())
+	if !report {
+		return
+	}
+
+	channels := logChannels(match.Logs)
+
+	plan := match.Rule.Escalate(h.Offences.Count(
+		message.Author.ID,
+		match.Rule.Escalation.Window,
+		time.Now(),
+	))
+
+	actions := make([]string, 0, len(plan))
+	for idx := range plan {
+		actions = append(actions, plan[idx].String())
+	}
+
+	logUser(
+		message.Author,
+		log.InfoLevel,
+		"ProcessShadow(event): Member matched shadow antispam rule",
+		log.Fields{
+			"message_count": len(match.Logs),
+			"channel_count": len(channels),
+			"heuristic_id":  match.Rule.ID,
+			"match_count":   count,
+		},
+	)
+
+	if h.Settings.ShadowLogChannel == "" {
+		return
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{
+			Name: "Content",
+			Value: buildContentField(
+				message.Content,
+				message.Attachments,
+				message.StickerItems,
+			),
+		},
+		{
+			Name:   "Channel(s)",
+			Value:  strings.Join(channels, " "),
+			Inline: true,
+		},
+		{
+			Name:   "Action(s)",
+			Value:  strings.Join(actions, "\n"),
+			Inline: true,
+		},
+	}
+
+	if enforced != nil {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Enforced",
+			Value:  strings.ToLower(enforced.Rule.ID),
+			Inline: true,
+		})
+	}
+
+	_, err := sendSilentEmbed(session, h.Settings.ShadowLogChannel,
+		&discordgo.MessageEmbed{
+			Title: fmt.Sprintf(
+				":ghost: Shadow rule matched (%s)",
+				strings.ToLower(match.Rule.ID),
+			),
+			Description: fmt.Sprintf(
+				"-# %d message(s) from %d channel(s) sent by the user (%s) matched a rule in shadow mode.  No action was taken.",
+				len(match.Logs),
+				len(channels),
+				message.Author.Mention(),
+			),
+			Color: embedShadowColor,
+			Author: &discordgo.MessageEmbedAuthor{
+				Name:    message.Author.Username,
+				IconURL: message.Author.AvatarURL("256"),
+			},
+			Fields: fields,
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: fmt.Sprintf("Matched %d time(s) in total", count),
+			},
+		},
+	)
+	if err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "ProcessShadow(event): Unable to send message embed",
+			Fields: log.Fields{
+				"heuristic_id":  match.Rule.ID,
+				"error_message": err.Error(),
+			},
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package event
+
+import (
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+)
+
+// How often the antispam message cache is written to disk.
+const snapshotInterval = 30 * time.Second
+
+// Path of the antispam message cache snapshot, which is written encrypted
+// with the storage key, or without the content of messages to a separate
+// file without one (see antispam.Snapshot).
+func (h *Handler) snapshotPath() string {
+	if h.Settings.Directory == "" {
+		return ""
+	}
+
+	if h.key == nil {
+		return filepath.Join(h.Settings.Directory, "antispam-state.json")
+	}
+
+	return filepath.Join(h.Settings.Directory, "antispam.json")
+}
+
+// Restore the antispam message cache from the last snapshot, so that a
+// reload or restart in the middle of a spam wave carries on detecting it.
+func (h *Handler) restore() {
+	path := h.snapshotPath()
+	if path == "" {
+		return
+	}
+
+	restored, err := antispam.Restore(
+		h.Logs,
+		path,
+		h.key,
+		antispam.MaxWindow(h.Settings.Rules),
+		h.Links,
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":          path,
+			"error_message": err.Error(),
+		}).Warn("Unable to restore antispam message cache")
+
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"path":     path,
+		"restored": restored,
+	}).Info("Restored antispam message cache")
+}
+
+func (h *Handler) snapshot() {
+	path := h.snapshotPath()
+	if path == "" {
+		return
+	}
+
+	if err := antispam.Snapshot(h.Logs, path, h.key); err != nil {
+		h.Errors <- HandlerChannel{
+			Message: "snapshot(event): Unable to write antispam message cache",
+			Fields: log.Fields{
+				"path":          path,
+				"error_message": err.Error(),
+			},
+		}
+	}
+}
+
+// Start periodically writing the antispam message cache to the storage
+// directory, and pruning the message archive and alert reviews, if
+// configured.
+func (h *Handler) Start() {
+	if h.Settings.Directory == "" {
+		return
+	}
+
+	h.stop = make(chan struct{})
+
+	h.wg.Go(func() {
+		ticker := time.NewTicker(snapshotInterval)
+		defer ticker.Stop()
+
+		prune := time.NewTicker(archivePruneInterval)
+		defer prune.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.snapshot()
+			case <-prune.C:
+				h.pruneArchive()
+				h.reviews.prune()
+			case <-h.stop:
+				return
+			}
+		}
+	})
+}
+
+// Stop writing snapshots, writing a final one of the cache as it stands
+// so that the handler replacing this one (e.g., on reload) picks up
+// where it left off.
+func (h *Handler) Stop() {
+	if h.stop == nil {
+		return
+	}
+
+	close(h.stop)
+	h.wg.Wait()
+
+	h.stop = nil
+
+	h.snapshot()
+}
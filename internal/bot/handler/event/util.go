@@ -8,21 +8,35 @@ import (
 	"encoding/hex"
 	"fmt"
 	"maps"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
 )
 
+// Discord limits embed field values to 1024 characters, and descriptions
+// to 4096.
 const (
-	maxContentLength int    = 1024
-	maxContentMarker string = "\n\n<truncated>"
+	maxContentLength     int    = 1024
+	maxDescriptionLength int    = 4096
+	maxContentMarker     string = "\n\n<truncated>"
 )
 
 func TruncateContent(content string) string {
-	if len(content) > maxContentLength {
-		return content[:maxContentLength-len(maxContentMarker)] + maxContentMarker
+	return truncate(content, maxContentLength)
+}
+
+func TruncateDescription(content string) string {
+	return truncate(content, maxDescriptionLength)
+}
+
+func truncate(content string, limit int) string {
+	if len(content) > limit {
+		return content[:limit-len(maxContentMarker)] + maxContentMarker
 	}
 
 	return content
@@ -81,15 +95,15 @@ func buildContentField(
 	return TruncateContent(builder.String())
 }
 
-//nolint:unused
+// Entries of the audit log for the action targeting the user.
 func auditLogActions(
 	session *discordgo.Session,
-	member *discordgo.Member,
+	guildID, targetID string,
 	action discordgo.AuditLogAction,
 	limit int,
 ) ([]*discordgo.AuditLogEntry, error) {
 	log, err := session.GuildAuditLog(
-		member.GuildID,
+		guildID,
 		"",
 		"",
 		int(action),
@@ -102,7 +116,7 @@ func auditLogActions(
 	var entries []*discordgo.AuditLogEntry
 
 	for _, entry := range log.AuditLogEntries {
-		if entry.TargetID == member.User.ID {
+		if entry.TargetID == targetID {
 			entries = append(entries, entry)
 		}
 	}
@@ -110,13 +124,14 @@ func auditLogActions(
 	return entries, nil
 }
 
-//nolint:unused
-func auditLogActionsLast(
+// Entries of the audit log for the action targeting the user, fetched
+// again until found returns true for them or giving up.
+func auditLogActionsRetry(
 	session *discordgo.Session,
-	member *discordgo.Member,
+	guildID, targetID string,
 	action discordgo.AuditLogAction,
 	limit int,
-	window time.Duration,
+	found func([]*discordgo.AuditLogEntry) bool,
 ) ([]*discordgo.AuditLogEntry, error) {
 	var (
 		err     error
@@ -126,8 +141,8 @@ func auditLogActionsLast(
 	// Retry up to three times with a truncated exponential back-off (100 -> 300 ms)
 	// until the desired entry appears or we give up.
 	for attempt := range 3 {
-		entries, err = auditLogActions(session, member, action, limit)
-		if err == nil && len(entries) > 0 {
+		entries, err = auditLogActions(session, guildID, targetID, action, limit)
+		if err == nil && found(entries) {
 			break
 		}
 
@@ -136,29 +151,7 @@ func auditLogActionsLast(
 		}
 	}
 
-	if err != nil {
-		return entries, err
-	}
-
-	cutoff := time.Now().UTC().Add(-window)
-
-	logs := make([]*discordgo.AuditLogEntry, 0, len(entries))
-	for _, entry := range entries {
-		timestamp, err := discordgo.SnowflakeTimestamp(entry.ID)
-		if err != nil || timestamp.IsZero() {
-			continue
-		}
-		// Drop entries older than the supplied window.
-		// Without this, a past kick/ban audit entry could be
-		// re-used if the user re-joins and later leaves again.
-		if timestamp.Before(cutoff) {
-			continue
-		}
-
-		logs = append(logs, entry)
-	}
-
-	return logs, nil
+	return entries, err
 }
 
 func canViewChannel(
@@ -178,6 +171,48 @@ func canViewChannel(
 	return true
 }
 
+// Mentions of the distinct channels the logged messages were sent in.
+func logChannels(logs []*antispam.Log) []string {
+	var channels []string
+
+	for idx := range logs {
+		channel := fmt.Sprintf("<#%s>", logs[idx].Message.ChannelID)
+		if !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+// IDs of the logged messages.
+func logIDs(logs []*antispam.Log) []string {
+	ids := make([]string, 0, len(logs))
+	for idx := range logs {
+		ids = append(ids, logs[idx].Message.ID)
+	}
+
+	return ids
+}
+
+// Channel followed by its parents, i.e., the parent channel of a thread
+// and the category, as far as they are known to the state cache.
+func channelScope(session *discordgo.Session, channelID string) []string {
+	scope := []string{channelID}
+
+	for id := channelID; ; {
+		channel, err := session.State.Channel(id)
+		if err != nil || channel.ParentID == "" || slices.Contains(scope, channel.ParentID) {
+			break
+		}
+
+		id = channel.ParentID
+		scope = append(scope, id)
+	}
+
+	return scope
+}
+
 func logUser(
 	user *discordgo.User,
 	level log.Level,
@@ -215,9 +250,11 @@ func sendSilentEmbed(
 	session *discordgo.Session,
 	channel string,
 	embed *discordgo.MessageEmbed,
+	components ...discordgo.MessageComponent,
 ) (*discordgo.Message, error) {
 	return session.ChannelMessageSendComplex(channel, &discordgo.MessageSend{
-		Embeds: []*discordgo.MessageEmbed{embed},
-		Flags:  discordgo.MessageFlagsSuppressNotifications,
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+		Flags:      discordgo.MessageFlagsSuppressNotifications,
 	})
 }
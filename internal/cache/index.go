@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package cache
+
+import "sync"
+
+// Index is a bounded cache of values indexed by ID and grouped by a
+// secondary key (e.g., messages by their author), evicting the oldest
+// value once full.  Values are looked up by ID, and grouped values listed,
+// without scanning the whole cache.
+type Index[T any] struct {
+	id    func(*T) string
+	group func(*T) string
+
+	mu     sync.RWMutex
+	values []*T
+	head   int
+	count  int
+	ids    map[string]*T
+	groups map[string][]*T
+}
+
+// NewIndex returns an index holding up to size values, with the ID and
+// group of each value given by id and group respectively.
+func NewIndex[T any](size int, id, group func(*T) string) *Index[T] {
+	return &Index[T]{
+		id:     id,
+		group:  group,
+		values: make([]*T, max(size, 1)),
+		ids:    make(map[string]*T, size),
+		groups: make(map[string][]*T),
+	}
+}
+
+// Add the value, evicting the oldest value if full, and return the value
+// as held by the index.  A value with the same ID as one already held
+// takes its place in lookups by ID.
+func (x *Index[T]) Add(value T) *T {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.count == len(x.values) {
+		x.evict()
+	}
+
+	ptr := &value
+	x.values[(x.head+x.count)%len(x.values)] = ptr
+	x.count++
+
+	x.ids[x.id(ptr)] = ptr
+
+	key := x.group(ptr)
+	x.groups[key] = append(x.groups[key], ptr)
+
+	return ptr
+}
+
+// Evict the oldest value.  Values are added in order, so the oldest value
+// is also the oldest of its group.
+func (x *Index[T]) evict() {
+	ptr := x.values[x.head]
+
+	x.values[x.head] = nil
+	x.head = (x.head + 1) % len(x.values)
+	x.count--
+
+	if id := x.id(ptr); x.ids[id] == ptr {
+		delete(x.ids, id)
+	}
+
+	key := x.group(ptr)
+
+	group := x.groups[key]
+	if len(group) <= 1 {
+		delete(x.groups, key)
+		return
+	}
+
+	group[0] = nil
+	x.groups[key] = group[1:]
+}
+
+// Get the value with the ID.
+func (x *Index[T]) Get(id string) (*T, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	ptr, ok := x.ids[id]
+
+	return ptr, ok
+}
+
+// Group returns the values of the group, oldest first.
+func (x *Index[T]) Group(key string) []*T {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	group := x.groups[key]
+	if len(group) == 0 {
+		return nil
+	}
+
+	values := make([]*T, len(group))
+	copy(values, group)
+
+	return values
+}
+
+// ForEach calls fn for every value, oldest first.  The index must not be
+// added to from within fn.
+func (x *Index[T]) ForEach(fn func(*T)) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	for idx := range x.count {
+		fn(x.values[(x.head+idx)%len(x.values)])
+	}
+}
+
+// Len returns the number of values held.
+func (x *Index[T]) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return x.count
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+type entry struct {
+	id     string
+	author string
+}
+
+func newEntryIndex(size int) *Index[entry] {
+	return NewIndex(size,
+		func(e *entry) string { return e.id },
+		func(e *entry) string { return e.author },
+	)
+}
+
+func ids(entries []*entry) []string {
+	result := make([]string, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e.id)
+	}
+
+	return result
+}
+
+func TestIndex(t *testing.T) {
+	index := newEntryIndex(3)
+
+	index.Add(entry{"1", "a"})
+	index.Add(entry{"2", "b"})
+	index.Add(entry{"3", "a"})
+	index.Add(entry{"4", "a"})
+
+	if index.Len() != 3 {
+		t.Errorf("expected 3 values, got %d", index.Len())
+	}
+
+	if _, ok := index.Get("1"); ok {
+		t.Error("expected oldest value to be evicted")
+	}
+
+	if e, ok := index.Get("2"); !ok || e.author != "b" {
+		t.Errorf("expected value 2 by b, got %+v", e)
+	}
+
+	if got := fmt.Sprint(ids(index.Group("a"))); got != "[3 4]" {
+		t.Errorf("expected group a to hold [3 4], got %s", got)
+	}
+
+	index.Add(entry{"5", "c"})
+
+	if group := index.Group("b"); group != nil {
+		t.Errorf("expected group b to be empty, got %v", ids(group))
+	}
+
+	var all []*entry
+
+	index.ForEach(func(e *entry) { all = append(all, e) })
+
+	if got := fmt.Sprint(ids(all)); got != "[3 4 5]" {
+		t.Errorf("expected values [3 4 5], got %s", got)
+	}
+}
+
+func TestIndexDuplicate(t *testing.T) {
+	index := newEntryIndex(2)
+
+	index.Add(entry{"1", "a"})
+	index.Add(entry{"1", "b"})
+
+	if e, _ := index.Get("1"); e.author != "b" {
+		t.Errorf("expected latest value to be looked up, got %+v", e)
+	}
+
+	// Evicting the first value must not drop the lookup of the second.
+	index.Add(entry{"2", "a"})
+
+	if e, ok := index.Get("1"); !ok || e.author != "b" {
+		t.Errorf("expected latest value to remain, got %+v", e)
+	}
+}
+
+// Compare looking up the messages of an author and a message by ID, as
+// done for every message checked by antispam, against scanning the ring
+// buffer.
+func BenchmarkLookup(b *testing.B) {
+	for _, size := range []int{500, 2000, 5000, 10000} {
+		b.Run(fmt.Sprintf("Index%d", size), func(b *testing.B) {
+			index := newEntryIndex(size)
+			for idx := range size {
+				index.Add(entry{strconv.Itoa(idx), strconv.Itoa(idx % 100)})
+			}
+
+			b.ResetTimer()
+
+			for idx := range b.N {
+				index.Add(entry{strconv.Itoa(size + idx), "0"})
+
+				_ = index.Group("0")
+				_, _ = index.Get(strconv.Itoa(size + idx))
+			}
+		})
+
+		b.Run(fmt.Sprintf("RingBuffer%d", size), func(b *testing.B) {
+			buffer := NewRingBuffer[entry](uint64(size)) //nolint:gosec
+			for idx := range size {
+				buffer.Add(entry{strconv.Itoa(idx), strconv.Itoa(idx % 100)})
+			}
+
+			b.ResetTimer()
+
+			for idx := range b.N {
+				id := strconv.Itoa(size + idx)
+				buffer.Add(entry{id, "0"})
+
+				var group []*entry
+
+				buffer.ForEach(func(e *entry) {
+					if e.author == "0" {
+						group = append(group, e)
+					}
+				})
+
+				buffer.ForEach(func(e *entry) {
+					if e.id == id {
+						_ = e
+					}
+				})
+			}
+		})
+	}
+}
@@ -5,62 +5,153 @@ package cache
 
 import (
 	"sync/atomic"
-	"unsafe"
+	"time"
 )
 
+// RingBuffer is a fixed-size, lock-free buffer of values overwriting the
+// oldest value once full, safe for use by multiple goroutines.
+//
+// Every call to Add is assigned a sequence number by a single atomic
+// increment, which is the point at which it takes effect: values are kept
+// and read in that order, and a value is only ever replaced by one with a
+// later sequence number.  Reads (Size, Slice and ForEach) observe the
+// values added before the read began, less those that have since been
+// overwritten and those whose Add has not yet stored them, and never a
+// value from a slot midway through being written.
 type RingBuffer[T any] struct {
-	buffer []unsafe.Pointer
+	buffer []atomic.Pointer[slot[T]]
 	size   uint64
 	write  atomic.Uint64
-	read   atomic.Uint64
+
+	// Values older than ttl are treated as evicted, if non-zero.
+	ttl time.Duration
+	now func() time.Time
+}
+
+// A value held by the buffer, along with the sequence number of the Add
+// storing it.
+type slot[T any] struct {
+	seq   uint64
+	added time.Time
+	value T
 }
 
+// NewRingBuffer returns a buffer holding up to size values.
 func NewRingBuffer[T any](size uint64) *RingBuffer[T] {
+	size = max(size, 1)
+
 	return &RingBuffer[T]{
-		buffer: make([]unsafe.Pointer, size),
+		buffer: make([]atomic.Pointer[slot[T]], size),
 		size:   size,
+		now:    time.Now,
 	}
 }
 
+// NewTTLRingBuffer returns a buffer holding up to size values, evicting
+// values once they are older than ttl.
+func NewTTLRingBuffer[T any](size uint64, ttl time.Duration) *RingBuffer[T] {
+	r := NewRingBuffer[T](size)
+	r.ttl = ttl
+
+	return r
+}
+
+// Size returns the number of values held, including any expired values
+// not yet overwritten.
 func (r *RingBuffer[T]) Size() uint64 {
-	return r.write.Load() - r.read.Load()
+	return min(r.write.Load(), r.size)
 }
 
+// Add the value, overwriting the oldest value if full.
 func (r *RingBuffer[T]) Add(value T) {
-	if r.Size() >= r.size {
-		r.read.Add(1)
+	seq := r.write.Add(1) - 1
+	next := &slot[T]{seq: seq, value: value}
+
+	if r.ttl > 0 {
+		next.added = r.now()
 	}
 
-	ptr := unsafe.Pointer(&value)
-	idx := r.write.Load() % r.size
+	ptr := &r.buffer[seq%r.size]
 
-	atomic.StorePointer(&r.buffer[idx], ptr)
+	for {
+		// A slower Add, having claimed the slot a lap earlier, must not
+		// overwrite the value of a later one.
+		current := ptr.Load()
+		if current != nil && current.seq > seq {
+			return
+		}
 
-	r.write.Add(1)
+		if ptr.CompareAndSwap(current, next) {
+			return
+		}
+	}
 }
 
+// Slice returns a copy of the values held, oldest first.
 func (r *RingBuffer[T]) Slice() []T {
-	var result []T
+	result := make([]T, 0, r.Size())
 
-	for i := range r.Size() {
-		idx := (r.read.Load() + i) % r.size
-		ptr := atomic.LoadPointer(&r.buffer[idx])
-
-		if ptr != nil {
-			result = append(result, *(*T)(ptr))
-		}
-	}
+	r.each(func(s *slot[T]) {
+		result = append(result, s.value)
+	})
 
 	return result
 }
 
+// ForEach calls fn for each value held, oldest first.  Values are shared
+// with other readers, so fn must not modify them.
 func (r *RingBuffer[T]) ForEach(fn func(*T)) {
-	for i := range r.Size() {
-		idx := (r.read.Load() + i) % r.size
-		ptr := atomic.LoadPointer(&r.buffer[idx])
+	r.each(func(s *slot[T]) {
+		fn(&s.value)
+	})
+}
 
-		if ptr != nil {
-			fn((*T)(ptr))
+// Evict the expired values, releasing them rather than waiting for them to
+// be overwritten.  A no-op for a buffer without a TTL.
+func (r *RingBuffer[T]) Evict() {
+	if r.ttl <= 0 {
+		return
+	}
+
+	cutoff := r.now().Add(-r.ttl)
+
+	for idx := range r.buffer {
+		ptr := &r.buffer[idx]
+		if s := ptr.Load(); s != nil && s.added.Before(cutoff) {
+			// Leave the slot be if it has since been overwritten.
+			ptr.CompareAndSwap(s, nil)
 		}
 	}
 }
+
+// Call fn for each slot from the oldest sequence number still held up to
+// the last one claimed when called, skipping those overwritten since (or
+// not yet stored) and those expired.
+func (r *RingBuffer[T]) each(fn func(*slot[T])) {
+	var (
+		end   = r.write.Load()
+		start uint64
+	)
+
+	if end > r.size {
+		start = end - r.size
+	}
+
+	var cutoff time.Time
+	if r.ttl > 0 {
+		cutoff = r.now().Add(-r.ttl)
+	}
+
+	for seq := start; seq < end; seq++ {
+		s := r.buffer[seq%r.size].Load()
+		if s == nil || s.seq != seq {
+			continue
+		}
+
+		if r.ttl > 0 && s.added.Before(cutoff) {
+			continue
+		}
+
+		fn(s)
+	}
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package cache
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRingBuffer(t *testing.T) {
+	buffer := NewRingBuffer[int](3)
+
+	if got := buffer.Slice(); len(got) != 0 {
+		t.Errorf("expected empty buffer, got %v", got)
+	}
+
+	for value := range 5 {
+		buffer.Add(value)
+	}
+
+	if buffer.Size() != 3 {
+		t.Errorf("expected 3 values, got %d", buffer.Size())
+	}
+
+	if got := fmt.Sprint(buffer.Slice()); got != "[2 3 4]" {
+		t.Errorf("expected values [2 3 4], got %s", got)
+	}
+
+	var values []int
+
+	buffer.ForEach(func(value *int) { values = append(values, *value) })
+
+	if got := fmt.Sprint(values); got != "[2 3 4]" {
+		t.Errorf("expected values [2 3 4], got %s", got)
+	}
+}
+
+func TestTTLRingBuffer(t *testing.T) {
+	var (
+		now    = time.Now()
+		buffer = NewTTLRingBuffer[int](3, time.Minute)
+	)
+
+	buffer.now = func() time.Time { return now }
+
+	buffer.Add(1)
+	buffer.Add(2)
+
+	now = now.Add(30 * time.Second)
+
+	buffer.Add(3)
+
+	if got := fmt.Sprint(buffer.Slice()); got != "[1 2 3]" {
+		t.Errorf("expected values [1 2 3], got %s", got)
+	}
+
+	now = now.Add(45 * time.Second)
+
+	if got := fmt.Sprint(buffer.Slice()); got != "[3]" {
+		t.Errorf("expected expired values to be skipped, got %s", got)
+	}
+
+	buffer.Evict()
+
+	for idx := range buffer.buffer {
+		if s := buffer.buffer[idx].Load(); s != nil && s.value != 3 {
+			t.Errorf("expected expired value %d to be evicted", s.value)
+		}
+	}
+
+	buffer.Add(4)
+
+	if got := fmt.Sprint(buffer.Slice()); got != "[3 4]" {
+		t.Errorf("expected values [3 4], got %s", got)
+	}
+}
+
+// Add from many goroutines while reading, checking that every read sees
+// each writer's values in the order added and never more values than the
+// buffer holds.  Meant to be run with the race detector.
+func TestRingBufferConcurrent(t *testing.T) {
+	const (
+		writers = 8
+		adds    = 5000
+		size    = 64
+	)
+
+	type value struct{ writer, n int }
+
+	var (
+		buffer = NewRingBuffer[value](size)
+		wg     sync.WaitGroup
+		done   = make(chan struct{})
+	)
+
+	for writer := range writers {
+		wg.Go(func() {
+			for n := range adds {
+				buffer.Add(value{writer, n})
+			}
+		})
+	}
+
+	check := func() {
+		values := buffer.Slice()
+		if len(values) > size {
+			t.Errorf("read %d values from a buffer of %d", len(values), size)
+		}
+
+		last := make(map[int]int)
+		for _, v := range values {
+			if n, ok := last[v.writer]; ok && v.n <= n {
+				t.Errorf("writer %d: read value %d after %d", v.writer, v.n, n)
+			}
+
+			last[v.writer] = v.n
+		}
+	}
+
+	var readers sync.WaitGroup
+
+	for range runtime.GOMAXPROCS(0) {
+		readers.Go(func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					check()
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	if got := len(buffer.Slice()); got != size {
+		t.Errorf("expected a full buffer of %d values once settled, got %d", size, got)
+	}
+
+	check()
+}
+
+func BenchmarkRingBufferAdd(b *testing.B) {
+	buffer := NewRingBuffer[int](1024)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for n := 0; pb.Next(); n++ {
+			buffer.Add(n)
+		}
+	})
+}
+
+func BenchmarkRingBufferSlice(b *testing.B) {
+	for _, size := range []uint64{500, 2000, 5000, 10000} {
+		b.Run(fmt.Sprintf("Size%d", size), func(b *testing.B) {
+			buffer := NewRingBuffer[int](size)
+			for n := range size {
+				buffer.Add(int(n))
+			}
+
+			b.RunParallel(func(pb *testing.PB) {
+				for n := 0; pb.Next(); n++ {
+					buffer.Add(n)
+					_ = buffer.Slice()
+				}
+			})
+		})
+	}
+}
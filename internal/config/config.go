@@ -10,8 +10,9 @@ import (
 )
 
 type Settings struct {
-	BotSettings   `yaml:"bot"`
-	RelaySettings `yaml:"relay"`
+	BotSettings     `yaml:"bot"`
+	RelaySettings   `yaml:"relay"`
+	StorageSettings `yaml:"storage"`
 }
 
 func FromFile[T any](path string) (T, error) {
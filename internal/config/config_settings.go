@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/lcook/pulsar/internal/antispam"
+	"github.com/lcook/pulsar/internal/archive"
 )
 
 type BotSettings struct {
@@ -17,6 +18,12 @@ type BotSettings struct {
 	AlertError   bool     `yaml:"discord_alert_error"`
 	AlertChannel string   `yaml:"discord_alert_channel_id"`
 	ModRole      string   `yaml:"discord_mod_role_id"`
+	// Roles whose grants and revocations, like those of the moderator role
+	// and roles with moderation permissions, alert moderators.
+	SensitiveRoleIDs []string `yaml:"discord_sensitive_role_ids"`
+	// Number of messages per channel held by the state cache, which edits
+	// and deletions are logged from first.
+	StateCacheSize int `yaml:"discord_state_cache_size"`
 
 	GithubWebhookID    string `yaml:"discord_github_webhook_id"`
 	GithubWebhookToken string `yaml:"discord_github_webhook_token"`
@@ -25,15 +32,23 @@ type BotSettings struct {
 
 	Roles map[string]Role `yaml:"roles"`
 
+	Modmail ModmailSettings `yaml:"modmail"`
+
+	MessageArchive archive.Settings `yaml:"message_archive"`
+
 	AntiSpamSettings `yaml:"antispam"`
 }
 
 type AntiSpamSettings struct {
-	Enabled           bool                     `yaml:"enabled"`
-	MessageCacheSize  uint64                   `yaml:"message_cache_size"`
-	ExcludedRoleIDs   []string                 `yaml:"excluded_role_ids"`
-	MinumumAccountAge time.Duration            `yaml:"minimum_account_age"`
-	Rules             []antispam.HeuristicRule `yaml:"rules"`
+	Enabled           bool                           `yaml:"enabled"`
+	MessageCacheSize  int                            `yaml:"message_cache_size"`
+	ExcludedRoleIDs   []string                       `yaml:"excluded_role_ids"`
+	MinumumAccountAge time.Duration                  `yaml:"minimum_account_age"`
+	LinkList          string                         `yaml:"link_list"`
+	ShadowLogChannel  string                         `yaml:"shadow_log_channel_id"`
+	Raid              antispam.RaidSettings          `yaml:"raid"`
+	Impersonation     antispam.ImpersonationSettings `yaml:"impersonation"`
+	Rules             []antispam.HeuristicRule       `yaml:"rules"`
 }
 
 type RelaySettings struct {
@@ -42,6 +57,30 @@ type RelaySettings struct {
 
 	GithubWebhookEndpoint string `yaml:"github_webhook_endpoint"`
 	GithubWebhookSecret   string `yaml:"github_webhook_secret"`
+
+	GithubRoutes  []GithubRoute     `yaml:"github_routes"`
+	GithubMirrors map[string]string `yaml:"github_mirrors"`
+
+	LinkListEndpoint string `yaml:"link_list_endpoint"`
+	LinkListToken    string `yaml:"link_list_token"`
+}
+
+type GithubRoute struct {
+	Name         string   `yaml:"name"`
+	WebhookID    string   `yaml:"webhook_id"`
+	WebhookToken string   `yaml:"webhook_token"`
+	Repositories []string `yaml:"repositories"`
+	Branches     []string `yaml:"branches"`
+	Digest       string   `yaml:"digest"`
+}
+
+type StorageSettings struct {
+	Directory     string `yaml:"directory"`
+	EncryptionKey string `yaml:"encryption_key"`
+}
+
+type ModmailSettings struct {
+	ForumChannel string `yaml:"forum_channel_id"`
 }
 
 type Role struct {
@@ -17,6 +17,7 @@ const (
 	cgitRepo   string = cgitBase + "/%s/"
 	cgitBranch string = cgitBase + "/%s/?h=%s"
 	cgitCommit string = cgitBase + "/%s/commit/?id=%s"
+	cgitRange  string = cgitBase + "/%s/log/?h=%s&qt=range&q=%s"
 )
 
 type commit struct {
@@ -28,6 +29,9 @@ type commit struct {
 	Added     []string  `json:"added,omitempty"`
 	Removed   []string  `json:"removed,omitempty"`
 	Modified  []string  `json:"modified,omitempty"`
+	// Whether the commit was missing from the push event payload and
+	// instead read from the local mirror of the repository.
+	Backfilled bool `json:"backfilled,omitempty"`
 }
 
 type author struct {
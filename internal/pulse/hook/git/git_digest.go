@@ -0,0 +1,472 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package git
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/config"
+	"github.com/lcook/pulsar/internal/schedule"
+	"github.com/lcook/pulsar/internal/store"
+)
+
+const (
+	digestFile string = "digest.jsonl"
+	// Discord limits applied to each digest message sent.
+	digestMaxEmbeds      int = 10
+	digestMaxFields      int = 25
+	digestMaxFieldLength int = 1024
+	digestMaxLength      int = 6000
+)
+
+// Route forwards commits of matching repositories and branches to a
+// separate webhook, either as they arrive or accumulated into a digest
+// posted on a schedule.
+type route struct {
+	config.GithubRoute
+
+	schedule *schedule.Schedule
+}
+
+type digestEntry struct {
+	Route    string    `json:"route"`
+	Record   Record    `json:"record"`
+	Received time.Time `json:"received"`
+}
+
+func newRoutes(routes []config.GithubRoute) ([]route, error) {
+	var (
+		result = make([]route, 0, len(routes))
+		names  = make(map[string]struct{}, len(routes))
+	)
+
+	for _, r := range routes {
+		if r.Name == "" {
+			return nil, fmt.Errorf("git: route with webhook %q has no name", r.WebhookID)
+		}
+
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("git: duplicate route name %q", r.Name)
+		}
+
+		names[r.Name] = struct{}{}
+
+		var sched *schedule.Schedule
+
+		if r.Digest != "" {
+			parsed, err := schedule.Parse(r.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("git: route %q: %w", r.Name, err)
+			}
+
+			sched = parsed
+		}
+
+		result = append(result, route{r, sched})
+	}
+
+	return result, nil
+}
+
+func (r *route) digest() bool { return r.schedule != nil }
+
+// Whether the route accepts commits of the repository and branch.  An
+// empty list accepts anything, otherwise entries are shell patterns,
+// e.g., "stable/*".
+func (r *route) match(repo, branch string) bool {
+	matchAny := func(patterns []string, value string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return matchAny(r.Repositories, repo) && matchAny(r.Branches, branch)
+}
+
+func openDigest(dir string) (*store.Store[digestEntry], error) {
+	return store.Open[digestEntry](filepath.Join(dir, digestFile))
+}
+
+func (p *Pulse) relayRoutes(
+	session *discordgo.Session,
+	record *Record,
+	params *discordgo.WebhookParams,
+) {
+	for idx := range p.routes {
+		r := &p.routes[idx]
+		if !r.match(record.Repository, record.Branch) {
+			continue
+		}
+
+		fields := log.Fields{
+			"route":  r.Name,
+			"commit": record.ShortHash(),
+		}
+
+		if r.digest() {
+			if err := p.digest.Put(r.Name+"/"+record.Hash(), digestEntry{
+				Route:    r.Name,
+				Record:   *record,
+				Received: time.Now().UTC(),
+			}); err != nil {
+				log.WithFields(fields).Error("git: unable to add commit to digest")
+			}
+
+			continue
+		}
+
+		if _, err := session.WebhookExecute(
+			r.WebhookID,
+			r.WebhookToken,
+			false,
+			params,
+		); err != nil {
+			log.WithFields(fields).Error("git: unable to send message to route")
+		}
+	}
+}
+
+// Start relaying the pushes queued by Response, one at a time in the
+// order they arrived, and the scheduler responsible for posting the
+// digest of each route configured with one.
+func (p *Pulse) Start(session *discordgo.Session) {
+	p.queueMu.Lock()
+	p.deliveries = make(chan *commitEvent, deliveryQueueSize)
+	deliveries := p.deliveries
+	p.queueMu.Unlock()
+
+	p.wg.Go(func() {
+		for payload := range deliveries {
+			p.relayPush(session, payload)
+		}
+	})
+
+	p.scheduler = schedule.NewScheduler()
+
+	for idx := range p.routes {
+		r := &p.routes[idx]
+		if !r.digest() {
+			continue
+		}
+
+		p.scheduler.Add(r.schedule, func(timestamp time.Time) {
+			p.sendDigest(session, r, timestamp)
+		})
+
+		log.WithFields(log.Fields{
+			"route":    r.Name,
+			"schedule": r.Digest,
+			"next":     r.schedule.Next(time.Now()),
+		}).Info("git: scheduled commit digest")
+	}
+
+	p.scheduler.Start()
+}
+
+// Stop accepting pushes, waiting for those queued to be relayed, and
+// stop the scheduler.
+func (p *Pulse) Stop() {
+	p.queueMu.Lock()
+	if p.deliveries != nil {
+		close(p.deliveries)
+		p.deliveries = nil
+	}
+	p.queueMu.Unlock()
+
+	p.wg.Wait()
+
+	if p.scheduler != nil {
+		p.scheduler.Stop()
+	}
+}
+
+func (p *Pulse) sendDigest(
+	session *discordgo.Session,
+	r *route,
+	timestamp time.Time,
+) {
+	var (
+		entries []digestEntry
+		cutoff  time.Time
+	)
+
+	p.digest.Range(func(_ string, entry digestEntry) bool {
+		if entry.Route == r.Name {
+			entries = append(entries, entry)
+
+			if entry.Received.After(cutoff) {
+				cutoff = entry.Received
+			}
+		}
+
+		return true
+	})
+
+	if len(entries) == 0 {
+		log.WithFields(log.Fields{
+			"route": r.Name,
+		}).Debug("git: no commits to send in digest")
+
+		return
+	}
+
+	var (
+		parts  = digestEmbeds(entries, timestamp)
+		embeds = make([]*discordgo.MessageEmbed, 0, len(parts))
+		sent   int
+	)
+
+	for _, part := range parts {
+		embeds = append(embeds, part.embed)
+	}
+
+	for _, message := range packEmbeds(embeds) {
+		if _, err := session.WebhookExecute(
+			r.WebhookID,
+			r.WebhookToken,
+			false,
+			&discordgo.WebhookParams{Embeds: message},
+		); err != nil {
+			// Leave the remaining entries in place so that they are
+			// picked up again by the next digest.
+			log.WithFields(log.Fields{
+				"route":         r.Name,
+				"error_message": err.Error(),
+			}).Error("git: unable to send digest")
+
+			return
+		}
+
+		covered := parts[sent : sent+len(message)]
+		sent += len(message)
+		// Drop the entries of each message as it is sent, so that those
+		// already posted are not posted again should a later message
+		// fail.  Commits may have been received while the digest was
+		// being sent, only drop those that were included.
+		if _, err := p.digest.Prune(func(_ string, entry digestEntry) bool {
+			return entry.Route == r.Name &&
+				!entry.Received.After(cutoff) &&
+				slices.ContainsFunc(covered, func(part digestPart) bool {
+					return part.covers(&entry.Record)
+				})
+		}); err != nil {
+			log.WithFields(log.Fields{
+				"route":         r.Name,
+				"error_message": err.Error(),
+			}).Error("git: unable to prune digest")
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"route":   r.Name,
+		"commits": len(entries),
+	}).Info("git: sent commit digest")
+}
+
+// Embed of a digest, along with the repository and branches it covers.
+type digestPart struct {
+	embed      *discordgo.MessageEmbed
+	repository string
+	branches   []string
+}
+
+func (p *digestPart) covers(record *Record) bool {
+	return record.Repository == p.repository && slices.Contains(p.branches, record.Branch)
+}
+
+// Summarise the accumulated commits, producing an embed per repository
+// with a field per branch listing the number of commits per committer.
+func digestEmbeds(entries []digestEntry, timestamp time.Time) []digestPart {
+	var (
+		repos = make(map[string]map[string]map[string]int)
+		since = make(map[string]time.Time)
+		total = make(map[string]int)
+	)
+
+	for _, entry := range entries {
+		repo, branch := entry.Record.Repository, entry.Record.Branch
+		if repos[repo] == nil {
+			repos[repo] = make(map[string]map[string]int)
+		}
+
+		if repos[repo][branch] == nil {
+			repos[repo][branch] = make(map[string]int)
+		}
+
+		repos[repo][branch][entry.Record.Commit.Committer.String()]++
+		total[repo]++
+
+		if s, ok := since[repo]; !ok || entry.Received.Before(s) {
+			since[repo] = entry.Received
+		}
+	}
+
+	parts := make([]digestPart, 0, len(repos))
+
+	for _, repo := range slices.Sorted(maps.Keys(repos)) {
+		var (
+			branches   = repos[repo]
+			committers = make(map[string]struct{})
+			fields     = make([]*discordgo.MessageEmbedField, 0, len(branches))
+			order      = slices.Sorted(maps.Keys(branches))
+		)
+
+		for _, branch := range order {
+			counts := branches[branch]
+
+			var commits int
+
+			names := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+				return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+			})
+
+			lines := make([]string, 0, len(names))
+			for _, name := range names {
+				committers[name] = struct{}{}
+				commits += counts[name]
+
+				lines = append(lines, fmt.Sprintf("`%d` %s", counts[name], name))
+			}
+
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  fmt.Sprintf("%s (%d)", branch, commits),
+				Value: joinLimit(lines, digestMaxFieldLength),
+			})
+		}
+
+		record := Record{Repository: repo}
+
+		for _, chunk := range chunkFields(fields) {
+			// Fields are chunked in order, one per branch.
+			covered := order[:len(chunk)]
+			order = order[len(chunk):]
+
+			embed := &discordgo.MessageEmbed{
+				Title: fmt.Sprintf("%s repository digest", repo),
+				Description: fmt.Sprintf(
+					"**%d** commit(s) by **%d** committer(s) across **%d** branch(es) since <t:%d:f>",
+					total[repo],
+					len(committers),
+					len(branches),
+					since[repo].Unix(),
+				),
+				Color:     record.color(),
+				Fields:    chunk,
+				Timestamp: timestamp.Format(time.RFC3339),
+			}
+
+			parts = append(parts, digestPart{embed, repo, covered})
+		}
+	}
+
+	return parts
+}
+
+// Join lines up until the limit is reached, noting how many were left
+// out.
+func joinLimit(lines []string, limit int) string {
+	var builder strings.Builder
+
+	for idx, line := range lines {
+		var more string
+		if idx < len(lines)-1 {
+			more = fmt.Sprintf("\n… and %d more", len(lines)-idx)
+		}
+
+		if builder.Len()+len(line)+len(more)+1 > limit {
+			fmt.Fprintf(&builder, "\n… and %d more", len(lines)-idx)
+			break
+		}
+
+		if idx > 0 {
+			builder.WriteByte('\n')
+		}
+
+		builder.WriteString(line)
+	}
+
+	return builder.String()
+}
+
+// Split fields so that no embed exceeds the field count or total length
+// limits, leaving headroom for the title and description.
+func chunkFields(fields []*discordgo.MessageEmbedField) [][]*discordgo.MessageEmbedField {
+	var (
+		chunks  [][]*discordgo.MessageEmbedField
+		current = make([]*discordgo.MessageEmbedField, 0, digestMaxFields)
+		length  int
+	)
+
+	for _, field := range fields {
+		size := len(field.Name) + len(field.Value)
+		if len(current) == digestMaxFields ||
+			(len(current) > 0 && length+size > digestMaxLength-digestMaxFieldLength) {
+			chunks = append(chunks, current)
+			current, length = make([]*discordgo.MessageEmbedField, 0, digestMaxFields), 0
+		}
+
+		current = append(current, field)
+		length += size
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+func embedLength(embed *discordgo.MessageEmbed) int {
+	length := len(embed.Title) + len(embed.Description)
+	for _, field := range embed.Fields {
+		length += len(field.Name) + len(field.Value)
+	}
+
+	return length
+}
+
+// Split embeds into groups that can each be sent as a single message.
+func packEmbeds(embeds []*discordgo.MessageEmbed) [][]*discordgo.MessageEmbed {
+	var (
+		messages [][]*discordgo.MessageEmbed
+		current  = make([]*discordgo.MessageEmbed, 0, digestMaxEmbeds)
+		length   int
+	)
+
+	for _, embed := range embeds {
+		size := embedLength(embed)
+		if len(current) == digestMaxEmbeds ||
+			(len(current) > 0 && length+size > digestMaxLength) {
+			messages = append(messages, current)
+			current, length = make([]*discordgo.MessageEmbed, 0, digestMaxEmbeds), 0
+		}
+
+		current = append(current, embed)
+		length += size
+	}
+
+	if len(current) > 0 {
+		messages = append(messages, current)
+	}
+
+	return messages
+}
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package git
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/lcook/pulsar/internal/config"
+)
+
+func TestNewRoutes(t *testing.T) {
+	tt := []struct {
+		routes []config.GithubRoute
+		valid  bool
+	}{
+		{[]config.GithubRoute{{Name: "ports"}, {Name: "src", Digest: "@daily"}}, true},
+		{[]config.GithubRoute{{Name: ""}}, false},
+		{[]config.GithubRoute{{Name: "src"}, {Name: "src"}}, false},
+		{[]config.GithubRoute{{Name: "src", Digest: "0 25 * * *"}}, false},
+	}
+	for _, tc := range tt {
+		_, err := newRoutes(tc.routes)
+		if (err == nil) != tc.valid {
+			t.Errorf("%+v: expected valid=%v, got %v", tc.routes, tc.valid, err)
+		}
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	r := route{GithubRoute: config.GithubRoute{
+		Repositories: []string{"src"},
+		Branches:     []string{"main", "stable/*"},
+	}}
+
+	tt := []struct {
+		repo     string
+		branch   string
+		expected bool
+	}{
+		{"src", "main", true},
+		{"src", "stable/15", true},
+		{"src", "releng/14.3", false},
+		{"ports", "main", false},
+	}
+	for _, tc := range tt {
+		if actual := r.match(tc.repo, tc.branch); actual != tc.expected {
+			t.Errorf("%s/%s: expected %v, got %v", tc.repo, tc.branch, tc.expected, actual)
+		}
+	}
+
+	if !(&route{}).match("doc", "main") {
+		t.Error("expected route without filters to match")
+	}
+}
+
+func TestDigestEmbeds(t *testing.T) {
+	var (
+		timestamp = time.Date(2025, 12, 10, 0, 0, 0, 0, time.UTC)
+		entries   = make([]digestEntry, 0, 5)
+	)
+
+	for _, c := range []struct{ repo, branch, committer string }{
+		{"src", "main", "Alice"},
+		{"src", "main", "Bob"},
+		{"src", "main", "Bob"},
+		{"src", "stable/15", "Alice"},
+		{"ports", "main", "Carol"},
+	} {
+		entries = append(entries, digestEntry{
+			Record: Record{
+				Repository: c.repo,
+				Branch:     c.branch,
+				Commit: commit{
+					Committer: committer{author{Name: c.committer}},
+				},
+			},
+			Received: timestamp,
+		})
+	}
+
+	parts := digestEmbeds(entries, timestamp)
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 embeds, got %d", len(parts))
+	}
+
+	ports, src := parts[0].embed, parts[1].embed
+	if !strings.HasPrefix(ports.Title, "ports") || !strings.HasPrefix(src.Title, "src") {
+		t.Fatalf("unexpected order: %q, %q", ports.Title, src.Title)
+	}
+
+	if !strings.Contains(src.Description, "**4** commit(s) by **2** committer(s) across **2** branch(es)") {
+		t.Errorf("unexpected description %q", src.Description)
+	}
+
+	if len(src.Fields) != 2 ||
+		src.Fields[0].Name != "main (3)" ||
+		src.Fields[0].Value != "`2` Bob\n`1` Alice" ||
+		src.Fields[1].Name != "stable/15 (1)" {
+		t.Errorf("unexpected fields %+v %+v", src.Fields[0], src.Fields[1])
+	}
+
+	if !parts[1].covers(&entries[3].Record) || parts[0].covers(&entries[3].Record) {
+		t.Errorf("unexpected branches covered %v, %v", parts[0].branches, parts[1].branches)
+	}
+}
+
+func TestSendDigestPartialFailure(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Accept the first message of the digest only.
+		if requests.Add(1) > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	endpoint := discordgo.EndpointWebhookToken
+	discordgo.EndpointWebhookToken = func(wID, token string) string {
+		return server.URL + "/" + wID + "/" + token
+	}
+
+	defer func() { discordgo.EndpointWebhookToken = endpoint }()
+
+	digest, err := openDigest(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		p = Pulse{digest: digest}
+		r = route{GithubRoute: config.GithubRoute{Name: "src"}}
+	)
+	// An embed per repository, one more than fits in a single message.
+	for idx := range digestMaxEmbeds + 1 {
+		record := Record{Repository: fmt.Sprintf("repo%02d", idx), Branch: "main"}
+		if err := digest.Put(fmt.Sprintf("src/%d", idx), digestEntry{
+			Route:    r.Name,
+			Record:   record,
+			Received: time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session, _ := discordgo.New("")
+	p.sendDigest(session, &r, time.Now())
+
+	if requests.Load() != 2 {
+		t.Fatalf("expected 2 messages sent, got %d", requests.Load())
+	}
+
+	if digest.Len() != 1 {
+		t.Fatalf("expected 1 entry left, got %d", digest.Len())
+	}
+
+	if _, ok := digest.Get(fmt.Sprintf("src/%d", digestMaxEmbeds)); !ok {
+		t.Error("expected entry of the unsent message to be left")
+	}
+}
+
+func TestJoinLimit(t *testing.T) {
+	lines := []string{"aaaa", "bbbb", "cccc", "dddd"}
+
+	if actual := joinLimit(lines, 100); actual != strings.Join(lines, "\n") {
+		t.Errorf("expected all lines, got %q", actual)
+	}
+
+	actual := joinLimit(lines, 25)
+	if actual != "aaaa\nbbbb\n… and 2 more" {
+		t.Errorf("unexpected truncation %q", actual)
+	}
+}
+
+func TestPackEmbeds(t *testing.T) {
+	var (
+		small = &discordgo.MessageEmbed{Title: "small"}
+		large = &discordgo.MessageEmbed{Description: strings.Repeat("x", 4000)}
+	)
+
+	tt := []struct {
+		embeds   []*discordgo.MessageEmbed
+		expected []int
+	}{
+		{[]*discordgo.MessageEmbed{small, small}, []int{2}},
+		{[]*discordgo.MessageEmbed{large, large, small}, []int{1, 2}},
+		{
+			[]*discordgo.MessageEmbed{
+				small, small, small, small, small, small,
+				small, small, small, small, small,
+			},
+			[]int{10, 1},
+		},
+	}
+	for _, tc := range tt {
+		actual := packEmbeds(tc.embeds)
+		if len(actual) != len(tc.expected) {
+			t.Fatalf("expected %d messages, got %d", len(tc.expected), len(actual))
+		}
+
+		for idx := range actual {
+			if len(actual[idx]) != tc.expected[idx] {
+				t.Errorf("message %d: expected %d embeds, got %d", idx, tc.expected[idx], len(actual[idx]))
+			}
+		}
+	}
+}
@@ -8,10 +8,19 @@ import (
 	"strings"
 )
 
+const (
+	refTagPrefix string = "refs/tags/"
+)
+
 type commitEvent struct {
 	Ref        string     `json:"ref,omitempty"`
 	Before     string     `json:"before,omitempty"`
 	After      string     `json:"after,omitempty"`
+	Created    bool       `json:"created"`
+	Deleted    bool       `json:"deleted"`
+	Forced     bool       `json:"forced"`
+	Compare    string     `json:"compare,omitempty"`
+	Pusher     author     `json:"pusher"`
 	Repository repository `json:"repository"`
 	Commits    []commit   `json:"commits,omitempty"`
 }
@@ -22,6 +31,19 @@ func (ce *commitEvent) cleanRef() {
 	ce.Ref = strings.TrimPrefix(ce.Ref, "refs/heads/")
 }
 
+// Kind of reference the push was made to, either a branch or a tag.
+func (ce *commitEvent) refKind() string {
+	if strings.HasPrefix(ce.Ref, refTagPrefix) {
+		return "tag"
+	}
+
+	return "branch"
+}
+
+func (ce *commitEvent) refName() string {
+	return strings.TrimPrefix(ce.Ref, refTagPrefix)
+}
+
 func commitEventPayload(buf []byte) (*commitEvent, error) {
 	var payload commitEvent
 
@@ -22,3 +22,55 @@ func TestCleanRef(t *testing.T) {
 		}
 	}
 }
+
+func TestRefKind(t *testing.T) {
+	tt := []struct {
+		events   commitEvent
+		kind     string
+		expected string
+	}{
+		{commitEvent{Ref: "refs/heads/main"}, "branch", "main"},
+		{commitEvent{Ref: "refs/heads/stable/15"}, "branch", "stable/15"},
+		{commitEvent{Ref: "refs/tags/release/14.3.0"}, "tag", "release/14.3.0"},
+	}
+	for _, tc := range tt {
+		tc.events.cleanRef()
+
+		if tc.events.refKind() != tc.kind {
+			t.Errorf("expected %s, got %s", tc.kind, tc.events.refKind())
+		}
+
+		if tc.events.refName() != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, tc.events.refName())
+		}
+	}
+}
+
+func TestCommitEventPayload(t *testing.T) {
+	payload, err := commitEventPayload([]byte(`{
+		"ref": "refs/heads/main",
+		"before": "12a61f4e173fb3a11c05d64",
+		"after": "ffa61f4e173fb3a11c05d64",
+		"created": false,
+		"deleted": false,
+		"forced": true,
+		"compare": "https://github.com/freebsd/freebsd-src/compare/12a61f4e173f...ffa61f4e173f",
+		"pusher": {"name": "lcook", "email": "lcook@FreeBSD.org"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !payload.Forced || payload.Created || payload.Deleted {
+		t.Errorf(
+			"expected forced push, got created=%v deleted=%v forced=%v",
+			payload.Created,
+			payload.Deleted,
+			payload.Forced,
+		)
+	}
+
+	if payload.Pusher.Name != "lcook" {
+		t.Errorf("expected lcook, got %s", payload.Pusher.Name)
+	}
+}
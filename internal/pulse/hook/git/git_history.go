@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/lcook/pulsar/internal/store"
+)
+
+const (
+	historyFile string = "commits.jsonl"
+)
+
+// Record is a relayed commit along with the repository and branch it
+// was pushed to, as persisted in the commit history.
+type Record struct {
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	Commit     commit `json:"commit"`
+}
+
+func (r *Record) Hash() string { return r.Commit.ID }
+
+func (r *Record) ShortHash() string { return r.Commit.shortHash() }
+
+func (r *Record) color() int {
+	switch r.Repository {
+	case "src":
+		return repoSrc
+	case "ports":
+		return repoPorts
+	case "doc":
+		return repoDoc
+	}
+
+	return 0
+}
+
+// Embed returns the message embed detailing the commit, identical to
+// the one relayed through the Discord webhook.
+func (r *Record) Embed() *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Color:       r.color(),
+		Description: r.Commit.embedCommit(r.Repository, r.Branch),
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: func() string {
+				if r.Commit.Backfilled {
+					return fmt.Sprintf("%s repository (backfilled)", r.Repository)
+				}
+
+				return fmt.Sprintf("%s repository", r.Repository)
+			}(),
+		},
+		Author: func() *discordgo.MessageEmbedAuthor {
+			if r.Commit.Committer.Name != r.Commit.Author.Name {
+				return &discordgo.MessageEmbedAuthor{
+					Name: r.Commit.Author.Name,
+					IconURL: Avatar(
+						r.Commit.Author.Username,
+						r.Commit.Author.Email,
+					),
+				}
+			}
+
+			return &discordgo.MessageEmbedAuthor{}
+		}(),
+		Timestamp: r.Commit.Timestamp.Format(time.RFC3339),
+	}
+}
+
+// History is the persistent store of relayed commits, keyed by their
+// full hash.  The relay appends to it, whereas the bot only reads from
+// it in order to look up commits after the fact.
+type History struct {
+	store *store.Store[Record]
+}
+
+func OpenHistory(dir string) (*History, error) {
+	s, err := store.Open[Record](filepath.Join(dir, historyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return &History{s}, nil
+}
+
+// OpenHistoryReadOnly opens the history for looking up commits only, as
+// the bot does, leaving it to the relay to write to.
+func OpenHistoryReadOnly(dir string) (*History, error) {
+	s, err := store.OpenReadOnly[Record](filepath.Join(dir, historyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return &History{s}, nil
+}
+
+func (h *History) Add(record *Record) error {
+	return h.store.Put(record.Hash(), *record)
+}
+
+// Lookup returns every commit whose hash begins with the given prefix,
+// most recent first.
+func (h *History) Lookup(prefix string) []Record {
+	var records []Record
+
+	prefix = strings.ToLower(prefix)
+
+	h.store.Range(func(hash string, record Record) bool {
+		if strings.HasPrefix(hash, prefix) {
+			records = append(records, record)
+		}
+
+		return true
+	})
+
+	slices.SortFunc(records, func(a, b Record) int {
+		return b.Commit.Timestamp.Compare(a.Commit.Timestamp)
+	})
+
+	return records
+}
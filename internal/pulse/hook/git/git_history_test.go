@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryLookup(t *testing.T) {
+	history, err := OpenHistory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp := time.Date(2025, 12, 10, 0, 0, 0, 0, time.UTC)
+
+	for idx, id := range []string{
+		"12a61f4e173fb3a11c05d64",
+		"12a61f4aaaaaaaaaaaaaaaa",
+		"ffa61f4e173fb3a11c05d64",
+	} {
+		history.Add(&Record{
+			Repository: "src",
+			Branch:     "main",
+			Commit: commit{
+				ID:        id,
+				Timestamp: timestamp.Add(time.Duration(idx) * time.Hour),
+			},
+		})
+	}
+
+	tt := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"12a61f4", []string{"12a61f4aaaaaaaaaaaaaaaa", "12a61f4e173fb3a11c05d64"}},
+		{"12A61F4E", []string{"12a61f4e173fb3a11c05d64"}},
+		{"ffa61f4", []string{"ffa61f4e173fb3a11c05d64"}},
+		{"0000000", nil},
+	}
+	for _, tc := range tt {
+		actual := history.Lookup(tc.prefix)
+		if len(actual) != len(tc.expected) {
+			t.Fatalf("%s: expected %d records, got %d", tc.prefix, len(tc.expected), len(actual))
+		}
+
+		for idx := range actual {
+			if actual[idx].Hash() != tc.expected[idx] {
+				t.Errorf("%s: expected %s, got %s", tc.prefix, tc.expected[idx], actual[idx].Hash())
+			}
+		}
+	}
+}
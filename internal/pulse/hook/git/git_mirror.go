@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/store"
+)
+
+const (
+	headsFile string = "heads.jsonl"
+	// GitHub truncates the list of commits included in push event
+	// payloads, anything beyond this has to be read from the mirror.
+	githubMaxCommits int = 20
+	// Fields of each commit read from the mirror, separated by NUL and
+	// terminated by a record separator.  The list of files changed is
+	// appended by --name-status after each record.
+	mirrorFormat string = "--format=%x1e%H%x00%an%x00%ae%x00%cn%x00%ce%x00%cI%x00%B%x00"
+	mirrorFields int    = 8
+	// Commits relayed for a single push at most, with any older commits
+	// backfilled beyond this summarised instead so that a long outage
+	// does not flood the channel (and trip Discord rate limits).
+	maxBackfill int = 25
+)
+
+var objectName = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// Last seen head of a branch, used to detect pushes that were missed
+// while the relay was unavailable.
+type head struct {
+	Hash    string    `json:"hash"`
+	Updated time.Time `json:"updated"`
+}
+
+func openHeads(dir string) (*store.Store[head], error) {
+	return store.Open[head](filepath.Join(dir, headsFile))
+}
+
+// Commits to relay for the push, filling in whatever is missing from the
+// payload using the local mirror of the repository.  Commits are
+// missing either because earlier pushes were never delivered, so the
+// last head seen does not match the `before` of this push, or because
+// GitHub truncated the payload.  Backfilled commits beyond the newest
+// `maxBackfill` are returned separately, to be summarised rather than
+// relayed one by one.
+func (p *Pulse) backfill(payload *commitEvent) ([]commit, []commit) {
+	if p.heads == nil {
+		return payload.Commits, nil
+	}
+
+	var (
+		repo = payload.Repository.String()
+		key  = repo + ":" + payload.Ref
+	)
+
+	// Deliveries for the same repository are handled one at a time, so
+	// that concurrent deliveries do not backfill the same range, nor the
+	// head of one overwrite that of a later one.
+	lock, _ := p.headLocks.LoadOrStore(repo, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	last, seen := p.heads.Get(key)
+
+	defer func() {
+		var err error
+		if payload.Deleted {
+			err = p.heads.Delete(key)
+		} else {
+			err = p.heads.Put(key, head{payload.After, time.Now().UTC()})
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"ref":           key,
+				"error_message": err.Error(),
+			}).Error("git: unable to store branch head")
+		}
+	}()
+	// History of the branch was rewritten or is non-existent, nothing
+	// sensible can be backfilled.
+	if payload.Created || payload.Deleted || payload.Forced {
+		return payload.Commits, nil
+	}
+
+	var (
+		gap       = seen && last.Hash != payload.Before
+		truncated = len(payload.Commits) >= githubMaxCommits
+		fields    = log.Fields{
+			"ref":     key,
+			"last":    abbrev(last.Hash),
+			"before":  abbrev(payload.Before),
+			"commits": len(payload.Commits),
+		}
+	)
+
+	if !gap && !truncated {
+		return payload.Commits, nil
+	}
+
+	mirror, ok := p.GithubMirrors[repo]
+	if !ok {
+		if gap {
+			log.WithFields(fields).Warn("git: delivery gap detected without a mirror to backfill from")
+		}
+
+		return payload.Commits, nil
+	}
+
+	base := payload.Before
+	if gap {
+		base = last.Hash
+
+		log.WithFields(fields).Warn("git: delivery gap detected, backfilling from mirror")
+	}
+
+	if err := fetchMirror(mirror); err != nil {
+		log.WithFields(fields).WithField("error_message", err.Error()).
+			Warn("git: unable to fetch mirror, it may be out of date")
+	}
+
+	commits, err := mirrorCommits(mirror, base, payload.After)
+	if err != nil {
+		log.WithFields(fields).WithField("error_message", err.Error()).
+			Error("git: unable to read commits from mirror")
+
+		return payload.Commits, nil
+	}
+
+	return limitBackfill(mergeCommits(payload.Commits, commits))
+}
+
+// Split the commits into the newest `maxBackfill` to relay and those
+// older, which are omitted.
+func limitBackfill(commits []commit) ([]commit, []commit) {
+	if len(commits) <= maxBackfill {
+		return commits, nil
+	}
+
+	split := len(commits) - maxBackfill
+
+	return commits[split:], commits[:split]
+}
+
+// Merge the commits read from the mirror with those in the payload,
+// preferring the latter as they carry GitHub specific details.  Those
+// only present in the mirror are marked as backfilled.
+func mergeCommits(payload, mirror []commit) []commit {
+	if len(mirror) == 0 {
+		return payload
+	}
+
+	ids := make(map[string]int, len(payload))
+	for idx := range payload {
+		ids[payload[idx].ID] = idx
+	}
+
+	commits := make([]commit, 0, len(mirror))
+
+	for _, c := range mirror {
+		if idx, ok := ids[c.ID]; ok {
+			commits = append(commits, payload[idx])
+			continue
+		}
+
+		c.Backfilled = true
+		commits = append(commits, c)
+	}
+
+	return commits
+}
+
+func runGit(dir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	// Object names are validated before being passed along, the mirror
+	// path comes from the configuration file.
+	//nolint:gosec
+	cmd := exec.Command("git", append([]string{"--git-dir", dir}, args...)...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+func fetchMirror(dir string) error {
+	_, err := runGit(dir, "fetch", "--quiet", "--prune")
+
+	return err
+}
+
+// Read the commits reachable from `to` but not `from` from the mirror,
+// oldest first.
+func mirrorCommits(dir, from, to string) ([]commit, error) {
+	if !objectName.MatchString(from) || !objectName.MatchString(to) {
+		return nil, fmt.Errorf("git: invalid commit range %q..%q", from, to)
+	}
+
+	out, err := runGit(
+		dir,
+		"log",
+		"--reverse",
+		"--name-status",
+		mirrorFormat,
+		from+".."+to,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMirrorLog(out)
+}
+
+func parseMirrorLog(out []byte) ([]commit, error) {
+	var commits []commit
+
+	for record := range strings.SplitSeq(string(out), "\x1e") {
+		if record == "" {
+			continue
+		}
+
+		fields := strings.SplitN(record, "\x00", mirrorFields)
+		if len(fields) != mirrorFields {
+			return nil, fmt.Errorf("git: malformed log record %q", record)
+		}
+
+		timestamp, err := time.Parse(time.RFC3339, fields[5])
+		if err != nil {
+			return nil, err
+		}
+
+		c := commit{
+			ID:        fields[0],
+			Author:    author{Name: fields[1], Email: fields[2]},
+			Committer: committer{author{Name: fields[3], Email: fields[4]}},
+			Timestamp: timestamp,
+			Message:   strings.TrimSpace(fields[6]),
+		}
+
+		for line := range strings.SplitSeq(fields[7], "\n") {
+			status := strings.Split(line, "\t")
+			if len(status) < 2 || status[0] == "" {
+				continue
+			}
+
+			switch status[0][0] {
+			case 'A':
+				c.Added = append(c.Added, status[1])
+			case 'D':
+				c.Removed = append(c.Removed, status[1])
+			case 'R':
+				c.Removed = append(c.Removed, status[1])
+				c.Added = append(c.Added, status[len(status)-1])
+			case 'C':
+				c.Added = append(c.Added, status[len(status)-1])
+			default:
+				c.Modified = append(c.Modified, status[1])
+			}
+		}
+
+		commits = append(commits, c)
+	}
+
+	return commits, nil
+}
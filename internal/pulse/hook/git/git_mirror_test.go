@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func gitRepo(t *testing.T) (string, func(...string) string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+
+	run := func(args ...string) string {
+		t.Helper()
+
+		//nolint:gosec
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Alice",
+			"GIT_AUTHOR_EMAIL=alice@FreeBSD.org",
+			"GIT_COMMITTER_NAME=Bob",
+			"GIT_COMMITTER_EMAIL=bob@FreeBSD.org",
+			"GIT_CONFIG_GLOBAL=/dev/null",
+		)
+
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+
+		return strings.TrimSpace(string(out))
+	}
+
+	run("init", "--quiet")
+
+	return dir, run
+}
+
+func TestMirrorCommits(t *testing.T) {
+	dir, run := gitRepo(t)
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("README", "pulsar\n")
+	run("add", "README")
+	run("commit", "--quiet", "-m", "Initial commit")
+	base := run("rev-parse", "HEAD")
+
+	write("Makefile", "all:\n")
+	run("add", "Makefile")
+	run("commit", "--quiet", "-m", "Add Makefile\n\nLonger description.")
+
+	run("mv", "README", "README.md")
+	write("Makefile", "all: build\n")
+	run("commit", "--quiet", "-am", "Rename README")
+	tip := run("rev-parse", "HEAD")
+
+	commits, err := mirrorCommits(filepath.Join(dir, ".git"), base, tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(commits))
+	}
+
+	first, second := commits[0], commits[1]
+
+	if first.Message != "Add Makefile\n\nLonger description." {
+		t.Errorf("unexpected message %q", first.Message)
+	}
+
+	if first.Author.Name != "Alice" || first.Committer.Name != "Bob" ||
+		first.Committer.Email != "bob@FreeBSD.org" {
+		t.Errorf("unexpected author/committer %+v %+v", first.Author, first.Committer)
+	}
+
+	if !slices.Equal(first.Added, []string{"Makefile"}) {
+		t.Errorf("expected Makefile added, got %v", first.Added)
+	}
+
+	if second.ID != tip ||
+		!slices.Equal(second.Added, []string{"README.md"}) ||
+		!slices.Equal(second.Removed, []string{"README"}) ||
+		!slices.Equal(second.Modified, []string{"Makefile"}) {
+		t.Errorf("unexpected second commit %+v", second)
+	}
+
+	if _, err := mirrorCommits(dir, "--output=/tmp/x", tip); err == nil {
+		t.Error("expected invalid commit range to be rejected")
+	}
+}
+
+func TestMergeCommits(t *testing.T) {
+	payload := []commit{
+		{ID: "c", Author: author{Username: "lcook"}},
+		{ID: "d", Author: author{Username: "lcook"}},
+	}
+	mirror := []commit{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}
+
+	commits := mergeCommits(payload, mirror)
+	if len(commits) != 4 {
+		t.Fatalf("expected 4 commits, got %d", len(commits))
+	}
+
+	for idx, expected := range []struct {
+		id         string
+		backfilled bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"c", false},
+		{"d", false},
+	} {
+		if commits[idx].ID != expected.id || commits[idx].Backfilled != expected.backfilled {
+			t.Errorf(
+				"commit %d: expected %s (backfilled=%v), got %s (backfilled=%v)",
+				idx,
+				expected.id,
+				expected.backfilled,
+				commits[idx].ID,
+				commits[idx].Backfilled,
+			)
+		}
+	}
+
+	if commits[2].Author.Username != "lcook" {
+		t.Error("expected payload commit to be preferred over mirror")
+	}
+}
+
+func TestLimitBackfill(t *testing.T) {
+	commits := make([]commit, maxBackfill+5)
+	for idx := range commits {
+		commits[idx].ID = strconv.Itoa(idx)
+	}
+
+	kept, omitted := limitBackfill(commits)
+	if len(kept) != maxBackfill || len(omitted) != 5 {
+		t.Fatalf("expected %d kept and 5 omitted, got %d and %d", maxBackfill, len(kept), len(omitted))
+	}
+
+	if kept[0].ID != "5" || omitted[len(omitted)-1].ID != "4" {
+		t.Errorf("expected the oldest commits to be omitted, got %s and %s", kept[0].ID, omitted[len(omitted)-1].ID)
+	}
+
+	if kept, omitted := limitBackfill(commits[:3]); len(kept) != 3 || omitted != nil {
+		t.Errorf("expected nothing omitted, got %d", len(omitted))
+	}
+}
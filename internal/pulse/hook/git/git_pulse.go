@@ -10,15 +10,21 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/lcook/pulsar/internal/config"
+	"github.com/lcook/pulsar/internal/schedule"
+	"github.com/lcook/pulsar/internal/store"
 )
 
+// Number of pushes queued to be relayed at most.
+const deliveryQueueSize int = 64
+
 const (
 	repoPorts int = 0xB58900
 	repoSrc   int = 0xDC322F
@@ -28,6 +34,17 @@ const (
 type Pulse struct {
 	config.Settings
 	Option byte
+
+	history   *History
+	heads     *store.Store[head]
+	headLocks sync.Map
+	routes    []route
+	digest    *store.Store[digestEntry]
+	scheduler *schedule.Scheduler
+
+	queueMu    sync.Mutex
+	deliveries chan *commitEvent
+	wg         sync.WaitGroup
 }
 
 func (p *Pulse) Endpoint() string { return p.GithubWebhookEndpoint }
@@ -67,12 +84,14 @@ func (p *Pulse) validHmac(
 	return true
 }
 
+// Response accepts pushes from GitHub, queueing them to be relayed with
+// the session given to Start.
 func (p *Pulse) Response(
-	resp any,
+	_ any,
 ) func(w http.ResponseWriter, r *http.Request) {
-	session := resp.(*discordgo.Session)
-
 	return func(writer http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+
 		buf, err := io.ReadAll(req.Body)
 		if err != nil {
 			log.Error("git: failed to read payload")
@@ -86,6 +105,7 @@ func (p *Pulse) Response(
 		payload, err := commitEventPayload(buf)
 		if err != nil {
 			log.Error("git: failed to unmarshal payload")
+			return
 		}
 
 		log.WithFields(log.Fields{
@@ -94,89 +114,192 @@ func (p *Pulse) Response(
 			"repository": payload.Repository,
 		}).Debug("git: received github payload")
 
-		var color int
+		// Relaying a push takes a webhook message per commit, so it is
+		// done off the request path lest GitHub time the delivery out.
+		// A delivery dropped as the queue is full is backfilled from the
+		// mirror along with the next push to the branch, if configured.
+		if !p.enqueue(payload) {
+			log.WithFields(log.Fields{
+				"branch":     payload.Ref,
+				"repository": payload.Repository,
+			}).Warn("git: delivery queue full, dropping payload")
+
+			writer.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// Queue the push to be relayed, returning false if the queue is full or
+// has not been started (see Start).
+func (p *Pulse) enqueue(payload *commitEvent) bool {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+
+	if p.deliveries == nil {
+		return false
+	}
+
+	select {
+	case p.deliveries <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+// Relay the push to Discord, reference changes and commits alike.
+func (p *Pulse) relayPush(session *discordgo.Session, payload *commitEvent) {
+	if embed := payload.refEmbed(); embed != nil {
+		p.relayRef(session, payload, embed)
+	}
+
+	commits, omitted := p.backfill(payload)
+	// Enumerate through all of the commits in the GitHub payload data,
+	// passing them off to a Discord Webhook that emits an embedded
+	// message containing relevant information of a commit.
+	for idx, commit := range commits {
+		log.WithFields(log.Fields{
+			"commit":  commit.shortHash(),
+			"author":  commit.Committer.String(),
+			"message": strings.Split(commit.Message, "\n")[0],
+		}).Trace("git: parsed commit")
+
+		queue := fmt.Sprintf("%d/%d", idx+1, len(commits))
+
+		record := &Record{
+			Repository: payload.Repository.String(),
+			Branch:     payload.Ref,
+			Commit:     commit,
+		}
+
+		if p.history != nil {
+			if err := p.history.Add(record); err != nil {
+				log.WithFields(log.Fields{
+					"commit": commit.shortHash(),
+					"error":  err,
+				}).Error("git: unable to store commit in history")
+			}
+		}
 
-		switch payload.Repository.String() {
-		case "src":
-			color = repoSrc
-		case "ports":
-			color = repoPorts
-		case "doc":
-			color = repoDoc
+		params := &discordgo.WebhookParams{
+			Username: commit.Committer.Name,
+			AvatarURL: Avatar(
+				commit.Committer.Username,
+				commit.Committer.Email,
+			),
+			Embeds: []*discordgo.MessageEmbed{record.Embed()},
 		}
-		// Enumerate through all of the commits in the GitHub payload data,
-		// passing them off to a Discord Webhook that emits an embedded
-		// message containing relevant information of a commit.
-		for idx, commit := range payload.Commits {
+
+		p.relayRoutes(session, record, params)
+
+		if p.GithubWebhookID == "" {
+			continue
+		}
+
+		_, err := session.WebhookExecute(
+			p.GithubWebhookID,
+			p.GithubWebhookToken,
+			false,
+			params,
+		)
+		if err != nil {
 			log.WithFields(log.Fields{
+				"webhook": p.GithubWebhookID,
 				"commit":  commit.shortHash(),
 				"author":  commit.Committer.String(),
-				"message": strings.Split(commit.Message, "\n")[0],
-			}).Trace("git: parsed commit")
+				"queue":   queue,
+			}).Error("git: unable to send message")
 
-			queue := fmt.Sprintf("%d/%d", idx+1, len(payload.Commits))
+			continue
+		}
 
-			params := &discordgo.WebhookParams{
-				Username: commit.Committer.Name,
-				AvatarURL: Avatar(
-					commit.Committer.Username,
-					commit.Committer.Email,
-				),
-				Embeds: []*discordgo.MessageEmbed{
-					{
-						Color: color,
-						Description: commit.embedCommit(
-							payload.Repository.String(),
-							payload.Ref,
-						),
-						Footer: &discordgo.MessageEmbedFooter{
-							Text: fmt.Sprintf(
-								"%s repository",
-								payload.Repository.String(),
-							),
-						},
-						Author: func() *discordgo.MessageEmbedAuthor {
-							if commit.Committer.Name != commit.Author.Name {
-								return &discordgo.MessageEmbedAuthor{
-									Name: commit.Author.Name,
-									IconURL: Avatar(
-										commit.Author.Username,
-										commit.Author.Email,
-									),
-								}
-							}
-
-							return &discordgo.MessageEmbedAuthor{}
-						}(),
-						Timestamp: commit.Timestamp.Format(time.RFC3339),
-					},
-				},
-			}
+		log.WithFields(log.Fields{
+			"commit": commit.shortHash(),
+			"queue":  queue,
+		}).Trace("git: sent message to discord")
+	}
 
-			_, err = session.WebhookExecute(
-				p.GithubWebhookID,
-				p.GithubWebhookToken,
-				false,
-				params,
-			)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"webhook": p.GithubWebhookID,
-					"commit":  commit.shortHash(),
-					"author":  commit.Committer.String(),
-					"queue":   queue,
-				}).Error("git: unable to send message")
+	if len(omitted) > 0 {
+		p.relayOmitted(session, payload, omitted)
+	}
+}
 
-				continue
+// Summarise the backfilled commits too many to relay one by one, linking
+// to their log on cgit.  They are still added to the history, so they can
+// be looked up all the same.
+func (p *Pulse) relayOmitted(
+	session *discordgo.Session,
+	payload *commitEvent,
+	omitted []commit,
+) {
+	record := Record{
+		Repository: payload.Repository.String(),
+		Branch:     payload.Ref,
+	}
+
+	for _, c := range omitted {
+		record.Commit = c
+		if p.history != nil {
+			if err := p.history.Add(&record); err != nil {
+				log.WithFields(log.Fields{
+					"commit": c.shortHash(),
+					"error":  err,
+				}).Error("git: unable to store commit in history")
 			}
+		}
+	}
 
-			log.WithFields(log.Fields{
-				"commit": commit.shortHash(),
-				"queue":  queue,
-			}).Trace("git: sent message to discord")
+	fields := log.Fields{
+		"ref":     record.Repository + ":" + record.Branch,
+		"omitted": len(omitted),
+	}
+
+	log.WithFields(fields).Warn("git: too many commits backfilled, summarising the oldest")
+
+	params := &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{{
+			Description: fmt.Sprintf(
+				"… and [%d older commit(s)](%s) to %s, too many to show",
+				len(omitted),
+				fmt.Sprintf(
+					cgitRange,
+					record.Repository,
+					url.QueryEscape(record.Branch),
+					url.QueryEscape(omitted[0].ID+"^.."+omitted[len(omitted)-1].ID),
+				),
+				record.Branch,
+			),
+			Color: record.color(),
+		}},
+	}
+
+	for idx := range p.routes {
+		r := &p.routes[idx]
+		if r.digest() || !r.match(record.Repository, record.Branch) {
+			continue
 		}
 
-		defer req.Body.Close()
+		if _, err := session.WebhookExecute(r.WebhookID, r.WebhookToken, false, params); err != nil {
+			log.WithFields(fields).WithField("route", r.Name).
+				Error("git: unable to send omitted commits to route")
+		}
+	}
+
+	if p.GithubWebhookID == "" {
+		return
+	}
+
+	if _, err := session.WebhookExecute(
+		p.GithubWebhookID,
+		p.GithubWebhookToken,
+		false,
+		params,
+	); err != nil {
+		log.WithFields(fields).Error("git: unable to send omitted commits")
 	}
 }
 
@@ -188,5 +311,50 @@ func (p *Pulse) LoadConfig(path string) error {
 
 	p.Settings = contents
 
+	if p.Directory != "" {
+		history, err := OpenHistory(p.Directory)
+		if err != nil {
+			return err
+		}
+
+		p.history = history
+
+		heads, err := openHeads(p.Directory)
+		if err != nil {
+			return err
+		}
+
+		p.heads = heads
+	}
+
+	routes, err := newRoutes(p.GithubRoutes)
+	if err != nil {
+		return err
+	}
+
+	p.routes = routes
+
+	for idx := range p.routes {
+		if !p.routes[idx].digest() {
+			continue
+		}
+
+		if p.Directory == "" {
+			return fmt.Errorf(
+				"git: digest route %q requires a storage directory",
+				p.routes[idx].Name,
+			)
+		}
+
+		if p.digest == nil {
+			digest, err := openDigest(p.Directory)
+			if err != nil {
+				return err
+			}
+
+			p.digest = digest
+		}
+	}
+
 	return nil
 }
@@ -4,6 +4,7 @@
 package git
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha1" //nolint
 	"encoding/hex"
@@ -36,3 +37,41 @@ func TestValidHmac(t *testing.T) {
 		t.Error()
 	}
 }
+
+func TestResponseQueue(t *testing.T) {
+	var (
+		p       Pulse
+		payload = []byte(`{"ref":"refs/heads/main","repository":{"name":"freebsd-src"}}`)
+	)
+
+	p.GithubWebhookSecret = "deadbeef"
+
+	deliver := func() int {
+		hm := hmac.New(sha1.New, []byte(p.GithubWebhookSecret))
+		hm.Write(payload)
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+		req.Header.Add("X-Hub-Signature", "sha1="+hex.EncodeToString(hm.Sum(nil)))
+
+		w := httptest.NewRecorder()
+		p.Response(nil)(w, req)
+
+		return w.Code
+	}
+
+	if code := deliver(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected delivery to be refused before starting, got %d", code)
+	}
+
+	p.Start(nil)
+
+	if code := deliver(); code != http.StatusAccepted {
+		t.Errorf("expected delivery to be accepted, got %d", code)
+	}
+
+	p.Stop()
+
+	if code := deliver(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected delivery to be refused once stopped, got %d", code)
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package git
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/util"
+)
+
+const (
+	refCreated int = 0x859900
+	refDeleted int = 0xDC322F
+	refForced  int = 0xCB4B16
+)
+
+const (
+	tplRefCreatedPath string = "templates/ref_created.tpl"
+	tplRefDeletedPath string = "templates/ref_deleted.tpl"
+	tplRefForcedPath  string = "templates/ref_forced.tpl"
+)
+
+//go:embed templates/ref_*.tpl
+var tplRefData embed.FS
+
+func abbrev(hash string) string {
+	if len(hash) < 7 {
+		return hash
+	}
+
+	return hash[0:7]
+}
+
+// Embed describing a change to the reference itself rather than the
+// commits pushed to it, i.e., a branch being created, deleted or
+// force-pushed.  Returns nil for regular pushes.
+func (ce *commitEvent) refEmbed() *discordgo.MessageEmbed {
+	var (
+		path  string
+		color int
+	)
+
+	switch {
+	case ce.Deleted:
+		path, color = tplRefDeletedPath, refDeleted
+	case ce.Created:
+		path, color = tplRefCreatedPath, refCreated
+	case ce.Forced:
+		path, color = tplRefForcedPath, refForced
+	default:
+		return nil
+	}
+
+	repo := ce.Repository.String()
+
+	return &discordgo.MessageEmbed{
+		Color: color,
+		Description: util.EmbedDescription(path, tplRefData, map[string]any{
+			"kind":      ce.refKind(),
+			"refname":   ce.refName(),
+			"gitref":    fmt.Sprintf(cgitBranch, repo, ce.refName()),
+			"before":    abbrev(ce.Before),
+			"gitbefore": fmt.Sprintf(cgitCommit, repo, ce.Before),
+			"after":     abbrev(ce.After),
+			"gitafter":  fmt.Sprintf(cgitCommit, repo, ce.After),
+			"compare":   ce.Compare,
+		}),
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%s repository", repo),
+		},
+	}
+}
+
+func (p *Pulse) relayRef(
+	session *discordgo.Session,
+	payload *commitEvent,
+	embed *discordgo.MessageEmbed,
+) {
+	fields := log.Fields{
+		"ref":     payload.Ref,
+		"before":  abbrev(payload.Before),
+		"after":   abbrev(payload.After),
+		"created": payload.Created,
+		"deleted": payload.Deleted,
+		"forced":  payload.Forced,
+		"pusher":  payload.Pusher.String(),
+	}
+	// As with commits, reference changes are only relayed to the main
+	// webhook when one is configured.
+	if p.GithubWebhookID == "" {
+		if payload.Forced {
+			log.WithFields(fields).Warn("git: force-push received")
+		}
+
+		return
+	}
+	// Wait for the webhook message to be created when force-pushing, so
+	// that we are able to forward it to the alert channel afterwards.
+	message, err := session.WebhookExecute(
+		p.GithubWebhookID,
+		p.GithubWebhookToken,
+		payload.Forced,
+		&discordgo.WebhookParams{
+			Username:  payload.Pusher.Name,
+			AvatarURL: Avatar(payload.Pusher.Name, payload.Pusher.Email),
+			Embeds:    []*discordgo.MessageEmbed{embed},
+		},
+	)
+	if err != nil {
+		log.WithFields(fields).Error("git: unable to send reference message")
+		return
+	}
+
+	if !payload.Forced {
+		log.WithFields(fields).Info("git: sent reference message to discord")
+		return
+	}
+
+	log.WithFields(fields).Warn("git: force-push received")
+	// A force-push to any of the branches should never happen and warrants
+	// immediate attention, so forward the message and ping moderators.
+	if p.AlertChannel != "" {
+		session.ChannelMessageSendReply(p.AlertChannel, "", message.Forward())
+
+		if p.ModRole != "" {
+			session.ChannelMessageSend(
+				p.AlertChannel,
+				fmt.Sprintf("<@&%s>", p.ModRole),
+			)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRefEmbed(t *testing.T) {
+	var (
+		before = "12a61f4e173fb3a11c05d64"
+		after  = "ffa61f4e173fb3a11c05d64"
+	)
+
+	tt := []struct {
+		events   commitEvent
+		color    int
+		expected []string
+	}{
+		{
+			commitEvent{Ref: "main", Before: before, After: after},
+			0,
+			nil,
+		},
+		{
+			commitEvent{Ref: "stable/15", Created: true, After: after},
+			refCreated,
+			[]string{"New branch", "stable/15", "ffa61f4"},
+		},
+		{
+			commitEvent{Ref: "stable/15", Deleted: true, Before: before},
+			refDeleted,
+			[]string{"Deleted branch", "stable/15", "12a61f4"},
+		},
+		{
+			commitEvent{Ref: "main", Forced: true, Before: before, After: after},
+			refForced,
+			[]string{"Force-pushed branch", "12a61f4", "ffa61f4"},
+		},
+	}
+	for _, tc := range tt {
+		embed := tc.events.refEmbed()
+		if tc.expected == nil {
+			if embed != nil {
+				t.Errorf("expected no embed, got %q", embed.Description)
+			}
+
+			continue
+		}
+
+		if embed == nil {
+			t.Fatalf("expected embed for %+v", tc.events)
+		}
+
+		if embed.Color != tc.color {
+			t.Errorf("expected color %x, got %x", tc.color, embed.Color)
+		}
+
+		for _, substr := range tc.expected {
+			if !strings.Contains(embed.Description, substr) {
+				t.Errorf("expected %q in %q", substr, embed.Description)
+			}
+		}
+	}
+}
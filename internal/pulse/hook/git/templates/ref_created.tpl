@@ -0,0 +1 @@
+New {{.kind}} [{{.refname}}]({{.gitref}}) created at [{{.after}}]({{.gitafter}})
@@ -0,0 +1 @@
+Deleted {{.kind}} **{{.refname}}**, previously at [{{.before}}]({{.gitbefore}})
@@ -0,0 +1 @@
+Force-pushed {{.kind}} [{{.refname}}]({{.gitref}}) from [{{.before}}]({{.gitbefore}}) to [{{.after}}]({{.gitafter}}){{if .compare}} - [compare]({{.compare}}){{end}}
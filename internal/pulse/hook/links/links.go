@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package links
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lcook/pulsar/internal/antispam"
+	"github.com/lcook/pulsar/internal/config"
+)
+
+// Maximum size of an update request body.
+const maxPayloadSize int64 = 1 << 20
+
+// Pulse updates the antispam link list shared with the bot, allowing
+// external feeds or tooling to block and allow domains at runtime.
+//
+// Requests are authenticated with a bearer token, i.e., the header
+// `Authorization: Bearer <link_list_token>`, and carry a JSON body such as:
+//
+//	{"block": ["example.com"], "allow": ["example.org"], "remove": ["example.net"]}
+type Pulse struct {
+	config.Settings
+	Option byte
+
+	list *antispam.LinkList
+}
+
+type update struct {
+	Block  []string `json:"block"`
+	Allow  []string `json:"allow"`
+	Remove []string `json:"remove"`
+}
+
+type summary struct {
+	Blocked int `json:"blocked"`
+	Allowed int `json:"allowed"`
+}
+
+func (p *Pulse) Endpoint() string { return p.LinkListEndpoint }
+
+func (p *Pulse) Options() byte { return p.Option }
+
+func (p *Pulse) authorized(req *http.Request) bool {
+	token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !found || p.LinkListToken == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.LinkListToken)) == 1
+}
+
+func (p *Pulse) Response(_ any) func(w http.ResponseWriter, r *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+
+		if !p.authorized(req) {
+			log.WithFields(log.Fields{
+				"client": req.Header.Get("X-FORWARDED-FOR"),
+			}).Warn("links: unauthorized request received")
+			writer.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		buf, err := io.ReadAll(io.LimitReader(req.Body, maxPayloadSize))
+		if err != nil {
+			log.Error("links: failed to read payload")
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		var payload update
+		if err := json.Unmarshal(buf, &payload); err != nil {
+			log.Error("links: failed to unmarshal payload")
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if err := p.list.Update(payload.Block, payload.Allow, payload.Remove); err != nil {
+			log.WithFields(log.Fields{
+				"path":  p.list.Path(),
+				"error": err,
+			}).Error("links: unable to update link list")
+			writer.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		blocked, allowed := p.list.Len()
+
+		log.WithFields(log.Fields{
+			"block":   len(payload.Block),
+			"allow":   len(payload.Allow),
+			"remove":  len(payload.Remove),
+			"blocked": blocked,
+			"allowed": allowed,
+		}).Info("links: updated link list")
+
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(summary{Blocked: blocked, Allowed: allowed})
+	}
+}
+
+func (p *Pulse) LoadConfig(path string) error {
+	contents, err := config.FromFile[config.Settings](path)
+	if err != nil {
+		return err
+	}
+
+	p.Settings = contents
+
+	if p.LinkListEndpoint == "" {
+		return nil
+	}
+
+	if p.LinkList == "" || p.LinkListToken == "" {
+		return errors.New("links: link_list and link_list_token are required by link_list_endpoint")
+	}
+
+	list, err := antispam.OpenLinkList(p.LinkList)
+	if err != nil {
+		return err
+	}
+
+	p.list = list
+
+	return nil
+}
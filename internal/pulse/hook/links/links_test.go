@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package links
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lcook/pulsar/internal/antispam"
+)
+
+func TestResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.txt")
+
+	list, err := antispam.OpenLinkList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Pulse{list: list}
+	p.LinkListToken = "deadbeef"
+
+	tt := []struct {
+		name     string
+		token    string
+		body     string
+		expected int
+		blocked  int
+		allowed  int
+	}{
+		{"Unauthorized", "", `{"block": ["example.com"]}`, http.StatusUnauthorized, 0, 0},
+		{"WrongToken", "cafebabe", `{"block": ["example.com"]}`, http.StatusUnauthorized, 0, 0},
+		{"Malformed", "deadbeef", `{"block": `, http.StatusBadRequest, 0, 0},
+		{"Block", "deadbeef", `{"block": ["example.com", "example.net"]}`, http.StatusOK, 2, 0},
+		{"Allow", "deadbeef", `{"allow": ["example.net"]}`, http.StatusOK, 1, 1},
+		{"Remove", "deadbeef", `{"remove": ["example.net"]}`, http.StatusOK, 1, 0},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			w := httptest.NewRecorder()
+			p.Response(nil)(w, req)
+
+			if w.Code != tc.expected {
+				t.Fatalf("expected status %d, got %d", tc.expected, w.Code)
+			}
+
+			// Reopen the list as the bot would, reading it from disk.
+			reopened, err := antispam.OpenLinkList(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if blocked, allowed := reopened.Len(); blocked != tc.blocked || allowed != tc.allowed {
+				t.Errorf(
+					"expected %d blocked and %d allowed, got %d and %d",
+					tc.blocked,
+					tc.allowed,
+					blocked,
+					allowed,
+				)
+			}
+		})
+	}
+}
@@ -47,12 +47,18 @@ func registerMux(
 	//
 	// `OptionCheckMethod`: Verify the incoming payload is a `POST` method.
 	// `OptionCheckType`: Verify the incoming payload is of type `application/json`.
+	//
+	// Hooks without an endpoint configured are left unregistered.
 	for _, hook := range hooks {
 		err := hook.LoadConfig(config)
 		if err != nil {
 			return nil, err
 		}
 
+		if hook.Endpoint() == "" {
+			continue
+		}
+
 		mux.HandleFunc(
 			hook.Endpoint(),
 			func(httpfn http.HandlerFunc) http.HandlerFunc {
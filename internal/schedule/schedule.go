@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type bounds struct {
+	min, max uint
+}
+
+var (
+	minutes = bounds{0, 59}
+	hours   = bounds{0, 23}
+	days    = bounds{1, 31}
+	months  = bounds{1, 12}
+	// Both 0 and 7 denote Sunday, the latter is folded into the former.
+	weekdays = bounds{0, 7}
+)
+
+var descriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Schedule is a parsed cron-like specification consisting of the five
+// standard fields: minute, hour, day of month, month and day of week.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Whether the day of month/week fields were left unrestricted, which
+	// determines how the two are combined when matching a day.
+	domStar, dowStar bool
+}
+
+// Parse a cron specification, e.g., "30 9 * * 1-5", or one of the
+// shorthand descriptors (@hourly, @daily, @weekly and @monthly).
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := descriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf(
+			"schedule: expected 5 fields in %q, found %d",
+			spec,
+			len(fields),
+		)
+	}
+
+	var (
+		s   Schedule
+		err error
+	)
+
+	if s.minute, err = parseField(fields[0], minutes); err != nil {
+		return nil, err
+	}
+
+	if s.hour, err = parseField(fields[1], hours); err != nil {
+		return nil, err
+	}
+
+	if s.dom, err = parseField(fields[2], days); err != nil {
+		return nil, err
+	}
+
+	if s.month, err = parseField(fields[3], months); err != nil {
+		return nil, err
+	}
+
+	if s.dow, err = parseField(fields[4], weekdays); err != nil {
+		return nil, err
+	}
+
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+
+	return &s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+
+	for part := range strings.SplitSeq(field, ",") {
+		var (
+			rng  = part
+			step = uint(1)
+		)
+
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.ParseUint(after, 10, 8)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("schedule: invalid step in %q", part)
+			}
+
+			rng, step = before, uint(n)
+		}
+
+		var low, high uint
+
+		switch before, after, ok := strings.Cut(rng, "-"); {
+		case rng == "*":
+			low, high = b.min, b.max
+		case ok:
+			l, err := parseValue(before, b)
+			if err != nil {
+				return 0, err
+			}
+
+			h, err := parseValue(after, b)
+			if err != nil {
+				return 0, err
+			}
+
+			low, high = l, h
+		default:
+			v, err := parseValue(rng, b)
+			if err != nil {
+				return 0, err
+			}
+			// A single value with a step, e.g., "5/15", runs from the
+			// value through to the end of the range.
+			low, high = v, v
+			if step > 1 {
+				high = b.max
+			}
+		}
+
+		if low > high {
+			return 0, fmt.Errorf("schedule: invalid range in %q", part)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (uint, error) {
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf(
+			"schedule: value %q out of range [%d-%d]",
+			value,
+			b.min,
+			b.max,
+		)
+	}
+
+	return uint(n), nil
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	// Same as cron(8), if both day fields are restricted then a day
+	// matching either of them is sufficient.
+	if !s.domStar && !s.dowStar {
+		return dom || dow
+	}
+
+	return dom && dow
+}
+
+// Next returns the earliest time after t matching the schedule, in the
+// location of t.  The zero time is returned if nothing matches within
+// the next five years, e.g., for "0 0 31 2 *".
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		spec  string
+		valid bool
+	}{
+		{"* * * * *", true},
+		{"0 9 * * 1-5", true},
+		{"*/15 0,12 1 */2 7", true},
+		{"@daily", true},
+		{"@weekly", true},
+		{"0 9 * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"*/0 * * * *", false},
+		{"5-1 * * * *", false},
+		{"@yearly", false},
+	}
+	for _, tc := range tt {
+		_, err := Parse(tc.spec)
+		if (err == nil) != tc.valid {
+			t.Errorf("%q: expected valid=%v, got %v", tc.spec, tc.valid, err)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Wednesday.
+	now := time.Date(2025, 12, 10, 9, 30, 15, 0, time.UTC)
+
+	tt := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2025, 12, 10, 9, 31, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2025, 12, 11, 9, 0, 0, 0, time.UTC)},
+		{"45 9 * * *", time.Date(2025, 12, 10, 9, 45, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 12, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 12, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 12, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2025, 12, 11, 8, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/20 10 * * *", time.Date(2025, 12, 10, 10, 0, 0, 0, time.UTC)},
+		// Either day field matching is sufficient when both are restricted.
+		{"0 0 1 * 5", time.Date(2025, 12, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tc := range tt {
+		schedule, err := Parse(tc.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.spec, err)
+		}
+
+		if actual := schedule.Next(now); !actual.Equal(tc.expected) {
+			t.Errorf("%q: expected %s, got %s", tc.spec, tc.expected, actual)
+		}
+	}
+}
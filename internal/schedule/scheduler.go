@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package schedule
+
+import (
+	"sync"
+	"time"
+)
+
+type job struct {
+	schedule *Schedule
+	fn       func(time.Time)
+}
+
+// Scheduler runs jobs at the times dictated by their schedule, each in
+// its own goroutine, until stopped.
+type Scheduler struct {
+	jobs []job
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{stop: make(chan struct{})}
+}
+
+// Add registers fn to be called with the scheduled time whenever the
+// schedule fires.  Jobs must be added prior to calling Start.
+func (s *Scheduler) Add(schedule *Schedule, fn func(time.Time)) {
+	s.jobs = append(s.jobs, job{schedule, fn})
+}
+
+func (s *Scheduler) Start() {
+	for _, j := range s.jobs {
+		s.wg.Go(func() { s.run(j) })
+	}
+}
+
+// Stop the scheduler and wait for any running jobs to finish.
+func (s *Scheduler) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run(j job) {
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-timer.C:
+			j.fn(next)
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
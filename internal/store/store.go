@@ -0,0 +1,349 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Maximum size of a single serialised record when replaying the log.
+const maxRecordSize int = 16 << 20
+
+// ErrReadOnly is returned when writing to a store opened read-only.
+var ErrReadOnly = errors.New("store: opened read-only")
+
+type record[T any] struct {
+	Key   string `json:"k"`
+	Value *T     `json:"v,omitempty"`
+}
+
+// Store is a small embedded key/value store backed by an append-only
+// JSON lines file.  Every write is appended to the log, while deletions
+// are recorded as tombstones and discarded during compaction.
+//
+// A store is meant to have a single writer, although any number of
+// readers (including other processes) may open the same file with
+// OpenReadOnly; changes on disk are picked up transparently on the next
+// read.  Only the writer ever compacts the log, as a reader renaming a
+// compacted log into place would lose anything the writer appends to the
+// file it replaced.
+type Store[T any] struct {
+	path     string
+	readOnly bool
+
+	mu      sync.RWMutex
+	data    map[string]T
+	records int
+	size    int64
+	modTime time.Time
+}
+
+func Open[T any](path string) (*Store[T], error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+
+	s := &Store[T]{
+		path: path,
+		data: make(map[string]T),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	// Replaying a log where most of the records are stale is wasted
+	// work, so rewrite it once the live set is less than half of it.
+	if s.records > 2*len(s.data) {
+		if err := s.Compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// OpenReadOnly opens the store at path for reading only, leaving writes
+// to the process that opened it with Open.  A missing store reads as
+// empty until it is written to.
+func OpenReadOnly[T any](path string) (*Store[T], error) {
+	s := &Store[T]{
+		path:     path,
+		readOnly: true,
+		data:     make(map[string]T),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Store[T]) Path() string { return s.path }
+
+func (s *Store[T]) Get(key string) (T, bool) {
+	s.refresh()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.data[key]
+
+	return value, ok
+}
+
+func (s *Store[T]) Len() int {
+	s.refresh()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.data)
+}
+
+// Range calls fn for every key/value pair held by the store, stopping
+// early if fn returns false.  Iteration order is unspecified.
+func (s *Store[T]) Range(fn func(string, T) bool) {
+	s.refresh()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for key, value := range s.data {
+		if !fn(key, value) {
+			return
+		}
+	}
+}
+
+func (s *Store[T]) Put(key string, value T) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(record[T]{Key: key, Value: &value}); err != nil {
+		return err
+	}
+
+	s.data[key] = value
+
+	return nil
+}
+
+func (s *Store[T]) Delete(key string) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data[key]; !ok {
+		return nil
+	}
+
+	if err := s.append(record[T]{Key: key}); err != nil {
+		return err
+	}
+
+	delete(s.data, key)
+
+	return nil
+}
+
+// Prune removes every entry for which fn returns true and compacts the
+// underlying file, returning the number of entries removed.
+func (s *Store[T]) Prune(fn func(string, T) bool) (int, error) {
+	if s.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	s.refresh()
+
+	s.mu.Lock()
+
+	var pruned int
+
+	for key, value := range s.data {
+		if fn(key, value) {
+			delete(s.data, key)
+
+			pruned++
+		}
+	}
+
+	s.mu.Unlock()
+
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	return pruned, s.Compact()
+}
+
+// Compact rewrites the log so that it only contains the live set of
+// entries.  The new file is written beside the old one and renamed into
+// place, so readers never observe a partially written log.
+func (s *Store[T]) Compact() error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+
+	for key := range s.data {
+		value := s.data[key]
+		if err := encoder.Encode(record[T]{Key: key, Value: &value}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.records = len(s.data)
+
+	return s.stat()
+}
+
+func (s *Store[T]) append(rec record[T]) error {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(buf, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	s.records++
+
+	return s.stat()
+}
+
+func (s *Store[T]) stat() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.size, s.modTime = info.Size(), info.ModTime()
+
+	return nil
+}
+
+// Reload the log if it has been modified since it was last read, which
+// happens whenever another process writes to the same store.
+func (s *Store[T]) refresh() {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	changed := info.Size() != s.size || !info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+
+	if changed {
+		s.load()
+	}
+}
+
+func (s *Store[T]) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var (
+		data    = make(map[string]T, len(s.data))
+		records int
+		scanner = bufio.NewScanner(file)
+	)
+
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	for scanner.Scan() {
+		var rec record[T]
+		// A torn write (e.g., the process was killed mid-append) leaves
+		// a partial trailing line behind, skip it rather than failing.
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+
+		records++
+
+		if rec.Value == nil {
+			delete(data, rec.Key)
+			continue
+		}
+
+		data[rec.Key] = *rec.Value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	s.data, s.records = data, records
+	s.size, s.modTime = info.Size(), info.ModTime()
+
+	return nil
+}
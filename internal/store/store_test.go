@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: BSD-2-Clause
+//
+// Copyright (c) Lewis Cook <lcook@FreeBSD.org>
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestStorePersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+
+	s, err := Open[entry](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []entry{{"a", 1}, {"b", 2}, {"c", 3}, {"a", 4}} {
+		if err := s.Put(e.Name, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open[entry](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		key      string
+		expected int
+		exists   bool
+	}{
+		{"a", 4, true},
+		{"b", 0, false},
+		{"c", 3, true},
+	}
+	for _, tc := range tt {
+		actual, ok := reopened.Get(tc.key)
+		if ok != tc.exists || actual.Count != tc.expected {
+			t.Errorf(
+				"key %s: expected (%d, %v), got (%d, %v)",
+				tc.key, tc.expected, tc.exists, actual.Count, ok,
+			)
+		}
+	}
+
+	if reopened.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", reopened.Len())
+	}
+}
+
+func TestStoreRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+
+	writer, err := Open[entry](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenReadOnly[entry](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := reader.Get("a"); ok {
+		t.Fatal("expected empty store")
+	}
+
+	writer.Put("a", entry{"a", 1})
+
+	if actual, ok := reader.Get("a"); !ok || actual.Count != 1 {
+		t.Errorf("expected reader to observe write, got (%v, %v)", actual, ok)
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+
+	s, err := Open[entry](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, name := range []string{"a", "b", "c", "d"} {
+		s.Put(name, entry{name, idx})
+	}
+
+	pruned, err := s.Prune(func(_ string, e entry) bool { return e.Count%2 == 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned != 2 {
+		t.Errorf("expected 2 pruned entries, got %d", pruned)
+	}
+
+	reopened, err := Open[entry](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reopened.Len() != 2 || reopened.records != 2 {
+		t.Errorf(
+			"expected 2 entries and records, got %d and %d",
+			reopened.Len(),
+			reopened.records,
+		)
+	}
+}
+
+func TestStoreReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+
+	writer, err := Open[entry](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx := range 4 {
+		writer.Put("a", entry{"a", idx})
+	}
+
+	reader, err := OpenReadOnly[entry](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mostly stale records are left for the writer to compact.
+	if reader.records != 4 {
+		t.Errorf("expected the log to be left as is, got %d records", reader.records)
+	}
+
+	if err := reader.Put("b", entry{"b", 1}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected write to be refused, got %v", err)
+	}
+
+	if err := reader.Compact(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected compaction to be refused, got %v", err)
+	}
+
+	writer.Put("b", entry{"b", 2})
+
+	if actual, ok := reader.Get("b"); !ok || actual.Count != 2 {
+		t.Errorf("expected reader to observe write, got (%v, %v)", actual, ok)
+	}
+}